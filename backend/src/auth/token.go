@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// AccessTokenTTL is how long a signed access token stays valid. Revoking a session stops its
+// refreshes at once, and the API refuses its access tokens once the server knows of the
+// revocation: straight away on the server that made it, within 5 seconds on the others (see
+// handler.SyncRevokedSessions). Servers only remember revocations for this long, so it also
+// bounds how long a revoked session has to be tracked.
+const AccessTokenTTL = 15 * time.Minute
+
+// RefreshTokenTTL is how long a refresh token can be exchanged for a new access token
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// Claims is the payload carried inside a signed access token
+type Claims struct {
+	UserID    int   `json:"uid"`
+	SessionID int   `json:"sid"`
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+var (
+	secretOnce sync.Once
+	secret     []byte
+)
+
+// tokenHeader is the fixed JWT header, tokens are always HS256
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// signingKey loads SESSION_SECRET once, falling back to a random per-process key
+func signingKey() []byte {
+	secretOnce.Do(func() {
+		godotenv.Load()
+		if s := os.Getenv("SESSION_SECRET"); s != "" {
+			secret = []byte(s)
+			return
+		}
+		log.Println("SESSION_SECRET not set, using a random key (sessions will not survive a restart)")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate session secret: %v", err)
+		}
+	})
+	return secret
+}
+
+func sign(data string) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken creates a signed access token for the given user and session
+func IssueToken(userID, sessionID int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+
+	payload, err := json.Marshal(Claims{UserID: userID, SessionID: sessionID, IssuedAt: now.Unix(), ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode token claims: %w", err)
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(unsigned), expiresAt, nil
+}
+
+// ParseToken verifies an access token and returns its claims
+func ParseToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	expected := sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	if claims.UserID == 0 {
+		return nil, fmt.Errorf("token has no user")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+
+	return &claims, nil
+}
+
+// NewOpaqueToken returns a random URL-safe token and the hash to store for it.
+// Only the hash is persisted so a database leak doesn't leak usable tokens.
+func NewOpaqueToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken hashes a token from NewOpaqueToken for lookup
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
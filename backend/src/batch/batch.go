@@ -0,0 +1,35 @@
+// Package batch runs background jobs that work through rows claimed a batch at a time
+package batch
+
+import "time"
+
+// DefaultSize is how many rows a job claims per statement
+const DefaultSize = 100
+
+// Drain calls claim with the batch size, DefaultSize when size is zero, until it handles fewer
+// rows than that, and returns how many it handled in all
+func Drain(size int, claim func(size int) (int, error)) (int, error) {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	total := 0
+	for {
+		n, err := claim(size)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < size {
+			return total, nil
+		}
+	}
+}
+
+// Every calls run every interval until the process exits
+func Every(interval time.Duration, run func()) {
+	for {
+		run()
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrWrongPassword is returned when a supplied current password doesn't match
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// ErrInvalidResetToken is returned for unknown, used or expired reset tokens
+var ErrInvalidResetToken = errors.New("reset token is invalid or expired")
+
+// ChangePassword replaces a user's password after checking their current one
+func (db *DBInterface) ChangePassword(userID int, currentPassword, newPassword string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var storedHash string
+	err := db.pool.QueryRow(ctx, "SELECT password_hash FROM users WHERE id = $1", userID).Scan(&storedHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load user ID %d: %w", userID, err)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(currentPassword)) != nil {
+		return ErrWrongPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("password hashing failed: %w", err)
+	}
+
+	_, err = db.pool.Exec(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", string(hashedPassword), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+// GetUserEmail returns the user ID and email on file for a username.
+// The email is empty when the user never gave one.
+func (db *DBInterface) GetUserEmail(username string) (int, string, error) {
+	var userID int
+	var email *string
+	err := db.pool.QueryRow(context.Background(),
+		"SELECT id, email FROM users WHERE username = $1", username).Scan(&userID, &email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", fmt.Errorf("user %s: %w", username, ErrNotFound)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to look up user %s: %w", username, err)
+	}
+	if email == nil {
+		return userID, "", nil
+	}
+	return userID, *email, nil
+}
+
+// CreatePasswordReset stores the hash of a single-use reset token for a user
+func (db *DBInterface) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.pool.Exec(context.Background(),
+		"INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store password reset: %w", err)
+	}
+	return nil
+}
+
+// ConsumePasswordReset sets a new password using a reset token and burns the token.
+// Any other outstanding tokens for the same user are burned too. Returns the user ID.
+func (db *DBInterface) ConsumePasswordReset(tokenHash, newPassword string) (int, error) {
+	ctx := context.Background()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("password hashing failed: %w", err)
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the row so two concurrent requests can't both use the token
+	var userID int
+	err = tx.QueryRow(ctx, `
+		SELECT user_id FROM password_resets
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up reset token: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", string(hashedPassword), userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to burn reset tokens: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// MaxAttachments is how many files a single post can carry
+const MaxAttachments = 10
+
+// Attachment is one file in a post's album
+type Attachment struct {
+	ID        int    `json:"attachment_id"`
+	Position  int    `json:"position"`
+	FileName  string `json:"file_name"`
+	MimeType  string `json:"mime_type"`
+	SizeBytes int64  `json:"size_bytes"`
+	Width     *int   `json:"width"`
+	Height    *int   `json:"height"`
+}
+
+// insertAttachments stores attachments from firstPosition on, inside the caller's transaction
+func insertAttachments(ctx context.Context, tx pgx.Tx, postID, firstPosition int, attachments []Attachment) error {
+	for i, a := range attachments {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO post_attachments (post_id, position, file_name, mime_type, size_bytes, width, height)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			postID, firstPosition+i, a.FileName, a.MimeType, a.SizeBytes, a.Width, a.Height)
+		if err != nil {
+			return fmt.Errorf("failed to add attachment to post ID %d: %w", postID, err)
+		}
+	}
+
+	// posts.file_name keeps pointing at the first file for older clients
+	_, err := tx.Exec(ctx, `
+		UPDATE posts SET file_name = COALESCE(
+			(SELECT file_name FROM post_attachments WHERE post_id = $1 ORDER BY position LIMIT 1), '')
+		WHERE id = $1`, postID)
+	if err != nil {
+		return fmt.Errorf("failed to update file name of post ID %d: %w", postID, err)
+	}
+	return nil
+}
+
+// GetAttachments returns a post's attachments in order
+func (db *DBInterface) GetAttachments(postID int) ([]Attachment, error) {
+	byPost, err := db.getAttachments([]int{postID})
+	if err != nil {
+		return nil, err
+	}
+	if byPost[postID] == nil {
+		return []Attachment{}, nil
+	}
+	return byPost[postID], nil
+}
+
+// getAttachments loads the attachments of many posts at once, keyed by post ID
+func (db *DBInterface) getAttachments(postIDs []int) (map[int][]Attachment, error) {
+	byPost := map[int][]Attachment{}
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT id, post_id, position, file_name, mime_type, size_bytes, width, height
+		FROM post_attachments WHERE post_id = ANY($1)
+		ORDER BY post_id, position`, postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Attachment
+		var postID int
+		if err := rows.Scan(&a.ID, &postID, &a.Position, &a.FileName, &a.MimeType, &a.SizeBytes, &a.Width, &a.Height); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		byPost[postID] = append(byPost[postID], a)
+	}
+	return byPost, rows.Err()
+}
+
+// attachAttachments adds the attachments array to posts loaded with scanPost.
+// Posts from before attachments were tracked get one built from their file_name.
+func (db *DBInterface) attachAttachments(posts []map[string]interface{}) error {
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post["post_id"].(int))
+	}
+
+	byPost, err := db.getAttachments(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		attachments := byPost[post["post_id"].(int)]
+		if attachments == nil {
+			attachments = []Attachment{}
+			if fileName, _ := post["file_name"].(string); fileName != "" {
+				attachments = append(attachments, Attachment{FileName: fileName, MimeType: mime.TypeByExtension(filepath.Ext(fileName))})
+			}
+		}
+		post["attachments"] = attachments
+	}
+	return nil
+}
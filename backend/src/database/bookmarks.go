@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// MaxCollectionNameLength is the longest bookmark collection name, in characters
+const MaxCollectionNameLength = 100
+
+// Errors returned when managing bookmark collections
+var (
+	ErrInvalidCollectionName = errors.New("collection name must be 1 to 100 characters")
+	ErrCollectionExists      = errors.New("a collection with this name already exists")
+)
+
+// BookmarkCollection is a named group of a user's bookmarks
+type BookmarkCollection struct {
+	ID            int    `json:"collection_id"`
+	Name          string `json:"name"`
+	CreatedAt     string `json:"created_at"`
+	BookmarkCount int    `json:"bookmark_count"`
+}
+
+// ValidateCollectionName trims a collection name and checks its length
+func ValidateCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > MaxCollectionNameLength {
+		return "", ErrInvalidCollectionName
+	}
+	return name, nil
+}
+
+// BookmarkPost saves a post for a user, in one of their collections or none when collectionID
+// is zero. Bookmarking a post again moves it to the given collection.
+func (db *DBInterface) BookmarkPost(userID, postID, collectionID int) error {
+	var collection interface{}
+	if collectionID != 0 {
+		collection = collectionID
+	}
+	tag, err := db.pool.Exec(context.Background(), `
+		INSERT INTO post_bookmarks (user_id, post_id, collection_id)
+		SELECT $1, $2, $3::int
+		WHERE $3::int IS NULL OR EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET collection_id = EXCLUDED.collection_id`,
+		userID, postID, collection)
+	if err != nil {
+		return fmt.Errorf("failed to bookmark post ID %d: %w", postID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("collection ID %d: %w", collectionID, ErrNotFound)
+	}
+	return nil
+}
+
+// UnbookmarkPost removes a post from a user's bookmarks, unbookmarking twice is fine
+func (db *DBInterface) UnbookmarkPost(userID, postID int) error {
+	_, err := db.pool.Exec(context.Background(),
+		"DELETE FROM post_bookmarks WHERE user_id = $1 AND post_id = $2", userID, postID)
+	if err != nil {
+		return fmt.Errorf("failed to unbookmark post ID %d: %w", postID, err)
+	}
+	return nil
+}
+
+// GetBookmarks returns the posts viewer has bookmarked, most recently saved first, limited to
+// one collection when collectionID isn't zero. Bookmarked posts that have since expired or
+// been hidden from the viewer are left out.
+func (db *DBInterface) GetBookmarks(viewer Viewer, collectionID, limit, offset int) ([]map[string]interface{}, error) {
+	var collection interface{}
+	if collectionID != 0 {
+		collection = collectionID
+	}
+	visible, args := viewer.visibleClause([]interface{}{limit, offset, collection})
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT `+postColumns+`
+		FROM post_bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON p.user_id = u.id
+		WHERE b.user_id = $4 AND ($3::int IS NULL OR b.collection_id = $3)
+		AND `+postLiveClause+` AND (p.user_id = $4 OR (`+postPublishedClause+` AND `+visible+`))
+		ORDER BY b.created_at DESC, b.post_id DESC
+		LIMIT $1 OFFSET $2`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []map[string]interface{}{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bookmarked post: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bookmarks: %w", err)
+	}
+
+	if err := db.completePosts(posts, viewer); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// CreateBookmarkCollection adds a named collection for a user and returns its ID
+func (db *DBInterface) CreateBookmarkCollection(userID int, name string) (int, error) {
+	name, err := ValidateCollectionName(name)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	err = db.pool.QueryRow(context.Background(), `
+		INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2)
+		ON CONFLICT (user_id, name) DO NOTHING RETURNING id`, userID, name).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrCollectionExists
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create collection: %w", err)
+	}
+	return id, nil
+}
+
+// RenameBookmarkCollection changes the name of one of a user's collections
+func (db *DBInterface) RenameBookmarkCollection(userID, collectionID int, name string) error {
+	name, err := ValidateCollectionName(name)
+	if err != nil {
+		return err
+	}
+	tag, err := db.pool.Exec(context.Background(), `
+		UPDATE bookmark_collections SET name = $3
+		WHERE id = $1 AND user_id = $2
+		AND NOT EXISTS (SELECT 1 FROM bookmark_collections WHERE user_id = $2 AND name = $3 AND id <> $1)`,
+		collectionID, userID, name)
+	if err != nil {
+		return fmt.Errorf("failed to rename collection ID %d: %w", collectionID, err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// tell a missing collection apart from a name that's taken
+	var exists bool
+	err = db.pool.QueryRow(context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $1 AND user_id = $2)", collectionID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up collection ID %d: %w", collectionID, err)
+	}
+	if !exists {
+		return fmt.Errorf("collection ID %d: %w", collectionID, ErrNotFound)
+	}
+	return ErrCollectionExists
+}
+
+// DeleteBookmarkCollection removes one of a user's collections. Its bookmarks are kept, outside
+// any collection.
+func (db *DBInterface) DeleteBookmarkCollection(userID, collectionID int) error {
+	tag, err := db.pool.Exec(context.Background(),
+		"DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2", collectionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection ID %d: %w", collectionID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("collection ID %d: %w", collectionID, ErrNotFound)
+	}
+	return nil
+}
+
+// ListBookmarkCollections returns a user's collections by name with how many bookmarks each has
+func (db *DBInterface) ListBookmarkCollections(userID int) ([]BookmarkCollection, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT c.id, c.name, c.created_at, COUNT(b.post_id)
+		FROM bookmark_collections c
+		LEFT JOIN post_bookmarks b ON b.collection_id = c.id
+		WHERE c.user_id = $1
+		GROUP BY c.id
+		ORDER BY c.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+	for rows.Next() {
+		var c BookmarkCollection
+		var createdAt time.Time
+		if err := rows.Scan(&c.ID, &c.Name, &createdAt, &c.BookmarkCount); err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		c.CreatedAt = createdAt.Format(time.RFC3339)
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating collections: %w", err)
+	}
+	return collections, nil
+}
+
+// attachBookmarks sets "bookmarked" on each post, whether viewerID has saved it
+func (db *DBInterface) attachBookmarks(posts []map[string]interface{}, viewerID int) error {
+	saved := map[int]bool{}
+	if len(posts) > 0 && viewerID != 0 {
+		ids := make([]int, 0, len(posts))
+		for _, post := range posts {
+			id, _ := post["post_id"].(int)
+			ids = append(ids, id)
+		}
+		rows, err := db.pool.Query(context.Background(),
+			"SELECT post_id FROM post_bookmarks WHERE user_id = $1 AND post_id = ANY($2)", viewerID, ids)
+		if err != nil {
+			return fmt.Errorf("failed to get bookmarks: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return fmt.Errorf("failed to scan bookmark: %w", err)
+			}
+			saved[id] = true
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating bookmarks: %w", err)
+		}
+	}
+	for _, post := range posts {
+		id, _ := post["post_id"].(int)
+		post["bookmarked"] = saved[id]
+	}
+	return nil
+}
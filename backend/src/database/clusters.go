@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Cluster grid limits
+const (
+	MaxClusterZoom  = 20
+	MaxClusterTiles = 256 // tiles one request may cover
+	clusterCellBits = 3   // each tile is split into 8 by 8 cells, one cluster at most per cell
+)
+
+// Errors returned for cluster requests the grid can't answer
+var (
+	ErrInvalidZoom  = fmt.Errorf("zoom must be a whole number between 0 and %d", MaxClusterZoom)
+	ErrTooManyTiles = fmt.Errorf("bbox covers more than %d tiles at this zoom, zoom out or shrink it", MaxClusterTiles)
+)
+
+// Tile is a square of the cluster grid. At zoom z the world is split into 2^z columns of
+// longitude counted east from -180 and 2^z rows of latitude counted south from 90, all the
+// same size in degrees.
+type Tile struct {
+	Zoom, X, Y int
+}
+
+// String returns the tile as zoom/x/y
+func (t Tile) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Zoom, t.X, t.Y)
+}
+
+// Box returns the area the tile covers
+func (t Tile) Box() Box {
+	width, height := 360/float64(int(1)<<t.Zoom), 180/float64(int(1)<<t.Zoom)
+	return Box{
+		MinLon: -180 + float64(t.X)*width,
+		MinLat: 90 - float64(t.Y+1)*height,
+		MaxLon: -180 + float64(t.X+1)*width,
+		MaxLat: 90 - float64(t.Y)*height,
+	}
+}
+
+// TileClusters is the clusters in one tile. Every post belongs to exactly one tile, so a
+// client can cache tiles one by one and fetch any of them alone by passing BBox.
+type TileClusters struct {
+	Tile     string     `json:"tile"`
+	BBox     [4]float64 `json:"bbox"` // minLon, minLat, maxLon, maxLat of the tile
+	Clusters []Cluster  `json:"clusters"`
+}
+
+// Cluster is the posts in one cell of a tile
+type Cluster struct {
+	Latitude  float64 `json:"latitude"` // centroid of the posts as the viewer is shown them
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+	TopPostID int     `json:"top_post_id"` // the post the feed would list first with the same sort
+	NewestAt  string  `json:"newest_at"`
+}
+
+// TilesFor returns the tiles at zoom that cover boxes, from ParseBBox, box by box and row by
+// row from the north. A tile holds its west and north edges, so the bbox of a tile covers only
+// that tile.
+func TilesFor(boxes []Box, zoom int) ([]Tile, error) {
+	if zoom < 0 || zoom > MaxClusterZoom {
+		return nil, ErrInvalidZoom
+	}
+	n := 1 << zoom
+	width, height := 360/float64(n), 180/float64(n)
+	// the range of columns and rows a box touches, leaving out those it only meets at an edge
+	columns := func(b Box) (int, int) {
+		first := clampIndex(math.Floor((b.MinLon+180)/width), n)
+		return first, max(first, clampIndex(math.Ceil((b.MaxLon+180)/width)-1, n))
+	}
+	rows := func(b Box) (int, int) {
+		first := clampIndex(math.Floor((90-b.MaxLat)/height), n)
+		return first, max(first, clampIndex(math.Ceil((90-b.MinLat)/height)-1, n))
+	}
+
+	count := 0
+	for _, b := range boxes {
+		x0, x1 := columns(b)
+		y0, y1 := rows(b)
+		count += (x1 - x0 + 1) * (y1 - y0 + 1)
+	}
+	if count > MaxClusterTiles {
+		return nil, ErrTooManyTiles
+	}
+
+	seen := map[Tile]bool{}
+	var tiles []Tile
+	for _, b := range boxes {
+		x0, x1 := columns(b)
+		y0, y1 := rows(b)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				// the two halves of a viewport across the antimeridian meet in one tile at zoom 0
+				if t := (Tile{Zoom: zoom, X: x, Y: y}); !seen[t] {
+					seen[t] = true
+					tiles = append(tiles, t)
+				}
+			}
+		}
+	}
+	return tiles, nil
+}
+
+// clampIndex returns a grid index limited to 0 to n-1
+func clampIndex(index float64, n int) int {
+	return int(math.Min(math.Max(index, 0), float64(n-1)))
+}
+
+// ClusterPosts groups the posts matching f that viewer may see into clusters, for every tile
+// at zoom covering f.BBox, which must be set. Posts are placed where viewer is shown them, so
+// a cluster never gives away more of a location than its posts do; each tile is split into a
+// grid of cells and every non-empty cell is one cluster. Tiles without posts come back with
+// no clusters. Paging doesn't apply.
+func (db *DBInterface) ClusterPosts(viewer Viewer, f PostFilter, zoom int) ([]TileClusters, error) {
+	tiles, err := TilesFor(f.BBox, zoom)
+	if err != nil {
+		return nil, err
+	}
+
+	// the feed's viewport filter finds the posts shown in the area the tiles of each box
+	// cover, then the cells of the tiles are kept
+	var boxes []Box
+	for _, b := range f.BBox {
+		covered, _ := TilesFor([]Box{b}, zoom)
+		area := covered[0].Box()
+		for _, t := range covered[1:] {
+			tb := t.Box()
+			area = Box{MinLon: math.Min(area.MinLon, tb.MinLon), MinLat: math.Min(area.MinLat, tb.MinLat),
+				MaxLon: math.Max(area.MaxLon, tb.MaxLon), MaxLat: math.Max(area.MaxLat, tb.MaxLat)}
+		}
+		boxes = append(boxes, area)
+	}
+	f.BBox = boxes
+	xs, ys := make([]int, len(tiles)), make([]int, len(tiles))
+	for i, t := range tiles {
+		xs[i], ys[i] = t.X, t.Y
+	}
+
+	// feedConditions starts with the viewer's ID as $1
+	whereClauses, args := feedConditions(viewer, f)
+	n := len(args)
+	query := fmt.Sprintf(`
+		WITH placed AS (
+			SELECT p.id, p.like_count, p.created_at, shown.latitude, shown.longitude,
+				LEAST(GREATEST(floor((shown.longitude + 180) / (360 / $%[1]d::float8)), 0), $%[1]d::float8 - 1)::int AS cx,
+				LEAST(GREATEST(floor((90 - shown.latitude) / (180 / $%[1]d::float8)), 0), $%[1]d::float8 - 1)::int AS cy
+			FROM posts p %[2]s
+			WHERE %[3]s
+		)
+		SELECT p.cx >> %[4]d, p.cy >> %[4]d, COUNT(*), AVG(p.latitude), AVG(p.longitude),
+			(array_agg(p.id ORDER BY %[5]s, p.id DESC))[1], MAX(p.created_at)
+		FROM placed p
+		WHERE (p.cx >> %[4]d, p.cy >> %[4]d) IN (SELECT * FROM unnest($%[6]d::int[], $%[7]d::int[]))
+		GROUP BY p.cx, p.cy
+		ORDER BY p.cy, p.cx`,
+		n+1, shownLocationJoins(1), strings.Join(whereClauses, " AND "), clusterCellBits, feedOrder(f.Sort), n+2, n+3)
+	args = append(args, float64(int(1)<<(zoom+clusterCellBits)), xs, ys)
+
+	rows, err := db.pool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cluster posts: %w", err)
+	}
+	defer rows.Close()
+
+	clusters := map[Tile][]Cluster{}
+	for rows.Next() {
+		t := Tile{Zoom: zoom}
+		var c Cluster
+		var newest time.Time
+		if err := rows.Scan(&t.X, &t.Y, &c.Count, &c.Latitude, &c.Longitude, &c.TopPostID, &newest); err != nil {
+			return nil, fmt.Errorf("failed to scan cluster: %w", err)
+		}
+		c.NewestAt = newest.Format(time.RFC3339)
+		clusters[t] = append(clusters[t], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating clusters: %w", err)
+	}
+
+	result := make([]TileClusters, len(tiles))
+	for i, t := range tiles {
+		b := t.Box()
+		result[i] = TileClusters{
+			Tile:     t.String(),
+			BBox:     [4]float64{b.MinLon, b.MinLat, b.MaxLon, b.MaxLat},
+			Clusters: clusters[t],
+		}
+		if result[i].Clusters == nil {
+			result[i].Clusters = []Cluster{}
+		}
+	}
+	return result, nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,11 +22,18 @@ type DBInterface struct {
 	pool *pgxpool.Pool
 }
 
+// ErrNotFound is returned when a looked up row does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidUsername is returned when a username breaks the naming rules
+var ErrInvalidUsername = errors.New("username must be 3-30 letters, digits, underscores or dots and start with a letter or digit")
+
 // UserProfile holds public user information
 type UserProfile struct {
 	UserID    int    `json:"user_id"`
 	Username  string `json:"username"`
 	CreatedAt string `json:"created_at"`
+	Role      string `json:"role"`
 }
 
 // NewDBInterface initializes the database connection
@@ -53,16 +62,52 @@ func (db *DBInterface) Close() {
 
 // Register creates a new user
 func (db *DBInterface) Register(username, password string) error {
+	return db.RegisterWithEmail(username, password, "")
+}
+
+// ValidateUsername checks a username against the naming rules
+func ValidateUsername(username string) error {
+	if len(username) < 3 || len(username) > 30 {
+		return ErrInvalidUsername
+	}
+	for i, c := range username {
+		alnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !alnum && (i == 0 || (c != '_' && c != '.')) {
+			return ErrInvalidUsername
+		}
+	}
+	return nil
+}
+
+// RegisterWithEmail creates a new user with an optional email used for password resets
+func (db *DBInterface) RegisterWithEmail(username, password, email string) error {
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("password hashing failed: %w", err)
 	}
 
-	_, err = db.pool.Exec(context.Background(),
-		"INSERT INTO users (username, password_hash) VALUES ($1, $2)", username, string(hashedPassword))
+	var emailArg interface{}
+	if email != "" {
+		emailArg = email
+	}
+
+	// names recently given up by a rename stay reserved for their old owner
+	tag, err := db.pool.Exec(context.Background(), `
+		INSERT INTO users (username, password_hash, email)
+		SELECT $1::VARCHAR, $2::TEXT, $3::VARCHAR WHERE NOT `+usernameReservedClause, username, string(hashedPassword), emailArg)
+	if usernameConflict(err) {
+		return ErrUsernameTaken
+	}
 	if err != nil {
 		return fmt.Errorf("failed to register user: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrUsernameTaken
+	}
 
 	return nil
 }
@@ -88,6 +133,15 @@ func (db *DBInterface) Authenticate(username, password string) (int, error) {
 		return 0, fmt.Errorf("invalid credentials")
 	}
 
+	// only tell a suspended user about it once they've proven who they are
+	suspended, err := db.IsSuspended(userID)
+	if err != nil {
+		return 0, err
+	}
+	if suspended {
+		return userID, ErrAccountSuspended
+	}
+
 	return userID, nil
 }
 
@@ -99,7 +153,7 @@ func (db *DBInterface) DeleteUser(username string) error {
 	}
 	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM posts WHERE user_id IN (SELECT id FROM users WHERE username=$1)", username)
+	_, err = tx.Exec(context.Background(), uncountReposts("DELETE FROM posts WHERE user_id IN (SELECT id FROM users WHERE username=$1)", "id"), username)
 	if err != nil {
 		return fmt.Errorf("failed to delete user posts: %w", err)
 	}
@@ -118,11 +172,8 @@ func (db *DBInterface) DeleteUser(username string) error {
 
 // Get username from the id
 func (db *DBInterface) GetUserNameId(id int) (string, error) {
-	var id_ int = -1
 	var userName string = ""
-	var hash string = ""
-	var createdAt time.Time
-	err := db.pool.QueryRow(context.Background(), "SELECT * FROM users WHERE id = $1", id).Scan(&id_, &userName, &hash, &createdAt)
+	err := db.pool.QueryRow(context.Background(), "SELECT username FROM users WHERE id = $1", id).Scan(&userName)
 	if err != nil {
 		//fmt.Println("failed to get username from ID %d: %w", id, err)
 		return "", err
@@ -130,6 +181,19 @@ func (db *DBInterface) GetUserNameId(id int) (string, error) {
 	return userName, nil
 }
 
+// GetUserIdByName looks up a user's ID from their username
+func (db *DBInterface) GetUserIdByName(username string) (int, error) {
+	var userID int
+	err := db.pool.QueryRow(context.Background(), "SELECT id FROM users WHERE username = $1", username).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("user %s: %w", username, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up user %s: %w", username, err)
+	}
+	return userID, nil
+}
+
 // CreatePost adds a new post
 func (db *DBInterface) CreatePost(userID int, content string, latitude, longitude float64) error {
 	_, err := db.pool.Exec(context.Background(),
@@ -155,75 +219,216 @@ func (db *DBInterface) CreatePostFile(userID int, content string, latitude, long
 	return nil
 }
 
-// GetPosts retrieves posts with optional filtering and pagination
+// NewPost is everything SavePost needs to create a post
+type NewPost struct {
+	UserID      int
+	Content     string
+	Latitude    float64
+	Longitude   float64
+	PublishAt   *time.Time // nil publishes right away
+	ExpiresAt   *time.Time // nil keeps the post until it's deleted
+	Visibility  string     // VisibilityPublic when empty
+	LocalRadius int        // meters, for VisibilityLocal; DefaultLocalRadius when zero
+	// how precisely others see the location, PrecisionExact when empty
+	LocationPrecision string
+	Poll              *NewPoll // nil for a post without a poll
+	Attachments       []Attachment
+	RepostOf          int    // the post this reposts or quotes, zero for an ordinary post
+	RepostKind        string // RepostKindRepost or RepostKindQuote when RepostOf is set
+}
+
+// SavePost inserts a post and its attachments in one transaction and returns the new post's ID.
+// store is called with that ID before the commit so files can be written to the post's folder;
+// if it fails, or anything else does, nothing is saved.
+func (db *DBInterface) SavePost(p NewPost, store func(postID int) error) (int, error) {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := ValidateVisibility(p.Visibility); err != nil {
+		return 0, err
+	}
+	if p.Visibility == "" {
+		p.Visibility = VisibilityPublic
+	}
+	if p.LocalRadius == 0 {
+		p.LocalRadius = DefaultLocalRadius
+	}
+	if err := ValidatePrecision(p.LocationPrecision); err != nil {
+		return 0, err
+	}
+	if p.LocationPrecision == "" {
+		p.LocationPrecision = PrecisionExact
+	}
+	if err := ValidateLocation(p.Latitude, p.Longitude); err != nil {
+		return 0, err
+	}
+
+	// the original is counted and locked before the repost exists, so it can't be deleted
+	// underneath it
+	var repostOf *int
+	var repostKind *string
+	if p.RepostOf != 0 {
+		if err := ValidateRepost(p.RepostKind, p.Content); err != nil {
+			return 0, err
+		}
+		target, err := countRepost(ctx, tx, p.RepostOf, p.RepostKind)
+		if err != nil {
+			return 0, err
+		}
+		repostOf, repostKind = &target, &p.RepostKind
+	}
+
+	// a scheduled post is dated when it goes out, so feeds sort it as new then
+	var postID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO posts (user_id, content, latitude, longitude, created_at, publish_at, expires_at, visibility, local_radius, location_precision, repost_of_id, repost_kind)
+		VALUES ($1, $2, $3, $4, COALESCE($5, NOW()), $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+		p.UserID, p.Content, p.Latitude, p.Longitude, p.PublishAt, p.ExpiresAt, p.Visibility, p.LocalRadius, p.LocationPrecision, repostOf, repostKind).Scan(&postID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create post: %w", err)
+	}
+
+	if len(p.Attachments) > 0 {
+		if err := insertAttachments(ctx, tx, postID, 0, p.Attachments); err != nil {
+			return 0, err
+		}
+	}
+	if err := indexEntities(ctx, tx, "post", postID, p.Content); err != nil {
+		return 0, err
+	}
+	if p.Poll != nil {
+		if err := insertPoll(ctx, tx, postID, *p.Poll); err != nil {
+			return 0, err
+		}
+	}
+
+	if store != nil {
+		if err := store(postID); err != nil {
+			return 0, fmt.Errorf("failed to store files of post ID %d: %w", postID, err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return postID, nil
+}
+
+// postColumns is the select list shared by every post query, read back by scanPost
+const postColumns = `p.id, p.user_id, u.username, p.content, p.latitude, p.longitude, p.created_at, p.file_name, p.like_count, p.edited_at, p.expires_at, p.publish_at, p.visibility, p.local_radius, p.location_precision, p.repost_of_id, p.repost_kind, p.repost_count, p.quote_count`
+
+// scanPost reads a row selected with postColumns into the map handed to clients
+func scanPost(row pgx.Row) (map[string]interface{}, error) {
+	var postID int
+	var userID int
+	var username, content, filename, visibility, precision string
+	var latitude, longitude float64
+	var createdAt time.Time
+	var editedAt, expiresAt, publishAt *time.Time
+	var likeCount, localRadius, repostCount, quoteCount int
+	var repostOfID *int
+	var repostKind *string
+
+	if err := row.Scan(&postID, &userID, &username, &content, &latitude, &longitude, &createdAt, &filename, &likeCount, &editedAt, &expiresAt, &publishAt, &visibility, &localRadius, &precision,
+		&repostOfID, &repostKind, &repostCount, &quoteCount); err != nil {
+		return nil, err
+	}
+
+	// a repost or quote whose original was deleted keeps its kind but loses the reference
+	var repostOf, kind interface{}
+	if repostOfID != nil {
+		repostOf = *repostOfID
+	}
+	if repostKind != nil {
+		kind = *repostKind
+	}
+
+	// the radius only means something for local posts
+	var radius interface{}
+	if visibility == VisibilityLocal {
+		radius = localRadius
+	}
+
+	// optional timestamps are null in the JSON when unset
+	optional := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	return map[string]interface{}{
+		"post_id":            postID,
+		"user_id":            userID,
+		"username":           username,
+		"content":            content,
+		"latitude":           latitude,
+		"longitude":          longitude,
+		"created_at":         createdAt.Format(time.RFC3339),
+		"file_name":          filename,
+		"like_count":         likeCount,
+		"edited_at":          optional(editedAt),
+		"expires_at":         optional(expiresAt),
+		"publish_at":         optional(publishAt),
+		"visibility":         visibility,
+		"local_radius":       radius,
+		"location_precision": precision,
+		"repost_of_id":       repostOf,
+		"repost_kind":        kind,
+		"repost_count":       repostCount,
+		"quote_count":        quoteCount,
+	}, nil
+}
+
+// PostFilter holds the filters and paging of a feed request
+type PostFilter struct {
+	Latitude  float64 // +Inf, like Longitude, when there's no location to filter around
+	Longitude float64
+	Distance  int // meters, the default when negative
+	Limit     int
+	Offset    int
+	Sort      string // "new" or "top"
+	Time      string // "today", "week", "month" or "all"
+	Tag       string // normalized hashtag the posts must have, any when empty
+	BBox      []Box  // viewport the posts must lie in, from ParseBBox; replaces the radius when set
+}
+
+// GetPosts retrieves posts with optional filtering and pagination, as a signed out viewer at the
+// requested location
 func (db *DBInterface) GetPosts(reqLatitude float64, reqLongitude float64, distance int,
 	limit int, offset int, sortOrder string, timeFilter string) ([]map[string]interface{}, error) {
-	if distance < 0 {
-		distance = 25000 // Default distance if not provided or invalid
-	}
+	return db.GetPostsAs(ViewerAt(0, reqLatitude, reqLongitude), PostFilter{
+		Latitude: reqLatitude, Longitude: reqLongitude, Distance: distance,
+		Limit: limit, Offset: offset, Sort: sortOrder, Time: timeFilter,
+	})
+}
 
+// GetPostsAs is GetPosts limited to the posts viewer may see
+func (db *DBInterface) GetPostsAs(viewer Viewer, f PostFilter) ([]map[string]interface{}, error) {
 	var queryBuilder strings.Builder
-	var args []interface{}
-	paramIndex := 1 // Parameter index for SQL query placeholders
 
 	// Base query
-	queryBuilder.WriteString(`SELECT p.id, p.user_id, u.username, p.content, p.latitude, p.longitude, p.created_at, p.file_name, p.like_count
+	queryBuilder.WriteString(`SELECT ` + postColumns + `
 							  FROM posts p
 							  JOIN users u ON p.user_id = u.id`)
 
 	// WHERE clauses
-	whereClauses := []string{}
-
-	// Location filter
-	if !(math.IsInf(reqLatitude, 1) || math.IsInf(reqLongitude, 1)) {
-		whereClauses = append(whereClauses, fmt.Sprintf(`( 6371000 * acos(
-							cos(radians($%d)) * cos(radians(p.latitude)) *
-							cos(radians(p.longitude) - radians($%d)) +
-							sin(radians($%d)) * sin(radians(p.latitude))
-						) ) < $%d`, paramIndex, paramIndex+1, paramIndex, paramIndex+2))
-		args = append(args, reqLatitude, reqLongitude, distance)
-		paramIndex += 3
-	}
-
-	// Time filter
-	now := time.Now()
-	switch timeFilter {
-	case "today":
-		whereClauses = append(whereClauses, fmt.Sprintf("p.created_at >= DATE_TRUNC('day', $%d::timestamp)", paramIndex))
-		args = append(args, now)
-		paramIndex++
-	case "week":
-		whereClauses = append(whereClauses, fmt.Sprintf("p.created_at >= DATE_TRUNC('week', $%d::timestamp)", paramIndex))
-		args = append(args, now)
-		paramIndex++
-	case "month":
-		whereClauses = append(whereClauses, fmt.Sprintf("p.created_at >= DATE_TRUNC('month', $%d::timestamp)", paramIndex))
-		args = append(args, now)
-		paramIndex++
-		// "all" is default, no time clause needed
-	}
-
-	if len(whereClauses) > 0 {
-		queryBuilder.WriteString(" WHERE ")
-		queryBuilder.WriteString(strings.Join(whereClauses, " AND "))
-	}
+	whereClauses, args := feedConditions(viewer, f)
+	paramIndex := len(args) + 1 // Parameter index for SQL query placeholders
+	queryBuilder.WriteString(" WHERE ")
+	queryBuilder.WriteString(strings.Join(whereClauses, " AND "))
 
 	// ORDER BY clause
-	queryBuilder.WriteString(" ORDER BY ")
-	switch sortOrder {
-	case "top":
-		queryBuilder.WriteString("p.like_count DESC, p.created_at DESC")
-	// case "hot": // Placeholder for future hot sort implementation
-	// 	 queryBuilder.WriteString("...")
-	case "new":
-		fallthrough // Explicit fallthrough for clarity
-	default: // Default to new
-		queryBuilder.WriteString("p.created_at DESC")
-	}
+	queryBuilder.WriteString(" ORDER BY " + feedOrder(f.Sort))
 
 	// Pagination clause
 	queryBuilder.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", paramIndex, paramIndex+1))
-	args = append(args, limit, offset)
+	args = append(args, f.Limit, f.Offset)
 
 	finalQuery := queryBuilder.String()
 	// log.Printf("Executing query: %s with args: %v", finalQuery, args)
@@ -237,48 +442,116 @@ func (db *DBInterface) GetPosts(reqLatitude float64, reqLongitude float64, dista
 
 	var posts []map[string]interface{}
 	for rows.Next() {
-		var postID int
-		var userID int
-		var username, content, filename string
-		var latitude, longitude float64
-		var createdAt time.Time
-		var likeCount int
-
-		if err := rows.Scan(&postID, &userID, &username, &content, &latitude, &longitude, &createdAt, &filename, &likeCount); err != nil {
+		post, err := scanPost(rows)
+		if err != nil {
 			log.Printf("Error scanning post row: %v", err)
 			continue
 		}
-
-		posts = append(posts, map[string]interface{}{
-			"post_id":    postID,
-			"user_id":    userID,
-			"username":   username,
-			"content":    content,
-			"latitude":   latitude,
-			"longitude":  longitude,
-			"created_at": createdAt.Format(time.RFC3339),
-			"file_name":  filename,
-			"like_count": likeCount,
-		})
+		posts = append(posts, post)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating post results: %w", err)
 	}
+	if err := db.completePosts(posts, viewer); err != nil {
+		return nil, err
+	}
 
 	return posts, nil
 }
 
-// GetUserPosts gets profile info and all posts from a specific user
+// feedConditions returns the WHERE conditions for the posts matching f that viewer may see,
+// with their arguments, for the feed and anything else built on it. The viewer's ID is $1.
+func feedConditions(viewer Viewer, f PostFilter) ([]string, []interface{}) {
+	reqLatitude, reqLongitude, distance := f.Latitude, f.Longitude, f.Distance
+	if distance < 0 {
+		distance = 25000 // Default distance if not provided or invalid
+	}
+
+	visible, args := viewer.visibleClause(nil)
+	paramIndex := len(args) + 1
+	whereClauses := []string{postLiveClause, postPublishedClause, visible}
+
+	// Location filter. A viewport is matched against where posts are shown, so shrinking it
+	// can't place a post more precisely than its author allows; the spatial index narrows it
+	// down first on the true location, widened by as far as snapping moves a point. For a
+	// radius the boxes narrow it down before the exact distance is computed.
+	if f.BBox != nil {
+		var prefilter []Box
+		for _, b := range f.BBox {
+			prefilter = append(prefilter, shownLocationBoxes(b)...)
+		}
+		var inBoxes, shownIn string
+		inBoxes, args = boxesClause(prefilter, args)
+		shownIn, args = shownInBoxesClause(1, f.BBox, args)
+		whereClauses = append(whereClauses, inBoxes, shownIn)
+		paramIndex = len(args) + 1
+	} else if !(math.IsInf(reqLatitude, 1) || math.IsInf(reqLongitude, 1)) {
+		if boxes := RadiusBoxes(reqLatitude, reqLongitude, float64(distance)); boxes != nil {
+			var inBoxes string
+			inBoxes, args = boxesClause(boxes, args)
+			whereClauses = append(whereClauses, inBoxes)
+			paramIndex = len(args) + 1
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf(`%s < $%d`, distanceSQL(paramIndex, paramIndex+1), paramIndex+2))
+		args = append(args, reqLatitude, reqLongitude, distance)
+		paramIndex += 3
+	}
+
+	// Tag filter
+	if f.Tag != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("EXISTS (SELECT 1 FROM post_tags t WHERE t.post_id = p.id AND t.tag = $%d)", paramIndex))
+		args = append(args, f.Tag)
+		paramIndex++
+	}
+
+	// Time filter
+	now := time.Now()
+	switch f.Time {
+	case "today":
+		whereClauses = append(whereClauses, fmt.Sprintf("p.created_at >= DATE_TRUNC('day', $%d::timestamp)", paramIndex))
+		args = append(args, now)
+	case "week":
+		whereClauses = append(whereClauses, fmt.Sprintf("p.created_at >= DATE_TRUNC('week', $%d::timestamp)", paramIndex))
+		args = append(args, now)
+	case "month":
+		whereClauses = append(whereClauses, fmt.Sprintf("p.created_at >= DATE_TRUNC('month', $%d::timestamp)", paramIndex))
+		args = append(args, now)
+		// "all" is default, no time clause needed
+	}
+
+	return whereClauses, args
+}
+
+// feedOrder returns the ORDER BY terms for a feed sort
+func feedOrder(sort string) string {
+	switch sort {
+	case "top":
+		return "p.like_count DESC, p.created_at DESC"
+	// case "hot": // Placeholder for future hot sort implementation
+	// 	 return "..."
+	case "new":
+		fallthrough // Explicit fallthrough for clarity
+	default: // Default to new
+		return "p.created_at DESC"
+	}
+}
+
+// GetUserPosts gets profile info and all public posts from a specific user
 func (db *DBInterface) GetUserPosts(userId int) (UserProfile, []map[string]interface{}, error) {
+	return db.GetUserPostsAs(userId, Viewer{})
+}
+
+// GetUserPostsAs is GetUserPosts limited to the posts viewer may see
+func (db *DBInterface) GetUserPostsAs(userId int, viewer Viewer) (UserProfile, []map[string]interface{}, error) {
 	var userProfile UserProfile
 	var posts []map[string]interface{}
 
 	// 1. Get User Profile Info
 	var createdAt time.Time
 	err := db.pool.QueryRow(context.Background(),
-		"SELECT id, username, created_at FROM users WHERE id = $1", userId).Scan(
-		&userProfile.UserID, &userProfile.Username, &createdAt)
+		"SELECT id, username, created_at, role FROM users WHERE id = $1", userId).Scan(
+		&userProfile.UserID, &userProfile.Username, &createdAt, &userProfile.Role)
 	if err != nil {
 		log.Printf("Failed to get user profile for ID %d: %v", userId, err)
 		return userProfile, posts, fmt.Errorf("user not found: %w", err)
@@ -286,14 +559,15 @@ func (db *DBInterface) GetUserPosts(userId int) (UserProfile, []map[string]inter
 	userProfile.CreatedAt = createdAt.Format(time.RFC3339)
 
 	// 2. Get User Posts
+	visible, args := viewer.visibleClause([]interface{}{userId})
 	query := `
-		SELECT p.id, p.user_id, u.username, p.content, p.latitude, p.longitude, p.created_at, p.file_name, p.like_count
+		SELECT ` + postColumns + `
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		WHERE p.user_id = $1
+		WHERE p.user_id = $1 AND ` + postLiveClause + ` AND ` + postPublishedClause + ` AND ` + visible + `
 		ORDER BY p.created_at DESC`
 
-	rows, err := db.pool.Query(context.Background(), query, userId)
+	rows, err := db.pool.Query(context.Background(), query, args...)
 	if err != nil {
 		log.Printf("Failed to get posts for user ID %d: %v", userId, err)
 		return userProfile, posts, fmt.Errorf("failed to retrieve posts for user ID %d: %w", userId, err)
@@ -301,79 +575,49 @@ func (db *DBInterface) GetUserPosts(userId int) (UserProfile, []map[string]inter
 	defer rows.Close()
 
 	for rows.Next() {
-		var postID int
-		var postUserID int // Renamed to avoid conflict with outer userId
-		var username, content, filename string
-		var latitude, longitude float64
-		var postCreatedAt time.Time // Renamed for clarity
-		var likeCount int
-
-		if err := rows.Scan(&postID, &postUserID, &username, &content, &latitude, &longitude, &postCreatedAt, &filename, &likeCount); err != nil {
+		post, err := scanPost(rows)
+		if err != nil {
 			log.Printf("Error scanning post row for user ID %d: %v", userId, err)
 			continue
 		}
-		posts = append(posts, map[string]interface{}{
-			"post_id":    postID,
-			"user_id":    postUserID, // Use the scanned user ID
-			"username":   username,   // Use the scanned username
-			"content":    content,
-			"latitude":   latitude,
-			"longitude":  longitude,
-			"created_at": postCreatedAt.Format(time.RFC3339), // Use the scanned time
-			"file_name":  filename,
-			"like_count": likeCount,
-		})
+		posts = append(posts, post)
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Printf("Error iterating through post rows for user ID %d: %v", userId, err)
 		return userProfile, posts, fmt.Errorf("error processing posts for user ID %d: %w", userId, err)
 	}
+	if err := db.completePosts(posts, viewer); err != nil {
+		return userProfile, posts, err
+	}
 
 	return userProfile, posts, nil
 }
 
-// GetPostById gets a post by ID
+// GetPostById gets a public post by ID
 func (db *DBInterface) GetPostById(postId int) (map[string]interface{}, error) {
 	var post map[string]interface{}
 	// Updated Query: Join posts and users tables, select specific columns including username
+	visible, args := Viewer{}.visibleClause([]interface{}{postId})
 	query := `
-		SELECT p.id, p.user_id, u.username, p.content, p.latitude, p.longitude, p.created_at, p.file_name, p.like_count
+		SELECT ` + postColumns + `
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		WHERE p.id = $1`
+		WHERE p.id = $1 AND ` + postLiveClause + ` AND ` + postPublishedClause + ` AND ` + visible
 
-	rows, err := db.pool.Query(context.Background(), query, postId)
+	rows, err := db.pool.Query(context.Background(), query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query post with ID %d: %w", postId, err)
 	}
 	defer rows.Close()
 
 	if rows.Next() {
-		var postID int
-		var userID int
-		var username, content, filename string
-		var latitude, longitude float64
-		var createdAt time.Time
-		var likeCount int
-
 		// Scan
-		if err := rows.Scan(&postID, &userID, &username, &content, &latitude, &longitude, &createdAt, &filename, &likeCount); err != nil {
+		post, err = scanPost(rows)
+		if err != nil {
 			log.Printf("Error scanning post row for ID %d: %v", postId, err)
 			return nil, fmt.Errorf("failed to scan post data for ID %d: %w", postId, err)
 		}
-
-		post = map[string]interface{}{
-			"post_id":    postID,
-			"user_id":    userID,
-			"username":   username,
-			"content":    content,
-			"latitude":   latitude,
-			"longitude":  longitude,
-			"created_at": createdAt.Format(time.RFC3339),
-			"file_name":  filename,
-			"like_count": likeCount,
-		}
 	} else {
 		if err := rows.Err(); err != nil {
 			log.Printf("Error iterating rows for post ID %d: %v", postId, err)
@@ -391,6 +635,9 @@ func (db *DBInterface) GetPostById(postId int) (map[string]interface{}, error) {
 		log.Printf("Error after iterating rows for post ID %d: %v", postId, err)
 		return nil, fmt.Errorf("error completing retrieval for post ID %d: %w", postId, err)
 	}
+	if err := db.completePosts([]map[string]interface{}{post}, Viewer{}); err != nil {
+		return nil, err
+	}
 
 	return post, nil
 }
@@ -435,30 +682,31 @@ func (db *DBInterface) GetMessages(senderID, receiverID int) ([]map[string]inter
 
 // helper function to get last postId from userId
 func (db *DBInterface) GetLastPostByUser(userId int) (int, error) {
-	row, err := db.pool.Query(context.Background(), "SELECT * FROM posts WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1", userId)
-	if err != nil {
-		return -1, fmt.Errorf("failed to get last user post from ID %d: %w", userId, err)
-	}
 	var pId int = -1
-	for row.Next() {
-		var postID int
-		var userID int
-		var content, filename string
-		var latitude, longitude float64
-		var createdAt time.Time
-		var likeCount int
-		if err := row.Scan(&postID, &userID, &content, &latitude, &longitude, &createdAt, &filename, &likeCount); err != nil {
-			log.Printf("Error scanning post row: %v", err)
-			return -1, err
-		}
-		pId = postID
+	err := db.pool.QueryRow(context.Background(),
+		"SELECT id FROM posts WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1", userId).Scan(&pId)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return -1, fmt.Errorf("failed to get last user post from ID %d: %w", userId, err)
 	}
 	return pId, nil
 }
 
+// GetPostOwner returns the ID of the user who created a post
+func (db *DBInterface) GetPostOwner(postID int) (int, error) {
+	var userID int
+	err := db.pool.QueryRow(context.Background(), "SELECT user_id FROM posts WHERE id = $1", postID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("post ID %d: %w", postID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get owner of post ID %d: %w", postID, err)
+	}
+	return userID, nil
+}
+
 // DeletePost removes a post by ID
 func (db *DBInterface) DeletePost(postID int) error {
-	_, err := db.pool.Exec(context.Background(), "DELETE FROM posts WHERE id=$1", postID)
+	_, err := db.pool.Exec(context.Background(), uncountReposts("DELETE FROM posts WHERE id=$1", "id"), postID)
 	if err != nil {
 		return fmt.Errorf("failed to delete post ID %d: %w", postID, err)
 	}
@@ -579,6 +827,7 @@ type Comment struct {
 	UserID    int        `json:"user_id"`
 	Username  string     `json:"username"`
 	Content   string     `json:"content"`
+	Entities  []Entity   `json:"entities"`
 	CreatedAt string     `json:"created_at"`
 	Replies   []*Comment `json:"replies,omitempty"`
 	ParentID  *int       `json:"parent_id,omitempty"`
@@ -618,7 +867,17 @@ func (db *DBInterface) GetNestedComments(postID int) ([]*Comment, error) {
 		return nil, err
 	}
 
+	contents := make(map[int]string, len(commentMap))
+	for id, comment := range commentMap {
+		contents[id] = comment.Content
+	}
+	entities, err := db.loadEntities("comment", contents)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, comment := range commentMap {
+		comment.Entities = entities[comment.ID]
 		if comment.ParentID != nil {
 			parent := commentMap[*comment.ParentID]
 			parent.Replies = append(parent.Replies, comment)
@@ -632,12 +891,45 @@ func (db *DBInterface) GetNestedComments(postID int) ([]*Comment, error) {
 
 // CreateNestedComment creates a comment on a post with support for replies
 func (db *DBInterface) CreateNestedComment(postID, userID int, parentID *int, content string) error {
-	_, err := db.pool.Exec(context.Background(),
-		"INSERT INTO comments (post_id, user_id, parent_id, content) VALUES ($1, $2, $3, $4)",
-		postID, userID, parentID, content)
-	return err
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var commentID int
+	err = tx.QueryRow(ctx,
+		"INSERT INTO comments (post_id, user_id, parent_id, content) VALUES ($1, $2, $3, $4) RETURNING id",
+		postID, userID, parentID, content).Scan(&commentID)
+	if err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+	if err := indexEntities(ctx, tx, "comment", commentID, content); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
+// GetCommentOwner returns the ID of the user who wrote a comment
+func (db *DBInterface) GetCommentOwner(commentID int) (int, error) {
+	var userID int
+	err := db.pool.QueryRow(context.Background(), "SELECT user_id FROM comments WHERE id = $1", commentID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("comment ID %d: %w", commentID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get owner of comment ID %d: %w", commentID, err)
+	}
+	return userID, nil
 }
 
+// DeleteComment removes a comment, replies go with it through ON DELETE CASCADE
 func (db *DBInterface) DeleteComment(commentID int) error {
 	_, err := db.pool.Exec(context.Background(),
 		"DELETE FROM comments WHERE id=$1", commentID)
@@ -648,7 +940,7 @@ func (db *DBInterface) DeleteComment(commentID int) error {
 func (db *DBInterface) SearchUsers(query string, limit int) ([]UserProfile, error) {
 	var users []UserProfile
 	sqlQuery := `
-		SELECT id, username, created_at 
+		SELECT id, username, created_at, role
 		FROM users 
 		WHERE username ILIKE $1 
 		ORDER BY username ASC 
@@ -663,7 +955,7 @@ func (db *DBInterface) SearchUsers(query string, limit int) ([]UserProfile, erro
 	for rows.Next() {
 		var user UserProfile
 		var createdAt time.Time
-		if err := rows.Scan(&user.UserID, &user.Username, &createdAt); err != nil {
+		if err := rows.Scan(&user.UserID, &user.Username, &createdAt, &user.Role); err != nil {
 			log.Printf("Error scanning user row during search: %v", err)
 			continue
 		}
@@ -678,52 +970,44 @@ func (db *DBInterface) SearchUsers(query string, limit int) ([]UserProfile, erro
 	return users, nil
 }
 
-// SearchPosts finds posts by content (case-insensitive)
+// SearchPosts finds public posts by content (case-insensitive)
 func (db *DBInterface) SearchPosts(query string, limit int) ([]map[string]interface{}, error) {
+	return db.SearchPostsAs(query, limit, Viewer{})
+}
+
+// SearchPostsAs is SearchPosts limited to the posts viewer may see
+func (db *DBInterface) SearchPostsAs(query string, limit int, viewer Viewer) ([]map[string]interface{}, error) {
 	var posts []map[string]interface{}
+	visible, args := viewer.visibleClause([]interface{}{"%" + query + "%", limit})
 	sqlQuery := `
-		SELECT p.id, p.user_id, u.username, p.content, p.latitude, p.longitude, p.created_at, p.file_name, p.like_count
+		SELECT ` + postColumns + `
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		WHERE p.content ILIKE $1
+		WHERE p.content ILIKE $1 AND ` + postLiveClause + ` AND ` + postPublishedClause + ` AND ` + visible + `
 		ORDER BY p.created_at DESC
 		LIMIT $2`
 
-	rows, err := db.pool.Query(context.Background(), sqlQuery, "%"+query+"%", limit)
+	rows, err := db.pool.Query(context.Background(), sqlQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search posts: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var postID int
-		var userID int
-		var username, content, filename string
-		var latitude, longitude float64
-		var createdAt time.Time
-		var likeCount int
-
-		if err := rows.Scan(&postID, &userID, &username, &content, &latitude, &longitude, &createdAt, &filename, &likeCount); err != nil {
+		post, err := scanPost(rows)
+		if err != nil {
 			log.Printf("Error scanning post row during search: %v", err)
 			continue
 		}
-
-		posts = append(posts, map[string]interface{}{
-			"post_id":    postID,
-			"user_id":    userID,
-			"username":   username,
-			"content":    content,
-			"latitude":   latitude,
-			"longitude":  longitude,
-			"created_at": createdAt.Format(time.RFC3339),
-			"file_name":  filename,
-			"like_count": likeCount,
-		})
+		posts = append(posts, post)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating post search results: %w", err)
 	}
+	if err := db.completePosts(posts, viewer); err != nil {
+		return nil, err
+	}
 
 	return posts, nil
 }
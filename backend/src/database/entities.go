@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Entity types found in post and comment content
+const (
+	EntityHashtag = "hashtag"
+	EntityMention = "mention"
+)
+
+// MaxTagLength is the longest hashtag that's indexed, in characters
+const MaxTagLength = 100
+
+// ErrInvalidTag is returned when a tag can't be a hashtag
+var ErrInvalidTag = errors.New("invalid tag")
+
+// Entity is a hashtag or mention in a piece of content. Start and End are offsets in UTF-16
+// code units, the way JavaScript indexes strings, End exclusive, covering the leading # or @.
+type Entity struct {
+	Type     string `json:"type"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Tag      string `json:"tag,omitempty"`      // hashtags, lower-cased without the #
+	UserID   int    `json:"user_id,omitempty"`  // mentions
+	Username string `json:"username,omitempty"` // mentions, the user's current name
+}
+
+// isTagRune reports whether r can be part of a hashtag
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isUsernameRune reports whether r can be part of a username, see ValidateUsername
+func isUsernameRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.'
+}
+
+// ParseEntities finds the hashtags and @mentions in content, in order. A # or @ only starts one
+// at the beginning of the text or after a character that can't be part of a word, so e-mail
+// addresses and URL fragments are skipped. Hashtags need a letter and are lower-cased,
+// mentions keep their case and drop a trailing full stop. Mentions are returned with the name
+// as written in Username and no UserID.
+func ParseEntities(content string) []Entity {
+	runes := []rune(content)
+	// offsets[i] is where runes[i] starts in UTF-16 code units, characters outside the Basic
+	// Multilingual Plane such as most emoji take two
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + utf16.RuneLen(r)
+	}
+	entities := []Entity{}
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' && runes[i] != '@' {
+			continue
+		}
+		if i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '#' || runes[i-1] == '@' || runes[i-1] == '.') {
+			continue
+		}
+
+		end := i + 1
+		if runes[i] == '#' {
+			hasLetter := false
+			for end < len(runes) && isTagRune(runes[end]) {
+				hasLetter = hasLetter || unicode.IsLetter(runes[end])
+				end++
+			}
+			if hasLetter && end-i-1 <= MaxTagLength {
+				entities = append(entities, Entity{Type: EntityHashtag, Start: offsets[i], End: offsets[end], Tag: strings.ToLower(string(runes[i+1 : end]))})
+			}
+		} else {
+			for end < len(runes) && isUsernameRune(runes[end]) {
+				end++
+			}
+			for end > i+1 && runes[end-1] == '.' {
+				end--
+			}
+			if name := string(runes[i+1 : end]); ValidateUsername(name) == nil {
+				entities = append(entities, Entity{Type: EntityMention, Start: offsets[i], End: offsets[end], Username: name})
+			}
+		}
+		i = end - 1
+	}
+	return entities
+}
+
+// NormalizeTag turns a tag from a URL into the form it's indexed under
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.TrimPrefix(tag, "#")
+	entities := ParseEntities("#" + tag)
+	if len(entities) != 1 || entities[0].End != len(utf16.Encode([]rune(tag)))+1 {
+		return "", ErrInvalidTag
+	}
+	return entities[0].Tag, nil
+}
+
+// indexEntities replaces the hashtags and mentions indexed for a post or comment with the ones
+// in content. kind is "post" or "comment" and picks the <kind>_tags and <kind>_mentions tables.
+// Mentions of names nobody has are left out.
+func indexEntities(ctx context.Context, tx pgx.Tx, kind string, id int, content string) error {
+	tags, mentions := kind+"_tags", kind+"_mentions"
+	idColumn := kind + "_id"
+
+	for _, table := range []string{tags, mentions} {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE "+idColumn+" = $1", id); err != nil {
+			return fmt.Errorf("failed to clear %s of %s ID %d: %w", table, kind, id, err)
+		}
+	}
+
+	entities := ParseEntities(content)
+	names := []string{}
+	seenTag := map[string]bool{}
+	for _, e := range entities {
+		if e.Type == EntityMention {
+			names = append(names, e.Username)
+			continue
+		}
+		if seenTag[e.Tag] {
+			continue
+		}
+		seenTag[e.Tag] = true
+		if _, err := tx.Exec(ctx, "INSERT INTO "+tags+" ("+idColumn+", tag) VALUES ($1, $2)", id, e.Tag); err != nil {
+			return fmt.Errorf("failed to index tag of %s ID %d: %w", kind, id, err)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	userIDs := map[string]int{}
+	rows, err := tx.Query(ctx, "SELECT id, username FROM users WHERE username = ANY($1)", names)
+	if err != nil {
+		return fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+	for rows.Next() {
+		var userID int
+		var username string
+		if err := rows.Scan(&userID, &username); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan mentioned user: %w", err)
+		}
+		userIDs[username] = userID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating mentioned users: %w", err)
+	}
+
+	for _, e := range entities {
+		userID, ok := userIDs[e.Username]
+		if e.Type != EntityMention || !ok {
+			continue
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO "+mentions+" ("+idColumn+", user_id, start_offset, end_offset) VALUES ($1, $2, $3, $4)",
+			id, userID, e.Start, e.End)
+		if err != nil {
+			return fmt.Errorf("failed to index mention of %s ID %d: %w", kind, id, err)
+		}
+	}
+	return nil
+}
+
+// loadEntities returns the entities of posts or comments by ID. Hashtags come from the content,
+// mentions from the index, so they name the user as they're called now.
+func (db *DBInterface) loadEntities(kind string, contents map[int]string) (map[int][]Entity, error) {
+	result := map[int][]Entity{}
+	if len(contents) == 0 {
+		return result, nil
+	}
+	ids := make([]int, 0, len(contents))
+	for id := range contents {
+		ids = append(ids, id)
+	}
+
+	mentions := map[int][]Entity{}
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT m.`+kind+`_id, m.user_id, u.username, m.start_offset, m.end_offset
+		FROM `+kind+`_mentions m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.`+kind+`_id = ANY($1)
+		ORDER BY m.start_offset`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		e := Entity{Type: EntityMention}
+		if err := rows.Scan(&id, &e.UserID, &e.Username, &e.Start, &e.End); err != nil {
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		mentions[id] = append(mentions[id], e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mentions: %w", err)
+	}
+
+	// merge both kinds back into the order they appear in
+	for id, content := range contents {
+		entities := []Entity{}
+		m := mentions[id]
+		for _, e := range ParseEntities(content) {
+			if e.Type != EntityHashtag {
+				continue
+			}
+			for len(m) > 0 && m[0].Start < e.Start {
+				entities, m = append(entities, m[0]), m[1:]
+			}
+			entities = append(entities, e)
+		}
+		result[id] = append(entities, m...)
+	}
+	return result, nil
+}
+
+// attachEntities sets the "entities" of each post
+func (db *DBInterface) attachEntities(posts []map[string]interface{}) error {
+	contents := map[int]string{}
+	for _, post := range posts {
+		id, _ := post["post_id"].(int)
+		contents[id], _ = post["content"].(string)
+	}
+	entities, err := db.loadEntities("post", contents)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		id, _ := post["post_id"].(int)
+		post["entities"] = entities[id]
+	}
+	return nil
+}
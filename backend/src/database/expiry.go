@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// postLiveClause keeps expired posts out of reads until the reaper deletes them
+const postLiveClause = `(p.expires_at IS NULL OR p.expires_at > NOW())`
+
+// ReapExpiredPosts deletes up to batchSize expired posts and returns them so their files can be
+// removed. Rows another instance is already deleting are skipped rather than waited on, so
+// several reapers can run at once without blocking each other or reaping a post twice.
+func (db *DBInterface) ReapExpiredPosts(batchSize int) ([]PostFile, error) {
+	rows, err := db.pool.Query(context.Background(), uncountReposts(`
+		DELETE FROM posts WHERE id IN (
+			SELECT id FROM posts
+			WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+			ORDER BY expires_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)`, "id, user_id, file_name"), batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reap expired posts: %w", err)
+	}
+	defer rows.Close()
+
+	reaped := []PostFile{}
+	for rows.Next() {
+		var f PostFile
+		if err := rows.Scan(&f.PostID, &f.UserID, &f.FileName); err != nil {
+			return nil, fmt.Errorf("failed to scan reaped post: %w", err)
+		}
+		reaped = append(reaped, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reaped posts: %w", err)
+	}
+	return reaped, nil
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Data export statuses
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// DataExport is one request for a copy of a user's data
+type DataExport struct {
+	ID          int     `json:"export_id"`
+	UserID      int     `json:"user_id"`
+	Status      string  `json:"status"`
+	SizeBytes   int64   `json:"size_bytes"`
+	Error       string  `json:"error,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	CompletedAt *string `json:"completed_at"`
+	ExpiresAt   *string `json:"expires_at"`
+	FilePath    string  `json:"-"`
+}
+
+// dataExportColumns is the select list scanned by scanDataExport
+const dataExportColumns = `id, user_id, status, size_bytes, COALESCE(error, ''), created_at, completed_at, expires_at, COALESCE(file_path, '')`
+
+// scanDataExport reads a row selected with dataExportColumns
+func scanDataExport(row pgx.Row) (DataExport, error) {
+	var e DataExport
+	var createdAt time.Time
+	var completedAt, expiresAt *time.Time
+	if err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.SizeBytes, &e.Error, &createdAt, &completedAt, &expiresAt, &e.FilePath); err != nil {
+		return e, err
+	}
+	e.CreatedAt = createdAt.Format(time.RFC3339)
+	if completedAt != nil {
+		s := completedAt.Format(time.RFC3339)
+		e.CompletedAt = &s
+	}
+	if expiresAt != nil {
+		s := expiresAt.Format(time.RFC3339)
+		e.ExpiresAt = &s
+	}
+	return e, nil
+}
+
+// CreateDataExport queues an export for a user. If one is already queued or running it is
+// returned instead, along with false.
+func (db *DBInterface) CreateDataExport(userID int) (DataExport, bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return DataExport{}, false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// serialize requests from the same user so two clicks don't start two jobs
+	if _, err := tx.Exec(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return DataExport{}, false, fmt.Errorf("failed to lock user ID %d: %w", userID, err)
+	}
+
+	existing, err := scanDataExport(tx.QueryRow(ctx,
+		"SELECT "+dataExportColumns+" FROM data_exports WHERE user_id = $1 AND status IN ($2, $3)",
+		userID, ExportPending, ExportRunning))
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return DataExport{}, false, fmt.Errorf("failed to look up exports: %w", err)
+	}
+
+	created, err := scanDataExport(tx.QueryRow(ctx,
+		"INSERT INTO data_exports (user_id, status) VALUES ($1, $2) RETURNING "+dataExportColumns,
+		userID, ExportPending))
+	if err != nil {
+		return DataExport{}, false, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return DataExport{}, false, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return created, true, nil
+}
+
+// GetDataExport returns one of a user's exports
+func (db *DBInterface) GetDataExport(userID, exportID int) (DataExport, error) {
+	e, err := scanDataExport(db.pool.QueryRow(context.Background(),
+		"SELECT "+dataExportColumns+" FROM data_exports WHERE id = $1 AND user_id = $2", exportID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e, fmt.Errorf("export ID %d: %w", exportID, ErrNotFound)
+	}
+	if err != nil {
+		return e, fmt.Errorf("failed to look up export ID %d: %w", exportID, err)
+	}
+	return e, nil
+}
+
+// ListDataExports returns a user's exports, newest first
+func (db *DBInterface) ListDataExports(userID int) ([]DataExport, error) {
+	rows, err := db.pool.Query(context.Background(),
+		"SELECT "+dataExportColumns+" FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan export: %w", err)
+		}
+		exports = append(exports, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exports: %w", err)
+	}
+	return exports, nil
+}
+
+// StartDataExport moves a pending export to running, returning false if it was already picked up
+func (db *DBInterface) StartDataExport(exportID int) (bool, error) {
+	tag, err := db.pool.Exec(context.Background(),
+		"UPDATE data_exports SET status = $2 WHERE id = $1 AND status = $3", exportID, ExportRunning, ExportPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to start export ID %d: %w", exportID, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CompleteDataExport records a finished archive
+func (db *DBInterface) CompleteDataExport(exportID int, filePath string, sizeBytes int64, expiresAt time.Time) error {
+	_, err := db.pool.Exec(context.Background(), `
+		UPDATE data_exports
+		SET status = $2, file_path = $3, size_bytes = $4, completed_at = NOW(), expires_at = $5
+		WHERE id = $1`, exportID, ExportReady, filePath, sizeBytes, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to complete export ID %d: %w", exportID, err)
+	}
+	return nil
+}
+
+// FailDataExport records why an export couldn't be built
+func (db *DBInterface) FailDataExport(exportID int, reason string) error {
+	_, err := db.pool.Exec(context.Background(),
+		"UPDATE data_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1",
+		exportID, ExportFailed, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark export ID %d failed: %w", exportID, err)
+	}
+	return nil
+}
+
+// ExpireDataExports marks ready exports past their expiry as expired, and exports stuck in
+// pending or running for longer than staleAfter as failed. Returns the exports it changed, with
+// the archive path they had before, so their files can be deleted.
+func (db *DBInterface) ExpireDataExports(staleAfter time.Duration) ([]DataExport, error) {
+	ctx := context.Background()
+	changed := []DataExport{}
+	// collect reads the exports a statement returned as id, user_id, status, file_path
+	collect := func(rows pgx.Rows) error {
+		defer rows.Close()
+		for rows.Next() {
+			var e DataExport
+			if err := rows.Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath); err != nil {
+				return fmt.Errorf("failed to scan export: %w", err)
+			}
+			changed = append(changed, e)
+		}
+		return rows.Err()
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		UPDATE data_exports SET status = $1, error = 'export was interrupted', completed_at = NOW()
+		WHERE status IN ($2, $3) AND created_at < $4
+		RETURNING id, user_id, status, COALESCE(file_path, '')`,
+		ExportFailed, ExportPending, ExportRunning, time.Now().Add(-staleAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail stale exports: %w", err)
+	}
+	if err := collect(rows); err != nil {
+		return nil, err
+	}
+
+	// RETURNING sees the row after the update, so the path is read before it's cleared
+	rows, err = db.pool.Query(ctx, `
+		WITH old AS (
+			SELECT id, file_path FROM data_exports
+			WHERE status = $2 AND expires_at < NOW()
+			FOR UPDATE
+		)
+		UPDATE data_exports d SET status = $1, file_path = NULL
+		FROM old WHERE d.id = old.id
+		RETURNING d.id, d.user_id, d.status, COALESCE(old.file_path, '')`, ExportExpired, ExportReady)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire exports: %w", err)
+	}
+	if err := collect(rows); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// GetUserComments returns every comment a user wrote, oldest first
+func (db *DBInterface) GetUserComments(userID int) ([]map[string]interface{}, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT id, post_id, parent_id, content, created_at
+		FROM comments WHERE user_id = $1
+		ORDER BY created_at ASC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments for user ID %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	comments := []map[string]interface{}{}
+	for rows.Next() {
+		var id, postID int
+		var parentID *int
+		var content string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &postID, &parentID, &content, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, map[string]interface{}{
+			"comment_id": id,
+			"post_id":    postID,
+			"parent_id":  parentID,
+			"content":    content,
+			"created_at": createdAt.Format(time.RFC3339),
+		})
+	}
+	return comments, rows.Err()
+}
+
+// GetUserLikes returns the posts a user liked along with each post's author
+func (db *DBInterface) GetUserLikes(userID int) ([]map[string]interface{}, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT pl.post_id, u.username
+		FROM post_likes pl
+		JOIN posts p ON pl.post_id = p.id
+		JOIN users u ON p.user_id = u.id
+		WHERE pl.user_id = $1
+		ORDER BY pl.post_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get likes for user ID %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	likes := []map[string]interface{}{}
+	for rows.Next() {
+		var postID int
+		var author string
+		if err := rows.Scan(&postID, &author); err != nil {
+			return nil, fmt.Errorf("failed to scan like: %w", err)
+		}
+		likes = append(likes, map[string]interface{}{"post_id": postID, "author": author})
+	}
+	return likes, rows.Err()
+}
+
+// GetConversationPartners returns everyone a user has exchanged DMs with
+func (db *DBInterface) GetConversationPartners(userID int) ([]UserProfile, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT u.id, u.username, u.created_at, u.role
+		FROM users u
+		WHERE u.id IN (
+			SELECT receiver_id FROM messages WHERE sender_id = $1
+			UNION
+			SELECT sender_id FROM messages WHERE receiver_id = $1
+		)
+		ORDER BY u.id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversations for user ID %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	partners := []UserProfile{}
+	for rows.Next() {
+		var p UserProfile
+		var createdAt time.Time
+		if err := rows.Scan(&p.UserID, &p.Username, &createdAt, &p.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation partner: %w", err)
+		}
+		p.CreatedAt = createdAt.Format(time.RFC3339)
+		partners = append(partners, p)
+	}
+	return partners, rows.Err()
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,12 @@ import (
 	"strings"
 )
 
+// MediaStoreDir is the folder under the data root holding files as <userID>/<postID>/<fileName>
+const MediaStoreDir = "users"
+
+// ErrInvalidFileName is returned for file names that are empty or contain a path
+var ErrInvalidFileName = errors.New("invalid file name")
+
 // default directory should be "../data/"
 type FileManager struct {
 	DATAROOTDIR string
@@ -68,23 +75,34 @@ func (fm FileManager) CheckDataDirValid() {
 
 }
 
-func (fm FileManager) CreateUserFolder(userName string) error {
-	var dataDirReq = filepath.Join(fm.DATAROOTDIR, userName)
+// userDir is where everything a user uploads lives, keyed by their immutable ID
+func (fm FileManager) userDir(userID int) string {
+	return filepath.Join(fm.DATAROOTDIR, MediaStoreDir, strconv.Itoa(userID))
+}
 
-	_, err := os.Stat(dataDirReq)
-	if os.IsNotExist(err) {
-		// Directory does not exist, so create it
-		//err := os.MkdirAll(dataDirReq, 0755) // not preferred alternative since we should catch a bad preplanned root directory
-		err := os.Mkdir(dataDirReq, 0755)
-		if err != nil {
-			return err
-		}
+// UserFolder returns the folder holding a user's uploads, it may not exist yet
+func (fm FileManager) UserFolder(userID int) string {
+	return fm.userDir(userID)
+}
+
+// postFilePath builds the path of a post's file, rejecting names that try to leave the post folder
+func (fm FileManager) postFilePath(userID int, postID int, fileName string) (string, error) {
+	if fileName == "" || fileName != filepath.Base(fileName) || fileName == "." || fileName == ".." {
+		return "", ErrInvalidFileName
 	}
-	return err
+	return filepath.Join(fm.userDir(userID), strconv.Itoa(postID), fileName), nil
 }
 
-func (fm FileManager) DeleteUserFolder(userName string) error {
-	var dataDirReq = filepath.Join(fm.DATAROOTDIR, userName)
+func (fm FileManager) CreateUserFolder(userID int) error {
+	// MkdirAll since the shared store folder may not exist yet, a bad root still fails
+	if _, err := os.Stat(fm.DATAROOTDIR); err != nil {
+		return err
+	}
+	return os.MkdirAll(fm.userDir(userID), 0755)
+}
+
+func (fm FileManager) DeleteUserFolder(userID int) error {
+	var dataDirReq = fm.userDir(userID)
 	var isInScope, err = IsParent(fm.DATAROOTDIR, dataDirReq)
 	if isInScope { // good request, safe to delete folder
 		err = os.RemoveAll(dataDirReq)
@@ -92,48 +110,52 @@ func (fm FileManager) DeleteUserFolder(userName string) error {
 	return err
 }
 
-func (fm FileManager) CreatePostFile(userName string, postId int, fileName string, data []byte) error {
-	fm.CreateUserFolder(userName) // create it first if it doesn't exist
-
-	var file_name string = strconv.Itoa(postId) + "_" + fileName
-	var dataDirReq = filepath.Join(fm.DATAROOTDIR, userName) // append path and user
-	dataDirReq = filepath.Join(dataDirReq, file_name)        // add the file name to write to
+func (fm FileManager) CreatePostFile(userID int, postId int, fileName string, data []byte) error {
+	dataDirReq, err := fm.postFilePath(userID, postId, fileName)
+	if err != nil {
+		return err
+	}
 
-	_, err := os.Stat(dataDirReq)
-	if os.IsNotExist(err) {
-		err = os.WriteFile(dataDirReq, data, 0644)
-		if err != nil {
-			fmt.Println(err)
-		}
-	} else {
-		// clear content of original file and overwrite it
-		err = os.Truncate(dataDirReq, 0)
-		if err == nil {
-			err = os.WriteFile(dataDirReq, data, 0644)
-		}
+	// create the user and post folders first if they don't exist
+	if err := fm.CreateUserFolder(userID); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dataDirReq), 0755); err != nil {
+		return err
 	}
-	return err
-}
 
-func (fm FileManager) GetPostFile(userName string, postId int, fileName string) ([]byte, error) {
-	var file_name string = strconv.Itoa(postId) + "_" + fileName
-	var dataDirReq = filepath.Join(fm.DATAROOTDIR, userName) // append path and user
-	dataDirReq = filepath.Join(dataDirReq, file_name)        // add the file name to write to
+	// WriteFile truncates an existing file before overwriting it
+	return os.WriteFile(dataDirReq, data, 0644)
+}
 
+func (fm FileManager) GetPostFile(userID int, postId int, fileName string) ([]byte, error) {
+	dataDirReq, err := fm.postFilePath(userID, postId, fileName)
+	if err != nil {
+		return nil, err
+	}
 	return os.ReadFile(dataDirReq)
 }
 
-func (fm FileManager) DeletePostFile(userName string, postId int, fileName string) error {
-	var file_name string = strconv.Itoa(postId) + "_" + fileName
+func (fm FileManager) DeletePostFile(userID int, postId int, fileName string) error {
+	dataDirReq, err := fm.postFilePath(userID, postId, fileName)
+	if err != nil {
+		return err
+	}
 
-	var dataDirReq = filepath.Join(fm.DATAROOTDIR, userName) // append path and user
-	//dataDirReq = filepath.Join(dataDirReq, strconv.Itoa(postId)) // append postid folder
-	dataDirReq = filepath.Join(dataDirReq, file_name) // add the file name to write to
+	isInScope, err := IsParent(fm.DATAROOTDIR, dataDirReq)
+	if isInScope { // good request, safe to delete file and the post folder once it's empty
+		err = os.Remove(dataDirReq)
+		os.Remove(filepath.Dir(dataDirReq))
+	}
+	return err
+}
 
+// DeletePostFolder removes every file uploaded for a post
+func (fm FileManager) DeletePostFolder(userID int, postID int) error {
+	var dataDirReq = filepath.Join(fm.userDir(userID), strconv.Itoa(postID))
 	var isInScope, err = IsParent(fm.DATAROOTDIR, dataDirReq)
-	if isInScope { // good request, safe to delete folder
-		err = os.Remove(dataDirReq)
-		//err = os.RemoveAll(dataDirReq)
+	if isInScope {
+		err = os.RemoveAll(dataDirReq)
 	}
 	return err
 }
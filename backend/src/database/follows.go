@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrSelfFollow is returned when a user tries to follow themselves
+var ErrSelfFollow = errors.New("users can't follow themselves")
+
+// Follow makes followerID follow followeeID, following twice is fine
+func (db *DBInterface) Follow(followerID, followeeID int) error {
+	if followerID == followeeID {
+		return ErrSelfFollow
+	}
+	if _, err := db.GetUserNameId(followeeID); errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user ID %d: %w", followeeID, ErrNotFound)
+	} else if err != nil {
+		return fmt.Errorf("failed to look up user ID %d: %w", followeeID, err)
+	}
+
+	_, err := db.pool.Exec(context.Background(), `
+		INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, followerID, followeeID)
+	if err != nil {
+		return fmt.Errorf("failed to follow user ID %d: %w", followeeID, err)
+	}
+	return nil
+}
+
+// Unfollow stops followerID following followeeID
+func (db *DBInterface) Unfollow(followerID, followeeID int) error {
+	_, err := db.pool.Exec(context.Background(),
+		"DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerID, followeeID)
+	if err != nil {
+		return fmt.Errorf("failed to unfollow user ID %d: %w", followeeID, err)
+	}
+	return nil
+}
+
+// IsFollowing reports whether followerID follows followeeID
+func (db *DBInterface) IsFollowing(followerID, followeeID int) (bool, error) {
+	var exists bool
+	err := db.pool.QueryRow(context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)",
+		followerID, followeeID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check follow: %w", err)
+	}
+	return exists, nil
+}
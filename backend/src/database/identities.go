@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidLoginState is returned for unknown, used or expired OIDC login states
+var ErrInvalidLoginState = errors.New("login state is invalid or expired")
+
+// ErrIdentityLinked is returned when an external identity already belongs to another user
+var ErrIdentityLinked = errors.New("identity is already linked to another user")
+
+// OIDCLoginState is what we remember between sending a user to a provider and their return
+type OIDCLoginState struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	LinkUserID   int // set when a logged in user is linking a new identity, 0 for a plain login
+}
+
+// Identity is an external login linked to a user
+type Identity struct {
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+// CreateOIDCLoginState stores a pending login keyed by the hash of its state parameter
+func (db *DBInterface) CreateOIDCLoginState(stateHash string, state OIDCLoginState, expiresAt time.Time) error {
+	var linkUserID interface{}
+	if state.LinkUserID != 0 {
+		linkUserID = state.LinkUserID
+	}
+
+	_, err := db.pool.Exec(context.Background(), `
+		INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		stateHash, state.Provider, state.CodeVerifier, state.Nonce, linkUserID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store login state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState returns a pending login and deletes it so the state can't be replayed
+func (db *DBInterface) ConsumeOIDCLoginState(stateHash, provider string) (OIDCLoginState, error) {
+	ctx := context.Background()
+
+	// clear out abandoned logins while we're here
+	if _, err := db.pool.Exec(ctx, "DELETE FROM oidc_login_states WHERE expires_at < NOW()"); err != nil {
+		return OIDCLoginState{}, fmt.Errorf("failed to clean up login states: %w", err)
+	}
+
+	var state OIDCLoginState
+	var linkUserID *int
+	err := db.pool.QueryRow(ctx, `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING provider, code_verifier, nonce, link_user_id`,
+		stateHash, provider).Scan(&state.Provider, &state.CodeVerifier, &state.Nonce, &linkUserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OIDCLoginState{}, ErrInvalidLoginState
+	}
+	if err != nil {
+		return OIDCLoginState{}, fmt.Errorf("failed to load login state: %w", err)
+	}
+
+	if linkUserID != nil {
+		state.LinkUserID = *linkUserID
+	}
+	return state, nil
+}
+
+// GetIdentityUser returns the user an external identity is linked to
+func (db *DBInterface) GetIdentityUser(provider, subject string) (int, error) {
+	var userID int
+	err := db.pool.QueryRow(context.Background(),
+		"SELECT user_id FROM identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("identity %s/%s: %w", provider, subject, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up identity: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkIdentity attaches an external identity to an existing user.
+// Linking an identity the user already has is a no-op.
+func (db *DBInterface) LinkIdentity(userID int, provider, subject, email string) error {
+	ctx := context.Background()
+
+	tag, err := db.pool.Exec(ctx, `
+		INSERT INTO identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO NOTHING`,
+		userID, provider, subject, nullIfEmpty(email))
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	owner, err := db.GetIdentityUser(provider, subject)
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return ErrIdentityLinked
+	}
+	return nil
+}
+
+// CreateUserWithIdentity registers a new user for an external identity and links the two.
+// The username is made unique by adding a numeric suffix when needed. The account gets a random
+// password nobody knows, a verified email is kept so a password can be set through a reset later.
+// Returns the new user ID and the username that was picked.
+func (db *DBInterface) CreateUserWithIdentity(username, provider, subject, email string, emailVerified bool) (int, string, error) {
+	ctx := context.Background()
+
+	if err := ValidateUsername(username); err != nil {
+		return 0, "", err
+	}
+
+	unusable := make([]byte, 32)
+	if _, err := rand.Read(unusable); err != nil {
+		return 0, "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(unusable)), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, "", fmt.Errorf("password hashing failed: %w", err)
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// an unverified email or one that's already on another account is not copied onto the user
+	var userEmail interface{}
+	if email != "" && emailVerified {
+		var taken bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", email).Scan(&taken); err != nil {
+			return 0, "", fmt.Errorf("failed to check email: %w", err)
+		}
+		if !taken {
+			userEmail = email
+		}
+	}
+
+	candidate := username
+	for attempt := 0; ; attempt++ {
+		var taken bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1) OR "+usernameReservedClause, candidate).Scan(&taken); err != nil {
+			return 0, "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if !taken {
+			break
+		}
+		if attempt == 10 {
+			return 0, "", fmt.Errorf("could not find a free username based on %s", username)
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to generate username: %w", err)
+		}
+		candidate = fmt.Sprintf("%s%d", username, suffix.Int64())
+	}
+
+	var userID int
+	err = tx.QueryRow(ctx,
+		"INSERT INTO users (username, password_hash, email) VALUES ($1, $2, $3) RETURNING id",
+		candidate, string(hashedPassword), userEmail).Scan(&userID)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to register user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		userID, provider, subject, nullIfEmpty(email))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return userID, candidate, nil
+}
+
+// ListIdentities returns the external identities linked to a user
+func (db *DBInterface) ListIdentities(userID int) ([]Identity, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT provider, subject, COALESCE(email, ''), created_at
+		FROM identities WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var identity Identity
+		var createdAt time.Time
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identity.CreatedAt = createdAt.Format(time.RFC3339)
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating identities: %w", err)
+	}
+	return identities, nil
+}
+
+// nullIfEmpty maps an empty string to SQL NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
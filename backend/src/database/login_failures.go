@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LoginFailures is the failed login history for one key, a username or an IP address
+type LoginFailures struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// recordFailureSQL counts a failure for key $1, starting again at 1 once the last one is more
+// than $2 seconds old
+const recordFailureSQL = `
+	INSERT INTO login_failures (key, failures, last_failure_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+			ELSE login_failures.failures + 1
+		END,
+		last_failure_at = NOW()
+	RETURNING failures, last_failure_at, locked_until`
+
+// ReserveLoginAttempt counts a login attempt against a key as a failure before its password is
+// checked, if allowed says the history so far lets it try now. The key's row stays locked
+// while deciding, so concurrent attempts are counted one after another and each sees the ones
+// before it. Returns the updated history and true when the attempt was counted, or the history
+// it was refused on and false. An attempt that turns out to succeed is given back with
+// ReleaseLoginAttempt.
+func (db *DBInterface) ReserveLoginAttempt(key string, window time.Duration, allowed func(LoginFailures) bool) (LoginFailures, bool, error) {
+	ctx := context.Background()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return LoginFailures{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// a key's first attempts need a row to lock too, one without failures changes nothing
+	_, err = tx.Exec(ctx, `
+		INSERT INTO login_failures (key, failures, last_failure_at) VALUES ($1, 0, NOW())
+		ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return LoginFailures{}, false, fmt.Errorf("failed to reserve login attempt for %s: %w", key, err)
+	}
+	var lf LoginFailures
+	err = tx.QueryRow(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM login_failures WHERE key = $1 FOR UPDATE", key).Scan(
+		&lf.Failures, &lf.LastFailureAt, &lf.LockedUntil)
+	if err != nil {
+		return lf, false, fmt.Errorf("failed to get login failures for %s: %w", key, err)
+	}
+	if !allowed(lf) {
+		return lf, false, nil
+	}
+
+	err = tx.QueryRow(ctx, recordFailureSQL, key, window.Seconds()).Scan(&lf.Failures, &lf.LastFailureAt, &lf.LockedUntil)
+	if err != nil {
+		return lf, false, fmt.Errorf("failed to reserve login attempt for %s: %w", key, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return lf, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return lf, true, nil
+}
+
+// ReleaseLoginAttempt takes back an attempt ReserveLoginAttempt counted, once it turned out
+// not to be a failure
+func (db *DBInterface) ReleaseLoginAttempt(key string) error {
+	_, err := db.pool.Exec(context.Background(),
+		"UPDATE login_failures SET failures = GREATEST(failures - 1, 0) WHERE key = $1", key)
+	if err != nil {
+		return fmt.Errorf("failed to release login attempt for %s: %w", key, err)
+	}
+	return nil
+}
+
+// LockLogin blocks logins for a key until the given time
+func (db *DBInterface) LockLogin(key string, until time.Time) error {
+	_, err := db.pool.Exec(context.Background(),
+		"UPDATE login_failures SET locked_until = $2 WHERE key = $1", key, until)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", key, err)
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the failure history and any lockout for a key
+func (db *DBInterface) ClearLoginFailures(key string) error {
+	_, err := db.pool.Exec(context.Background(), "DELETE FROM login_failures WHERE key = $1", key)
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures for %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PostFile is a post that references an uploaded file
+type PostFile struct {
+	PostID   int
+	UserID   int
+	FileName string
+}
+
+// MediaMigrationReport summarizes a run of MigrateLegacyMedia
+type MediaMigrationReport struct {
+	Moved   int        // files copied into the ID based layout and removed from the old one
+	Skipped []string   // legacy paths left alone, with the reason
+	Missing []PostFile // posts whose file can't be found in the new layout afterwards
+}
+
+// ListPostFiles returns every post that has a file attached
+func (db *DBInterface) ListPostFiles() ([]PostFile, error) {
+	rows, err := db.pool.Query(context.Background(),
+		"SELECT id, user_id, file_name FROM posts WHERE file_name IS NOT NULL AND file_name <> '' ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list post files: %w", err)
+	}
+	defer rows.Close()
+
+	files := []PostFile{}
+	for rows.Next() {
+		var f PostFile
+		if err := rows.Scan(&f.PostID, &f.UserID, &f.FileName); err != nil {
+			return nil, fmt.Errorf("failed to scan post file: %w", err)
+		}
+		files = append(files, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating post files: %w", err)
+	}
+	return files, nil
+}
+
+// MigrateLegacyMedia moves files from the old data/<username>/<postId>_<file> layout into
+// data/users/<userID>/<postID>/<file>. Each file is copied, checked byte for byte and only then
+// removed from its old place, so the migration can be rerun safely after a failure. Folders of
+// usernames that no longer exist are left alone. Finally every post with a file in the database
+// is checked against the new layout.
+func (fm FileManager) MigrateLegacyMedia(db *DBInterface) (MediaMigrationReport, error) {
+	var report MediaMigrationReport
+
+	entries, err := os.ReadDir(fm.DATAROOTDIR)
+	if err != nil {
+		return report, fmt.Errorf("failed to read data folder: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		username := entry.Name()
+		legacyDir := filepath.Join(fm.DATAROOTDIR, username)
+
+		userID, err := db.GetUserIdByName(username)
+		if errors.Is(err, ErrNotFound) {
+			if username != MediaStoreDir && username != UploadStagingDir {
+				report.Skipped = append(report.Skipped, legacyDir+": no user with this name")
+			}
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		files, err := os.ReadDir(legacyDir)
+		if err != nil {
+			return report, fmt.Errorf("failed to read %s: %w", legacyDir, err)
+		}
+
+		for _, file := range files {
+			// the new layout only has folders, so in the store folder itself this skips migrated files
+			if file.IsDir() {
+				continue
+			}
+			legacyPath := filepath.Join(legacyDir, file.Name())
+
+			postIDStr, fileName, found := strings.Cut(file.Name(), "_")
+			postID, convErr := strconv.Atoi(postIDStr)
+			if !found || convErr != nil || fileName == "" {
+				report.Skipped = append(report.Skipped, legacyPath+": not a <postId>_<file> name")
+				continue
+			}
+
+			if err := fm.moveVerified(legacyPath, userID, postID, fileName); err != nil {
+				report.Skipped = append(report.Skipped, legacyPath+": "+err.Error())
+				continue
+			}
+			report.Moved++
+		}
+
+		// drop the old folder once it's empty, a user named after the store folder keeps it of course
+		if username != MediaStoreDir {
+			os.Remove(legacyDir)
+		}
+	}
+
+	postFiles, err := db.ListPostFiles()
+	if err != nil {
+		return report, err
+	}
+	for _, pf := range postFiles {
+		path, err := fm.postFilePath(pf.UserID, pf.PostID, pf.FileName)
+		if err != nil {
+			report.Missing = append(report.Missing, pf)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			report.Missing = append(report.Missing, pf)
+		}
+	}
+
+	return report, nil
+}
+
+// moveVerified copies one legacy file into the new layout, compares checksums and removes the original
+func (fm FileManager) moveVerified(legacyPath string, userID, postID int, fileName string) error {
+	target, err := fm.postFilePath(userID, postID, fileName)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+
+	// a previous run may have copied the file but died before removing the original
+	if existing, err := fileChecksum(target); err == nil {
+		if !bytes.Equal(existing, sum[:]) {
+			return fmt.Errorf("a different file already exists at %s", target)
+		}
+		return os.Remove(legacyPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp := target + ".migrating"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	copied, err := fileChecksum(target)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(copied, sum[:]) {
+		os.Remove(target)
+		return fmt.Errorf("checksum mismatch after copying to %s", target)
+	}
+	return os.Remove(legacyPath)
+}
+
+// fileChecksum returns the SHA-256 of a file's contents
+func fileChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Bounds on poll options
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 6
+	MaxPollOptionLength = 100
+)
+
+// Errors returned when creating or voting in polls
+var (
+	ErrInvalidPoll  = errors.New("invalid poll")
+	ErrInvalidVote  = errors.New("invalid vote")
+	ErrPollClosed   = errors.New("poll is closed")
+	ErrAlreadyVoted = errors.New("already voted in this poll")
+	ErrNotVoted     = errors.New("not voted in this poll yet")
+)
+
+// NewPoll is a poll attached to a post when it's created
+type NewPoll struct {
+	Options        []string
+	MultipleChoice bool       // voters may pick more than one option
+	ClosesAt       *time.Time // nil keeps the poll open
+}
+
+// Poll is a post's poll with its current results
+type Poll struct {
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       *string      `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	VoterCount     int          `json:"voter_count"`
+	Options        []PollOption `json:"options"`
+	Voted          []int        `json:"voted"` // option IDs the viewer picked, empty if they haven't voted
+}
+
+// PollOption is one choice in a poll
+type PollOption struct {
+	ID        int    `json:"option_id"`
+	Text      string `json:"text"`
+	VoteCount int    `json:"vote_count"`
+}
+
+// ValidatePoll checks the options of a new poll, which are trimmed in place
+func ValidatePoll(p *NewPoll) error {
+	if len(p.Options) < MinPollOptions || len(p.Options) > MaxPollOptions {
+		return fmt.Errorf("%w: a poll needs %d to %d options", ErrInvalidPoll, MinPollOptions, MaxPollOptions)
+	}
+	seen := map[string]bool{}
+	for i, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len([]rune(option)) > MaxPollOptionLength {
+			return fmt.Errorf("%w: options must be 1 to %d characters", ErrInvalidPoll, MaxPollOptionLength)
+		}
+		if seen[option] {
+			return fmt.Errorf("%w: options must be different", ErrInvalidPoll)
+		}
+		seen[option] = true
+		p.Options[i] = option
+	}
+	return nil
+}
+
+// insertPoll stores the poll of a new post inside its transaction
+func insertPoll(ctx context.Context, tx pgx.Tx, postID int, p NewPoll) error {
+	_, err := tx.Exec(ctx, "INSERT INTO polls (post_id, multiple_choice, closes_at) VALUES ($1, $2, $3)",
+		postID, p.MultipleChoice, p.ClosesAt)
+	if err != nil {
+		return fmt.Errorf("failed to create poll of post ID %d: %w", postID, err)
+	}
+	for i, option := range p.Options {
+		_, err := tx.Exec(ctx, "INSERT INTO poll_options (post_id, position, text) VALUES ($1, $2, $3)", postID, i, option)
+		if err != nil {
+			return fmt.Errorf("failed to add poll option: %w", err)
+		}
+	}
+	return nil
+}
+
+// CastVote records a user's first vote in a poll
+func (db *DBInterface) CastVote(postID, userID int, optionIDs []int) error {
+	return db.vote(postID, userID, optionIDs, false)
+}
+
+// ChangeVote replaces the options a user voted for
+func (db *DBInterface) ChangeVote(postID, userID int, optionIDs []int) error {
+	return db.vote(postID, userID, optionIDs, true)
+}
+
+// vote writes a user's choices and keeps the option and voter counts in step in the same
+// transaction. The poll row is locked first, so concurrent votes in one poll take turns.
+func (db *DBInterface) vote(postID, userID int, optionIDs []int, change bool) error {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var multipleChoice, closed bool
+	err = tx.QueryRow(ctx, `
+		SELECT multiple_choice, closes_at IS NOT NULL AND closes_at <= NOW()
+		FROM polls WHERE post_id = $1 FOR UPDATE`, postID).Scan(&multipleChoice, &closed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("poll of post ID %d: %w", postID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load poll of post ID %d: %w", postID, err)
+	}
+	if closed {
+		return ErrPollClosed
+	}
+
+	picked := map[int]bool{}
+	for _, id := range optionIDs {
+		picked[id] = true
+	}
+	if len(optionIDs) == 0 || len(picked) != len(optionIDs) || (!multipleChoice && len(optionIDs) > 1) {
+		return fmt.Errorf("%w: pick one option, or several different ones in a multiple choice poll", ErrInvalidVote)
+	}
+	var known int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM poll_options WHERE post_id = $1 AND id = ANY($2)", postID, optionIDs).Scan(&known)
+	if err != nil {
+		return fmt.Errorf("failed to check poll options: %w", err)
+	}
+	if known != len(optionIDs) {
+		return fmt.Errorf("%w: unknown option", ErrInvalidVote)
+	}
+
+	var previous []int
+	rows, err := tx.Query(ctx, "DELETE FROM poll_votes WHERE post_id = $1 AND user_id = $2 RETURNING option_id", postID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear previous vote: %w", err)
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan previous vote: %w", err)
+		}
+		previous = append(previous, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating previous vote: %w", err)
+	}
+	if !change && len(previous) > 0 {
+		return ErrAlreadyVoted
+	}
+	if change && len(previous) == 0 {
+		return ErrNotVoted
+	}
+
+	if len(previous) > 0 {
+		_, err = tx.Exec(ctx, "UPDATE poll_options SET vote_count = vote_count - 1 WHERE id = ANY($1)", previous)
+		if err != nil {
+			return fmt.Errorf("failed to update vote counts: %w", err)
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO poll_votes (post_id, user_id, option_id)
+		SELECT $1, $2, unnest($3::int[])`, postID, userID, optionIDs)
+	if err != nil {
+		return fmt.Errorf("failed to insert vote: %w", err)
+	}
+	_, err = tx.Exec(ctx, "UPDATE poll_options SET vote_count = vote_count + 1 WHERE id = ANY($1)", optionIDs)
+	if err != nil {
+		return fmt.Errorf("failed to update vote counts: %w", err)
+	}
+	if !change {
+		_, err = tx.Exec(ctx, "UPDATE polls SET voter_count = voter_count + 1 WHERE post_id = $1", postID)
+		if err != nil {
+			return fmt.Errorf("failed to update voter count: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
+// attachPolls sets the "poll" of each post, nil for posts without one, with the options
+// viewerID voted for
+func (db *DBInterface) attachPolls(posts []map[string]interface{}, viewerID int) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		id, _ := post["post_id"].(int)
+		ids = append(ids, id)
+	}
+	ctx := context.Background()
+
+	polls := map[int]*Poll{}
+	rows, err := db.pool.Query(ctx, `
+		SELECT post_id, multiple_choice, closes_at, closes_at IS NOT NULL AND closes_at <= NOW(), voter_count
+		FROM polls WHERE post_id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get polls: %w", err)
+	}
+	for rows.Next() {
+		var postID int
+		var closesAt *time.Time
+		p := &Poll{Options: []PollOption{}, Voted: []int{}}
+		if err := rows.Scan(&postID, &p.MultipleChoice, &closesAt, &p.Closed, &p.VoterCount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan poll: %w", err)
+		}
+		if closesAt != nil {
+			s := closesAt.Format(time.RFC3339)
+			p.ClosesAt = &s
+		}
+		polls[postID] = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating polls: %w", err)
+	}
+
+	if len(polls) > 0 {
+		rows, err = db.pool.Query(ctx, `
+			SELECT post_id, id, text, vote_count FROM poll_options
+			WHERE post_id = ANY($1) ORDER BY post_id, position`, ids)
+		if err != nil {
+			return fmt.Errorf("failed to get poll options: %w", err)
+		}
+		for rows.Next() {
+			var postID int
+			var o PollOption
+			if err := rows.Scan(&postID, &o.ID, &o.Text, &o.VoteCount); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan poll option: %w", err)
+			}
+			polls[postID].Options = append(polls[postID].Options, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating poll options: %w", err)
+		}
+	}
+
+	if len(polls) > 0 && viewerID != 0 {
+		rows, err = db.pool.Query(ctx, `
+			SELECT v.post_id, v.option_id FROM poll_votes v
+			JOIN poll_options o ON o.id = v.option_id
+			WHERE v.post_id = ANY($1) AND v.user_id = $2
+			ORDER BY v.post_id, o.position`, ids, viewerID)
+		if err != nil {
+			return fmt.Errorf("failed to get poll votes: %w", err)
+		}
+		for rows.Next() {
+			var postID, optionID int
+			if err := rows.Scan(&postID, &optionID); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan poll vote: %w", err)
+			}
+			polls[postID].Voted = append(polls[postID].Voted, optionID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating poll votes: %w", err)
+		}
+	}
+
+	for _, post := range posts {
+		id, _ := post["post_id"].(int)
+		if p, ok := polls[id]; ok {
+			post["poll"] = p
+		} else {
+			post["poll"] = nil
+		}
+	}
+	return nil
+}
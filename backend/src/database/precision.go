@@ -0,0 +1,119 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Location precisions a post can be shown at to anyone but its author
+const (
+	PrecisionExact        = "exact"
+	Precision100m         = "100m"         // about 100 m
+	PrecisionNeighborhood = "neighborhood" // about 1 km
+	PrecisionCity         = "city"         // about 10 km
+)
+
+// ErrInvalidPrecision is returned for an unknown location precision
+var ErrInvalidPrecision = errors.New("location_precision must be exact, 100m, neighborhood or city")
+
+// precisionSteps is the grid cell height in degrees of latitude for each coarse precision
+var precisionSteps = map[string]float64{
+	Precision100m:         0.001,
+	PrecisionNeighborhood: 0.01,
+	PrecisionCity:         0.1,
+}
+
+// ValidatePrecision checks a location precision, the empty string counts as exact
+func ValidatePrecision(precision string) error {
+	if _, ok := precisionSteps[precision]; ok || precision == "" || precision == PrecisionExact {
+		return nil
+	}
+	return ErrInvalidPrecision
+}
+
+// SnapLocation moves a point to the centre of its grid cell at the given precision. Cells are
+// about as wide as they are tall, so they get fewer and wider in degrees towards the poles,
+// and every latitude band divides 360 degrees evenly so cells never straddle the antimeridian.
+// Exact and unknown precisions return the point unchanged.
+func SnapLocation(latitude, longitude float64, precision string) (float64, float64) {
+	step, ok := precisionSteps[precision]
+	if !ok {
+		return latitude, longitude
+	}
+
+	latCells := math.Round(180 / step)
+	row := math.Min(math.Max(math.Floor((latitude+90)/step), 0), latCells-1)
+	lat := -90 + (row+0.5)*step
+
+	lonCells := math.Max(1, math.Floor(360*math.Cos(lat*math.Pi/180)/step))
+	lonStep := 360 / lonCells
+	col := math.Min(math.Max(math.Floor((longitude+180)/lonStep), 0), lonCells-1)
+	lon := -180 + (col+0.5)*lonStep
+
+	return lat, lon
+}
+
+// maskLocations snaps the coordinates of posts to their author's chosen precision, except
+// for posts viewerID wrote. Filters have already run against the true location by then.
+func maskLocations(posts []map[string]interface{}, viewerID int) {
+	for _, post := range posts {
+		if post["user_id"] == viewerID {
+			continue
+		}
+		precision, _ := post["location_precision"].(string)
+		lat, _ := post["latitude"].(float64)
+		lon, _ := post["longitude"].(float64)
+		post["latitude"], post["longitude"] = SnapLocation(lat, lon, precision)
+	}
+}
+
+// shownLocationJoins returns lateral joins on posts p that give each post's location the way
+// maskLocations shows it to the viewer whose ID is parameter $me, as shown.latitude and
+// shown.longitude. It's SnapLocation in SQL, so aggregates over many posts can't reveal more
+// than the posts themselves would.
+func shownLocationJoins(me int) string {
+	precisions := make([]string, 0, len(precisionSteps))
+	for precision := range precisionSteps {
+		precisions = append(precisions, precision)
+	}
+	sort.Strings(precisions)
+	var steps strings.Builder
+	for _, precision := range precisions {
+		fmt.Fprintf(&steps, " WHEN '%s' THEN %v::float8", precision, precisionSteps[precision])
+	}
+
+	return fmt.Sprintf(`
+		CROSS JOIN LATERAL (SELECT CASE WHEN p.user_id = $%[1]d THEN NULL
+			ELSE CASE p.location_precision%[2]s END END AS step) grid
+		CROSS JOIN LATERAL (SELECT CASE WHEN grid.step IS NULL THEN p.latitude
+			ELSE -90 + (LEAST(GREATEST(floor((p.latitude + 90) / grid.step), 0), round(180 / grid.step) - 1) + 0.5) * grid.step
+			END AS latitude) row_centre
+		CROSS JOIN LATERAL (SELECT GREATEST(1, floor(360 * cos(radians(row_centre.latitude)) / grid.step)) AS cells) band
+		CROSS JOIN LATERAL (SELECT row_centre.latitude, CASE WHEN grid.step IS NULL THEN p.longitude
+			ELSE -180 + (LEAST(GREATEST(floor((p.longitude + 180) / (360 / band.cells)), 0), band.cells - 1) + 0.5) * (360 / band.cells)
+			END AS longitude) shown`, me, steps.String())
+}
+
+// shownLocationBoxes widens a box by the furthest SnapLocation moves a point, so a prefilter on
+// true locations keeps every post shown inside it
+func shownLocationBoxes(b Box) []Box {
+	step := 0.0
+	for _, s := range precisionSteps {
+		step = math.Max(step, s)
+	}
+	// cells are widest in degrees at the latitude nearest a pole a shown location can have
+	edge := math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat))
+	width := 360 / math.Max(1, math.Floor(360*math.Cos(edge*math.Pi/180)/step))
+	return wrapBox(b.MinLon-width, math.Max(b.MinLat-step, -90), b.MaxLon+width, math.Min(b.MaxLat+step, 90))
+}
+
+// shownInBoxesClause returns the condition for posts shown, to the viewer whose ID is
+// parameter $me, inside any of boxes, with its arguments appended to args. It can't use the
+// spatial index, so it goes with a boxesClause on shownLocationBoxes.
+func shownInBoxesClause(me int, boxes []Box, args []interface{}) (string, []interface{}) {
+	inBoxes, args := pointInBoxesClause("point(shown.longitude, shown.latitude)", boxes, args)
+	return "EXISTS (SELECT 1 FROM (SELECT 1) one" + shownLocationJoins(me) + " WHERE " + inBoxes + ")", args
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Kinds of post that reference another one
+const (
+	RepostKindRepost = "repost" // reshares the original, with optional text of its own
+	RepostKindQuote  = "quote"  // comments on the original, text required
+)
+
+// ErrInvalidRepost is returned for a repost_kind that isn't known or a quote without text
+var ErrInvalidRepost = errors.New("invalid repost")
+
+// ValidateRepost checks the kind and content of a post that references another one
+func ValidateRepost(kind, content string) error {
+	switch kind {
+	case RepostKindRepost:
+		return nil
+	case RepostKindQuote:
+		if strings.TrimSpace(content) == "" {
+			return fmt.Errorf("%w: a quote needs content", ErrInvalidRepost)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: kind must be %s or %s", ErrInvalidRepost, RepostKindRepost, RepostKindQuote)
+}
+
+// countRepost resolves the post a new repost points at and raises its count inside the new
+// post's transaction. Reposting a plain repost reposts its original. Only live, published,
+// public posts can be reposted, so the embedded copy never shows more than its author shared;
+// anything else is ErrNotFound. The update also locks the original until the commit.
+func countRepost(ctx context.Context, tx pgx.Tx, repostOf int, kind string) (int, error) {
+	var target *int
+	err := tx.QueryRow(ctx, `
+		SELECT CASE WHEN repost_kind = $2 THEN repost_of_id ELSE id END
+		FROM posts WHERE id = $1`, repostOf, RepostKindRepost).Scan(&target)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && target == nil) {
+		return 0, fmt.Errorf("post ID %d: %w", repostOf, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up post ID %d: %w", repostOf, err)
+	}
+
+	counter := "repost_count"
+	if kind == RepostKindQuote {
+		counter = "quote_count"
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE posts p SET `+counter+` = `+counter+` + 1
+		WHERE p.id = $1 AND p.visibility = $2 AND `+postLiveClause+` AND `+postPublishedClause,
+		*target, VisibilityPublic)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count repost of post ID %d: %w", *target, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, fmt.Errorf("post ID %d: %w", *target, ErrNotFound)
+	}
+	return *target, nil
+}
+
+// uncountReposts wraps a DELETE on posts so the originals of any reposts and quotes it removes
+// have their counts lowered in the same statement. The DELETE must not have a RETURNING
+// clause; returning lists the deleted columns the statement hands back. Originals deleted
+// alongside are left alone, their rows are going anyway.
+func uncountReposts(deleteStmt, returning string) string {
+	return `
+		WITH gone AS (
+			` + deleteStmt + `
+			RETURNING ` + returning + `, repost_of_id, repost_kind
+		), uncounted AS (
+			UPDATE posts o SET
+				repost_count = GREATEST(o.repost_count - (SELECT COUNT(*) FROM gone g WHERE g.repost_of_id = o.id AND g.repost_kind = '` + RepostKindRepost + `'), 0),
+				quote_count = GREATEST(o.quote_count - (SELECT COUNT(*) FROM gone g WHERE g.repost_of_id = o.id AND g.repost_kind = '` + RepostKindQuote + `'), 0)
+			WHERE o.id IN (SELECT repost_of_id FROM gone) AND o.id NOT IN (SELECT id FROM gone)
+		)
+		SELECT ` + returning + ` FROM gone`
+}
+
+// attachOriginals sets the "original" of each repost and quote to the post it references,
+// complete but one level deep, or to a tombstone when that post is gone or hidden from the
+// viewer. Posts that reference nothing get nil.
+func (db *DBInterface) attachOriginals(posts []map[string]interface{}, viewer Viewer) error {
+	ids := []int{}
+	for _, post := range posts {
+		if id, ok := post["repost_of_id"].(int); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	originals := map[int]map[string]interface{}{}
+	if len(ids) > 0 {
+		visible, args := viewer.visibleClause([]interface{}{ids})
+		rows, err := db.pool.Query(context.Background(), `
+			SELECT `+postColumns+`
+			FROM posts p
+			JOIN users u ON p.user_id = u.id
+			WHERE p.id = ANY($1) AND `+postLiveClause+` AND `+postPublishedClause+` AND `+visible, args...)
+		if err != nil {
+			return fmt.Errorf("failed to get reposted posts: %w", err)
+		}
+		found := []map[string]interface{}{}
+		for rows.Next() {
+			original, err := scanPost(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan reposted post: %w", err)
+			}
+			found = append(found, original)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating reposted posts: %w", err)
+		}
+		if err := db.decoratePosts(found, viewer); err != nil {
+			return err
+		}
+		for _, original := range found {
+			originals[original["post_id"].(int)] = original
+		}
+	}
+
+	for _, post := range posts {
+		if post["repost_kind"] == nil {
+			post["original"] = nil
+			continue
+		}
+		id, _ := post["repost_of_id"].(int)
+		if original, ok := originals[id]; ok {
+			post["original"] = original
+		} else {
+			post["original"] = map[string]interface{}{"deleted": true}
+		}
+	}
+	return nil
+}
+
+// decoratePosts adds what every post read hands out besides its row: locations snapped for
+// the viewer, attachments, entities, polls and whether the viewer bookmarked it
+func (db *DBInterface) decoratePosts(posts []map[string]interface{}, viewer Viewer) error {
+	maskLocations(posts, viewer.UserID)
+	if err := db.attachAttachments(posts); err != nil {
+		return err
+	}
+	if err := db.attachEntities(posts); err != nil {
+		return err
+	}
+	if err := db.attachPolls(posts, viewer.UserID); err != nil {
+		return err
+	}
+	return db.attachBookmarks(posts, viewer.UserID)
+}
+
+// completePosts decorates posts read for viewer and embeds the originals of reposts and quotes
+func (db *DBInterface) completePosts(posts []map[string]interface{}, viewer Viewer) error {
+	if err := db.decoratePosts(posts, viewer); err != nil {
+		return err
+	}
+	return db.attachOriginals(posts, viewer)
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrInvalidAttachment is returned when an edit refers to an attachment the post doesn't have
+var ErrInvalidAttachment = errors.New("attachment does not belong to this post")
+
+// PostRevision is an earlier version of a post, kept when the post is edited
+type PostRevision struct {
+	ID          int          `json:"revision_id"`
+	PostID      int          `json:"post_id"`
+	Content     string       `json:"content"`
+	FileName    string       `json:"file_name"`
+	Attachments []Attachment `json:"attachments"`
+	ValidFrom   string       `json:"valid_from"`  // when this version was posted or last edited
+	ReplacedAt  string       `json:"replaced_at"` // when the edit that replaced it happened
+}
+
+// UpdatePost replaces a post's content, and its attachments unless attachments is nil.
+// A new attachment list is taken in order: entries with an ID keep that existing attachment,
+// entries without one are files the caller already wrote. The current version is copied into
+// post_revisions first and edited_at is set. Returns the attachments that were dropped so
+// their files can be deleted.
+func (db *DBInterface) UpdatePost(postID int, content string, attachments []Attachment) ([]Attachment, error) {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldContent, oldFileName string
+	var createdAt time.Time
+	var editedAt *time.Time
+	err = tx.QueryRow(ctx,
+		"SELECT content, file_name, created_at, edited_at FROM posts WHERE id = $1 FOR UPDATE", postID).Scan(
+		&oldContent, &oldFileName, &createdAt, &editedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("post ID %d: %w", postID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load post ID %d: %w", postID, err)
+	}
+
+	// read through the pool would miss rows locked by this transaction, so ask the transaction
+	oldAttachments := []Attachment{}
+	rows, err := tx.Query(ctx, `
+		SELECT id, position, file_name, mime_type, size_bytes, width, height
+		FROM post_attachments WHERE post_id = $1 ORDER BY position`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments of post ID %d: %w", postID, err)
+	}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.Position, &a.FileName, &a.MimeType, &a.SizeBytes, &a.Width, &a.Height); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		oldAttachments = append(oldAttachments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachments: %w", err)
+	}
+	if len(oldAttachments) == 0 && oldFileName != "" {
+		// posts from before attachments were tracked
+		oldAttachments = append(oldAttachments, Attachment{FileName: oldFileName})
+	}
+
+	validFrom := createdAt
+	if editedAt != nil {
+		validFrom = *editedAt
+	}
+	snapshot, err := json.Marshal(oldAttachments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attachments: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO post_revisions (post_id, content, file_name, attachments, valid_from)
+		VALUES ($1, $2, $3, $4::jsonb, $5)`, postID, oldContent, oldFileName, string(snapshot), validFrom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store revision of post ID %d: %w", postID, err)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE posts SET content = $2, edited_at = NOW() WHERE id = $1", postID, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update post ID %d: %w", postID, err)
+	}
+	if err := indexEntities(ctx, tx, "post", postID, content); err != nil {
+		return nil, err
+	}
+
+	removed := []Attachment{}
+	if attachments != nil {
+		existing := map[int]Attachment{}
+		for _, a := range oldAttachments {
+			if a.ID != 0 {
+				existing[a.ID] = a
+			}
+		}
+
+		next := make([]Attachment, 0, len(attachments))
+		kept := map[int]bool{}
+		for _, a := range attachments {
+			if a.ID != 0 {
+				old, ok := existing[a.ID]
+				if !ok || kept[a.ID] {
+					return nil, ErrInvalidAttachment
+				}
+				kept[a.ID] = true
+				a = old
+			}
+			next = append(next, a)
+		}
+		for _, a := range oldAttachments {
+			if a.ID == 0 || !kept[a.ID] {
+				removed = append(removed, a)
+			}
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM post_attachments WHERE post_id = $1", postID); err != nil {
+			return nil, fmt.Errorf("failed to clear attachments of post ID %d: %w", postID, err)
+		}
+		if err := insertAttachments(ctx, tx, postID, 0, next); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return removed, nil
+}
+
+// GetPostRevisions returns the earlier versions of a post, newest first
+func (db *DBInterface) GetPostRevisions(postID int) ([]PostRevision, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT id, post_id, content, file_name, attachments, valid_from, replaced_at
+		FROM post_revisions WHERE post_id = $1
+		ORDER BY replaced_at DESC, id DESC`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions of post ID %d: %w", postID, err)
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		var snapshot []byte
+		var validFrom, replacedAt time.Time
+		if err := rows.Scan(&rev.ID, &rev.PostID, &rev.Content, &rev.FileName, &snapshot, &validFrom, &replacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		rev.Attachments = []Attachment{}
+		if err := json.Unmarshal(snapshot, &rev.Attachments); err != nil {
+			return nil, fmt.Errorf("failed to decode attachments of revision %d: %w", rev.ID, err)
+		}
+		rev.ValidFrom = validFrom.Format(time.RFC3339)
+		rev.ReplacedAt = replacedAt.Format(time.RFC3339)
+		revisions = append(revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revisions: %w", err)
+	}
+	return revisions, nil
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// User roles, each one can do everything the roles before it can
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator" // may remove any post or comment and suspend users
+	RoleAdmin     = "admin"     // may also delete accounts and change roles
+)
+
+var roleRanks = map[string]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ErrAccountSuspended is returned when a suspended user tries to log in
+var ErrAccountSuspended = errors.New("account is suspended")
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role ranks the same as or above minRole.
+// Unknown roles never satisfy anything.
+func RoleAtLeast(role, minRole string) bool {
+	rank, ok := roleRanks[role]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[minRole]
+}
+
+// AdminUser is a user as seen by moderators, including suspension state
+type AdminUser struct {
+	UserProfile
+	Suspended        bool    `json:"suspended"`
+	SuspendedUntil   *string `json:"suspended_until,omitempty"`
+	SuspensionReason string  `json:"suspension_reason,omitempty"`
+}
+
+// GetUserRole returns the role of a user
+func (db *DBInterface) GetUserRole(userID int) (string, error) {
+	var role string
+	err := db.pool.QueryRow(context.Background(), "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role for user ID %d: %w", userID, err)
+	}
+	return role, nil
+}
+
+// SetUserRole changes the role of a user
+func (db *DBInterface) SetUserRole(userID int, role string) error {
+	tag, err := db.pool.Exec(context.Background(), "UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set role for user ID %d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+	return nil
+}
+
+// suspendedClause is true for rows of users whose suspension is in effect
+const suspendedClause = "(suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > NOW()))"
+
+// ListUsers pages through users, optionally filtered by a username substring
+func (db *DBInterface) ListUsers(query string, limit, offset int) ([]AdminUser, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT id, username, created_at, role, `+suspendedClause+`, suspended_until, COALESCE(suspension_reason, '')
+		FROM users
+		WHERE username ILIKE $1
+		ORDER BY id ASC
+		LIMIT $2 OFFSET $3`, "%"+query+"%", limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		var u AdminUser
+		var createdAt time.Time
+		var suspendedUntil *time.Time
+		if err := rows.Scan(&u.UserID, &u.Username, &createdAt, &u.Role, &u.Suspended, &suspendedUntil, &u.SuspensionReason); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		u.CreatedAt = createdAt.Format(time.RFC3339)
+		if u.Suspended && suspendedUntil != nil {
+			until := suspendedUntil.Format(time.RFC3339)
+			u.SuspendedUntil = &until
+		}
+		if !u.Suspended {
+			u.SuspensionReason = ""
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+	return users, nil
+}
+
+// SuspendUser blocks a user from logging in until the given time, or indefinitely if until is nil.
+// All of the user's sessions are revoked in the same transaction.
+func (db *DBInterface) SuspendUser(userID int, reason string, until *time.Time) error {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		"UPDATE users SET suspended_at = NOW(), suspended_until = $2, suspension_reason = $3 WHERE id = $1",
+		userID, until, reason)
+	if err != nil {
+		return fmt.Errorf("failed to suspend user ID %d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions for user ID %d: %w", userID, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
+// UnsuspendUser lifts a suspension
+func (db *DBInterface) UnsuspendUser(userID int) error {
+	tag, err := db.pool.Exec(context.Background(),
+		"UPDATE users SET suspended_at = NULL, suspended_until = NULL, suspension_reason = NULL WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to unsuspend user ID %d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+	return nil
+}
+
+// IsSuspended reports whether a user's suspension is currently in effect
+func (db *DBInterface) IsSuspended(userID int) (bool, error) {
+	var suspended bool
+	err := db.pool.QueryRow(context.Background(),
+		"SELECT "+suspendedClause+" FROM users WHERE id = $1", userID).Scan(&suspended)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check suspension for user ID %d: %w", userID, err)
+	}
+	return suspended, nil
+}
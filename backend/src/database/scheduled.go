@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Errors returned when changing a scheduled post
+var (
+	ErrNotScheduled      = errors.New("post is not scheduled")                     // rescheduling or cancelling a post that's already out
+	ErrPollClosesTooSoon = errors.New("closes_at must be after the post goes out") // rescheduling past the close of its poll
+)
+
+// postPublishedClause hides scheduled posts until their publish_at
+const postPublishedClause = `(p.publish_at IS NULL OR p.publish_at <= NOW())`
+
+// PublishedPost is a scheduled post that just went out
+type PublishedPost struct {
+	PostID int
+	UserID int
+}
+
+// GetPostByIdAs is GetPostById for a viewer, who can also see their own scheduled posts and
+// whatever else the post's visibility lets them see
+func (db *DBInterface) GetPostByIdAs(postID int, viewer Viewer) (map[string]interface{}, error) {
+	visible, args := viewer.visibleClause([]interface{}{postID})
+	post, err := scanPost(db.pool.QueryRow(context.Background(), `
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = $1 AND `+postLiveClause+` AND (p.user_id = $2 OR (`+postPublishedClause+` AND `+visible+`))`, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("post ID %d: %w", postID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post ID %d: %w", postID, err)
+	}
+	if err := db.completePosts([]map[string]interface{}{post}, viewer); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// ListScheduledPosts returns a user's posts that haven't gone out yet, soonest first
+func (db *DBInterface) ListScheduledPosts(userID int) ([]map[string]interface{}, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.user_id = $1 AND p.publish_at > NOW()
+		ORDER BY p.publish_at, p.id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled posts for user ID %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	posts := []map[string]interface{}{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			log.Printf("Error scanning scheduled post for user ID %d: %v", userID, err)
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled posts: %w", err)
+	}
+	if err := db.completePosts(posts, Viewer{UserID: userID}); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// ReschedulePost moves a scheduled post to a new time. An expiry keeps the same distance from
+// the publish time, and a poll has to close after the new time like one on a new post.
+func (db *DBInterface) ReschedulePost(postID int, publishAt time.Time) error {
+	ctx := context.Background()
+	tag, err := db.pool.Exec(ctx, `
+		UPDATE posts p
+		SET expires_at = $2::timestamptz + (p.expires_at - p.publish_at), publish_at = $2::timestamptz, created_at = $2::timestamptz
+		WHERE p.id = $1 AND p.publish_at > NOW()
+		AND NOT EXISTS (SELECT 1 FROM polls pl WHERE pl.post_id = p.id AND pl.closes_at <= $2::timestamptz)`, postID, publishAt)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule post ID %d: %w", postID, err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	var closesFirst bool
+	err = db.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM posts p JOIN polls pl ON pl.post_id = p.id
+			WHERE p.id = $1 AND p.publish_at > NOW() AND pl.closes_at <= $2::timestamptz)`, postID, publishAt).Scan(&closesFirst)
+	if err != nil {
+		return fmt.Errorf("failed to check poll of post ID %d: %w", postID, err)
+	}
+	if closesFirst {
+		return fmt.Errorf("post ID %d: %w", postID, ErrPollClosesTooSoon)
+	}
+	return db.scheduledPostError(postID)
+}
+
+// CancelScheduledPost deletes a post that hasn't gone out yet
+func (db *DBInterface) CancelScheduledPost(postID int) error {
+	tag, err := db.pool.Exec(context.Background(),
+		uncountReposts("DELETE FROM posts WHERE id = $1 AND publish_at > NOW()", "id"), postID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel post ID %d: %w", postID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.scheduledPostError(postID)
+	}
+	return nil
+}
+
+// scheduledPostError tells a missing post apart from one that's already published
+func (db *DBInterface) scheduledPostError(postID int) error {
+	if _, err := db.GetPostOwner(postID); err != nil {
+		return err
+	}
+	return fmt.Errorf("post ID %d: %w", postID, ErrNotScheduled)
+}
+
+// PublishDuePosts marks up to batchSize scheduled posts whose time has come as published and
+// returns them. Like the expiry reaper it claims rows with SKIP LOCKED, so with several
+// instances each post is returned exactly once.
+func (db *DBInterface) PublishDuePosts(batchSize int) ([]PublishedPost, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		UPDATE posts SET publish_at = NULL WHERE id IN (
+			SELECT id FROM posts
+			WHERE publish_at IS NOT NULL AND publish_at <= NOW()
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id`, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish scheduled posts: %w", err)
+	}
+	defer rows.Close()
+
+	published := []PublishedPost{}
+	for rows.Next() {
+		var p PublishedPost
+		if err := rows.Scan(&p.PostID, &p.UserID); err != nil {
+			return nil, fmt.Errorf("failed to scan published post: %w", err)
+		}
+		published = append(published, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating published posts: %w", err)
+	}
+	return published, nil
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+var ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+// The whole session is revoked when this happens since the token has likely been stolen.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// Session is one logged in device, refresh tokens rotate within it
+type Session struct {
+	ID         int    `json:"session_id"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+}
+
+// CreateSession starts a new session for a user along with its first refresh token
+func (db *DBInterface) CreateSession(userID int, userAgent, ip, tokenHash string, expiresAt time.Time) (int, error) {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var sessionID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id`,
+		userID, userAgent, ip, expiresAt).Scan(&sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		sessionID, tokenHash, expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return sessionID, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same session.
+// Returns the session's user ID and session ID.
+func (db *DBInterface) RotateRefreshToken(oldHash, newHash, userAgent, ip string, expiresAt time.Time) (int, int, error) {
+	ctx := context.Background()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the token so two concurrent refreshes can't both rotate it
+	var tokenID, sessionID, userID int
+	var usedAt, revokedAt *time.Time
+	var tokenExpiresAt time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT rt.id, rt.session_id, rt.used_at, rt.expires_at, s.user_id, s.revoked_at
+		FROM refresh_tokens rt
+		JOIN sessions s ON rt.session_id = s.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s`, oldHash).Scan(&tokenID, &sessionID, &usedAt, &tokenExpiresAt, &userID, &revokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+
+	if revokedAt != nil {
+		return 0, 0, ErrInvalidRefreshToken
+	}
+
+	if usedAt != nil {
+		// someone is replaying a rotated token, kill the whole session family
+		if _, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE id = $1", sessionID); err != nil {
+			return 0, 0, fmt.Errorf("failed to revoke session %d: %w", sessionID, err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return 0, 0, fmt.Errorf("transaction commit failed: %w", err)
+		}
+		return 0, 0, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(tokenExpiresAt) {
+		return 0, 0, ErrInvalidRefreshToken
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID); err != nil {
+		return 0, 0, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		sessionID, newHash, expiresAt)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions SET last_used_at = NOW(), user_agent = $2, ip = $3, expires_at = $4
+		WHERE id = $1`, sessionID, userAgent, ip, expiresAt)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return userID, sessionID, nil
+}
+
+// ListSessions returns a user's sessions that are neither revoked nor expired
+func (db *DBInterface) ListSessions(userID int) ([]Session, error) {
+	rows, err := db.pool.Query(context.Background(), `
+		SELECT id, user_agent, ip, created_at, last_used_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var createdAt, lastUsedAt time.Time
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &createdAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		s.CreatedAt = createdAt.Format(time.RFC3339)
+		s.LastUsedAt = lastUsedAt.Format(time.RFC3339)
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of a user's sessions
+func (db *DBInterface) RevokeSession(userID, sessionID int) error {
+	tag, err := db.pool.Exec(context.Background(),
+		"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session %d: %w", sessionID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("session %d: %w", sessionID, ErrNotFound)
+	}
+	return nil
+}
+
+// RevokeAllSessions ends every session of a user except keepSessionID (pass 0 to end them all)
+func (db *DBInterface) RevokeAllSessions(userID, keepSessionID int) error {
+	_, err := db.pool.Exec(context.Background(),
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL",
+		userID, keepSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions for user ID %d: %w", userID, err)
+	}
+	return nil
+}
+
+// RevokedSessionsSince returns the IDs of sessions revoked after since
+func (db *DBInterface) RevokedSessionsSince(since time.Time) ([]int, error) {
+	rows, err := db.pool.Query(context.Background(), "SELECT id FROM sessions WHERE revoked_at > $1", since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revoked sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revoked sessions: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean radius in meters that distances are measured with
+const EarthRadius = 6371000
+
+// boxMargin widens radius boxes by a few meters, in radians, so rounding in the SQL distance
+// can't put a point inside the radius but outside its box
+const boxMargin = 1e-6
+
+// Errors returned for coordinates outside the latitude and longitude ranges
+var (
+	ErrInvalidLocation = errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+	ErrInvalidBBox     = errors.New("bbox must be minLon,minLat,maxLon,maxLat with longitudes between -180 and 180, latitudes between -90 and 90 and minLat no greater than maxLat")
+)
+
+// Box is a latitude and longitude rectangle, edges included. It never crosses the
+// antimeridian; an area that does is split into two boxes.
+type Box struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Contains reports whether a point lies in b
+func (b Box) Contains(latitude, longitude float64) bool {
+	return latitude >= b.MinLat && latitude <= b.MaxLat && longitude >= b.MinLon && longitude <= b.MaxLon
+}
+
+// ValidateLocation checks a post's coordinates are in range, which the spatial index relies on
+func ValidateLocation(latitude, longitude float64) error {
+	if !(latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180) {
+		return ErrInvalidLocation
+	}
+	return nil
+}
+
+// ParseBBox reads a minLon,minLat,maxLon,maxLat viewport. A viewport whose minLon is greater
+// than its maxLon crosses the antimeridian and comes back as two boxes, one on each side.
+func ParseBBox(s string) ([]Box, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, ErrInvalidBBox
+	}
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, ErrInvalidBBox
+		}
+		v[i] = f
+	}
+	minLon, minLat, maxLon, maxLat := v[0], v[1], v[2], v[3]
+	if ValidateLocation(minLat, minLon) != nil || ValidateLocation(maxLat, maxLon) != nil || minLat > maxLat {
+		return nil, ErrInvalidBBox
+	}
+
+	if minLon > maxLon {
+		return []Box{
+			{MinLon: minLon, MinLat: minLat, MaxLon: 180, MaxLat: maxLat},
+			{MinLon: -180, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat},
+		}, nil
+	}
+	return []Box{{MinLon: minLon, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat}}, nil
+}
+
+// GreatCircleDistance returns the distance in meters between two points, computed the same
+// way as distanceSQL
+func GreatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	c := math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Cos(lon2*rad-lon1*rad) + math.Sin(lat1*rad)*math.Sin(lat2*rad)
+	return EarthRadius * math.Acos(math.Min(1, math.Max(-1, c)))
+}
+
+// RadiusBoxes returns boxes that together hold every point within distance meters of
+// (latitude, longitude). They're only a prefilter for the index; the exact distance is still
+// checked afterwards. A circle over a pole spans every longitude, and one that crosses the
+// antimeridian comes back as two boxes, one on each side. nil means no box helps: the radius
+// covers the whole sphere, or the centre isn't a valid point, in which case the distance
+// check alone decides as it always has.
+func RadiusBoxes(latitude, longitude, distance float64) []Box {
+	if !(latitude >= -90 && latitude <= 90) || math.IsInf(longitude, 0) || math.IsNaN(longitude) {
+		return nil
+	}
+	r := math.Max(distance, 0)/EarthRadius + boxMargin
+	if r >= math.Pi {
+		return nil
+	}
+
+	lat := latitude * math.Pi / 180
+	deg := 180 / math.Pi
+	minLat := math.Max(latitude-r*deg, -90)
+	maxLat := math.Min(latitude+r*deg, 90)
+	if lat+r >= math.Pi/2 || lat-r <= -math.Pi/2 {
+		return []Box{{MinLon: -180, MinLat: minLat, MaxLon: 180, MaxLat: maxLat}}
+	}
+
+	// the widest the circle gets in longitude, where a meridian touches it
+	spread := math.Asin(math.Min(math.Sin(r)/math.Cos(lat), 1)) * deg
+	lon := math.Remainder(longitude, 360)
+	if spread >= 180 {
+		return []Box{{MinLon: -180, MinLat: minLat, MaxLon: 180, MaxLat: maxLat}}
+	}
+	return wrapBox(lon-spread, minLat, lon+spread, maxLat)
+}
+
+// wrapBox returns a rectangle whose longitudes may run past ±180 as boxes within range: split
+// in two where it crosses the antimeridian, or spanning every longitude if it's that wide
+func wrapBox(minLon, minLat, maxLon, maxLat float64) []Box {
+	switch {
+	case maxLon-minLon >= 360:
+		return []Box{{MinLon: -180, MinLat: minLat, MaxLon: 180, MaxLat: maxLat}}
+	case minLon < -180:
+		return []Box{
+			{MinLon: minLon + 360, MinLat: minLat, MaxLon: 180, MaxLat: maxLat},
+			{MinLon: -180, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat},
+		}
+	case maxLon > 180:
+		return []Box{
+			{MinLon: minLon, MinLat: minLat, MaxLon: 180, MaxLat: maxLat},
+			{MinLon: -180, MinLat: minLat, MaxLon: maxLon - 360, MaxLat: maxLat},
+		}
+	}
+	return []Box{{MinLon: minLon, MinLat: minLat, MaxLon: maxLon, MaxLat: maxLat}}
+}
+
+// boxesClause returns the condition for posts inside any of boxes, written so the planner
+// can use the posts_location_idx GiST index, with its arguments appended to args
+func boxesClause(boxes []Box, args []interface{}) (string, []interface{}) {
+	return pointInBoxesClause("point(p.longitude, p.latitude)", boxes, args)
+}
+
+// pointInBoxesClause returns the condition for a point expression inside any of boxes, with
+// its arguments appended to args
+func pointInBoxesClause(point string, boxes []Box, args []interface{}) (string, []interface{}) {
+	conditions := make([]string, 0, len(boxes))
+	for _, b := range boxes {
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf(
+			"%s <@ box(point($%d::float8, $%d::float8), point($%d::float8, $%d::float8))",
+			point, n+1, n+2, n+3, n+4))
+		args = append(args, b.MinLon, b.MinLat, b.MaxLon, b.MaxLat)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
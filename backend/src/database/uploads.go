@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// UploadStagingDir is the folder under the data root holding uploads still being received.
+// It can't clash with a username since those must start with a letter or digit.
+const UploadStagingDir = ".uploads"
+
+// ErrFileTooLarge is returned when an upload goes past its size limit
+var ErrFileTooLarge = errors.New("file is larger than the upload limit")
+
+// stagingDir is where StageUpload writes
+func (fm FileManager) stagingDir() string {
+	return filepath.Join(fm.DATAROOTDIR, UploadStagingDir)
+}
+
+// StageUpload streams r to a temporary file without holding it in memory, giving up with
+// ErrFileTooLarge as soon as more than maxBytes arrive. Returns the staged path and size,
+// to be passed to CommitUpload once the post exists or DiscardUpload otherwise.
+func (fm FileManager) StageUpload(r io.Reader, maxBytes int64) (string, int64, error) {
+	if _, err := os.Stat(fm.DATAROOTDIR); err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(fm.stagingDir(), 0755); err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp(fm.stagingDir(), "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+
+	// one byte past the limit is enough to know it's too big
+	size, err := io.Copy(tmp, io.LimitReader(r, maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > maxBytes {
+		err = ErrFileTooLarge
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return tmp.Name(), size, nil
+}
+
+// CommitUpload moves a staged upload into a post's folder under its final name
+func (fm FileManager) CommitUpload(stagedPath string, userID int, postID int, fileName string) error {
+	if inScope, err := IsParent(fm.stagingDir(), stagedPath); err != nil || !inScope {
+		return fmt.Errorf("%s is not a staged upload", stagedPath)
+	}
+
+	target, err := fm.postFilePath(userID, postID, fileName)
+	if err != nil {
+		return err
+	}
+	if err := fm.CreateUserFolder(userID); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(stagedPath, target)
+}
+
+// DiscardUpload removes a staged upload that won't be used, it's fine if it was already moved
+func (fm FileManager) DiscardUpload(stagedPath string) error {
+	inScope, err := IsParent(fm.stagingDir(), stagedPath)
+	if err != nil || !inScope {
+		return err
+	}
+	if err := os.Remove(stagedPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// OpenUpload opens a staged upload for reading, e.g. to sniff its type
+func (fm FileManager) OpenUpload(stagedPath string) (*os.File, error) {
+	if inScope, err := IsParent(fm.stagingDir(), stagedPath); err != nil || !inScope {
+		return nil, fmt.Errorf("%s is not a staged upload", stagedPath)
+	}
+	return os.Open(stagedPath)
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// UsernameCooldown is how long an old username stays reserved for its previous owner
+const UsernameCooldown = 30 * 24 * time.Hour
+
+// ErrUsernameTaken is returned when a username belongs to someone else or is still reserved
+var ErrUsernameTaken = errors.New("username is taken")
+
+// uniqueViolation is the Postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
+// usernameConflict reports whether err is a write that lost a race for a username another
+// user took first, rejected by the users.username UNIQUE constraint
+func usernameConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "users_username_key"
+}
+
+// usernameReservedClause is true when $1 is being held for a user who recently gave it up
+const usernameReservedClause = `EXISTS(SELECT 1 FROM username_reservations WHERE username = $1 AND reserved_until > NOW())`
+
+// RenameUser changes a user's username and reserves the old one for them until the cooldown ends.
+// Files are stored by user ID and everything else joins on users.id, so this single row update
+// is all a rename touches. Returns the old username.
+func (db *DBInterface) RenameUser(userID int, newUsername string, cooldown time.Duration) (string, error) {
+	if err := ValidateUsername(newUsername); err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldUsername string
+	err = tx.QueryRow(ctx, "SELECT username FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&oldUsername)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("user ID %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load user ID %d: %w", userID, err)
+	}
+	if oldUsername == newUsername {
+		return oldUsername, nil
+	}
+
+	// the user may take back a name they gave up themselves, nobody else can until it's released
+	var taken bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)
+		    OR EXISTS(SELECT 1 FROM username_reservations
+		              WHERE username = $1 AND reserved_until > NOW() AND user_id <> $2)`,
+		newUsername, userID).Scan(&taken)
+	if err != nil {
+		return "", fmt.Errorf("failed to check username: %w", err)
+	}
+	if taken {
+		return "", ErrUsernameTaken
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE users SET username = $1 WHERE id = $2", newUsername, userID); err != nil {
+		// someone else took the name between the check and here
+		if usernameConflict(err) {
+			return "", ErrUsernameTaken
+		}
+		return "", fmt.Errorf("failed to rename user ID %d: %w", userID, err)
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM username_reservations WHERE username = $1", newUsername); err != nil {
+		return "", fmt.Errorf("failed to release reservation: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO username_reservations (username, user_id, reserved_until)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO UPDATE SET user_id = EXCLUDED.user_id, reserved_until = EXCLUDED.reserved_until`,
+		oldUsername, userID, time.Now().Add(cooldown))
+	if err != nil {
+		return "", fmt.Errorf("failed to reserve old username: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return oldUsername, nil
+}
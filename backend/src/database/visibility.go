@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Post visibility levels
+const (
+	VisibilityPublic    = "public"    // anyone
+	VisibilityFollowers = "followers" // people following the author
+	VisibilityPrivate   = "private"   // only the author
+	VisibilityLocal     = "local"     // viewers within the post's local_radius
+)
+
+// Bounds and default for local_radius, in meters
+const (
+	MinLocalRadius     = 100
+	MaxLocalRadius     = 50000
+	DefaultLocalRadius = 5000
+)
+
+// ErrInvalidVisibility is returned for an unknown visibility level
+var ErrInvalidVisibility = errors.New("visibility must be public, followers, private or local")
+
+// ValidateVisibility checks a visibility level, the empty string counts as public
+func ValidateVisibility(visibility string) error {
+	switch visibility {
+	case "", VisibilityPublic, VisibilityFollowers, VisibilityPrivate, VisibilityLocal:
+		return nil
+	}
+	return ErrInvalidVisibility
+}
+
+// Viewer is who a read is for. The zero value is a signed out viewer whose location is unknown,
+// who only sees public posts.
+type Viewer struct {
+	UserID    int
+	Latitude  *float64
+	Longitude *float64
+}
+
+// ViewerAt returns a viewer with a location. Infinite coordinates, which callers use for
+// "not given", leave it unknown.
+func ViewerAt(userID int, latitude, longitude float64) Viewer {
+	v := Viewer{UserID: userID}
+	if !math.IsInf(latitude, 0) && !math.IsInf(longitude, 0) && !math.IsNaN(latitude) && !math.IsNaN(longitude) {
+		v.Latitude, v.Longitude = &latitude, &longitude
+	}
+	return v
+}
+
+// distanceSQL is the great circle distance in meters between a post and the point in the
+// given parameters. acos is clamped since rounding can push its argument just past 1.
+func distanceSQL(latParam, lonParam int) string {
+	return fmt.Sprintf(`( 6371000 * acos(LEAST(1.0, GREATEST(-1.0,
+						cos(radians($%[1]d)) * cos(radians(p.latitude)) *
+						cos(radians(p.longitude) - radians($%[2]d)) +
+						sin(radians($%[1]d)) * sin(radians(p.latitude))
+					))) )`, latParam, lonParam)
+}
+
+// visibleClause returns the condition for posts v may see, with its arguments appended to args.
+// Authors always see their own posts.
+func (v Viewer) visibleClause(args []interface{}) (string, []interface{}) {
+	me, lat, lon := len(args)+1, len(args)+2, len(args)+3
+	args = append(args, v.UserID, v.Latitude, v.Longitude)
+	return fmt.Sprintf(`(p.user_id = $%[1]d
+		OR p.visibility = '%[4]s'
+		OR (p.visibility = '%[5]s' AND EXISTS (
+			SELECT 1 FROM follows f WHERE f.follower_id = $%[1]d AND f.followee_id = p.user_id))
+		OR (p.visibility = '%[6]s' AND $%[2]d::float8 IS NOT NULL AND $%[3]d::float8 IS NOT NULL
+			AND %[7]s <= p.local_radius))`,
+		me, lat, lon, VisibilityPublic, VisibilityFollowers, VisibilityLocal, distanceSQL(lat, lon)), args
+}
+
+// VisiblePostOwner returns the author of a post if v may see it, and ErrNotFound otherwise:
+// when it doesn't exist, has expired, isn't out yet or is hidden from v.
+func (db *DBInterface) VisiblePostOwner(postID int, v Viewer) (int, error) {
+	visible, args := v.visibleClause([]interface{}{postID})
+	var userID int
+	err := db.pool.QueryRow(context.Background(), `
+		SELECT p.user_id FROM posts p
+		WHERE p.id = $1 AND `+postLiveClause+`
+		AND (p.user_id = $2 OR (`+postPublishedClause+` AND `+visible+`))`, args...).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("post ID %d: %w", postID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get owner of post ID %d: %w", postID, err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,42 @@
+package events
+
+import "sync"
+
+// PostPublished is raised once for every post that becomes visible to others: right after
+// creation for normal posts, at publish_at for scheduled ones
+type PostPublished struct {
+	PostID int
+	UserID int
+}
+
+// Bus hands events to whoever subscribed. A nil bus drops them.
+type Bus struct {
+	mu            sync.RWMutex
+	postPublished []func(PostPublished)
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// OnPostPublished subscribes fn to PostPublished events
+func (b *Bus) OnPostPublished(fn func(PostPublished)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.postPublished = append(b.postPublished, fn)
+}
+
+// PublishPost raises a PostPublished event, subscribers run synchronously in the order they subscribed
+func (b *Bus) PublishPost(e PostPublished) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	subscribers := b.postPublished
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
@@ -0,0 +1,201 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"SpotLight/backend/src/database"
+)
+
+// FormatVersion is bumped whenever the layout of the archive changes
+const FormatVersion = 1
+
+// manifestEntry describes one file in the archive
+type manifestEntry struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Count       int    `json:"count,omitempty"`
+	SizeBytes   int64  `json:"size_bytes,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// conversation is every DM exchanged with one other user
+type conversation struct {
+	With     database.UserProfile     `json:"with"`
+	Messages []map[string]interface{} `json:"messages"`
+}
+
+// archiveWriter adds files to the zip and keeps track of them for the manifest
+type archiveWriter struct {
+	zip     *zip.Writer
+	entries []manifestEntry
+	media   []manifestEntry
+}
+
+// writeJSON adds a JSON document to the archive
+func (a *archiveWriter) writeJSON(path, description string, count int, v interface{}) error {
+	w, err := a.zip.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	a.entries = append(a.entries, manifestEntry{Path: path, Description: description, Count: count})
+	return nil
+}
+
+// writeMedia copies every file in the user's upload folder into media/
+func (a *archiveWriter) writeMedia(folder string) error {
+	err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		name := "media/" + filepath.ToSlash(rel)
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := a.zip.Create(name)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		size, err := io.Copy(io.MultiWriter(dst, h), src)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", path, err)
+		}
+
+		a.media = append(a.media, manifestEntry{Path: name, SizeBytes: size, SHA256: hex.EncodeToString(h.Sum(nil))})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		// users who never uploaded anything have no folder
+		return nil
+	}
+	return err
+}
+
+// WriteArchive writes a zip of everything a user has put into SpotLight: profile, posts,
+// comments, likes, DMs, linked identities and uploaded media, described by manifest.json.
+func WriteArchive(db *database.DBInterface, fm *database.FileManager, userID int, out io.Writer) error {
+	profile, posts, err := db.GetUserPostsAs(userID, database.Viewer{UserID: userID})
+	if err != nil {
+		return err
+	}
+	if posts == nil {
+		posts = []map[string]interface{}{}
+	}
+
+	_, email, err := db.GetUserEmail(profile.Username)
+	if err != nil {
+		return err
+	}
+
+	comments, err := db.GetUserComments(userID)
+	if err != nil {
+		return err
+	}
+
+	likes, err := db.GetUserLikes(userID)
+	if err != nil {
+		return err
+	}
+
+	partners, err := db.GetConversationPartners(userID)
+	if err != nil {
+		return err
+	}
+	conversations := []conversation{}
+	messageCount := 0
+	for _, partner := range partners {
+		messages, err := db.GetMessages(userID, partner.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get messages with user ID %d: %w", partner.UserID, err)
+		}
+		messageCount += len(messages)
+		conversations = append(conversations, conversation{With: partner, Messages: messages})
+	}
+
+	identities, err := db.ListIdentities(userID)
+	if err != nil {
+		return err
+	}
+
+	a := &archiveWriter{zip: zip.NewWriter(out)}
+
+	account := map[string]interface{}{
+		"user_id":    profile.UserID,
+		"username":   profile.Username,
+		"email":      email,
+		"role":       profile.Role,
+		"created_at": profile.CreatedAt,
+	}
+	steps := []struct {
+		path, description string
+		count             int
+		value             interface{}
+	}{
+		{"profile.json", "Your account details", 0, account},
+		{"posts.json", "Posts you created", len(posts), posts},
+		{"comments.json", "Comments and replies you wrote", len(comments), comments},
+		{"likes.json", "Posts you liked", len(likes), likes},
+		{"messages.json", "Direct messages, grouped by the other person", messageCount, conversations},
+		{"identities.json", "External accounts linked for sign in", len(identities), identities},
+	}
+	for _, step := range steps {
+		if err := a.writeJSON(step.path, step.description, step.count, step.value); err != nil {
+			return err
+		}
+	}
+
+	if err := a.writeMedia(fm.UserFolder(userID)); err != nil {
+		return fmt.Errorf("failed to add media: %w", err)
+	}
+	if a.media == nil {
+		a.media = []manifestEntry{}
+	}
+	if err := a.writeJSON("media.json", "Files you uploaded, under media/<postId>/", len(a.media), a.media); err != nil {
+		return err
+	}
+
+	manifest := map[string]interface{}{
+		"format_version": FormatVersion,
+		"user_id":        userID,
+		"username":       profile.Username,
+		"generated_at":   time.Now().UTC().Format(time.RFC3339),
+		"files":          a.entries,
+	}
+	w, err := a.zip.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return a.zip.Close()
+}
@@ -0,0 +1,155 @@
+package export
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"SpotLight/backend/src/database"
+)
+
+// DefaultTTL is how long a finished archive can be downloaded
+const DefaultTTL = 7 * 24 * time.Hour
+
+// staleAfter is how long a job may sit in pending or running before it's considered lost
+const staleAfter = time.Hour
+
+// Manager builds data export archives in the background and cleans them up once they expire
+type Manager struct {
+	DB  *database.DBInterface
+	FM  *database.FileManager
+	Dir string        // where archives are written
+	TTL time.Duration // how long archives are kept, DefaultTTL when zero
+}
+
+// NewManager returns a manager writing archives into dir
+func NewManager(db *database.DBInterface, fm *database.FileManager, dir string) *Manager {
+	return &Manager{DB: db, FM: fm, Dir: dir, TTL: DefaultTTL}
+}
+
+// Request queues an export for a user and starts building it.
+// An export that's already in progress is returned as is.
+func (m *Manager) Request(userID int) (database.DataExport, error) {
+	e, created, err := m.DB.CreateDataExport(userID)
+	if err != nil {
+		return e, err
+	}
+	if created {
+		go m.run(e.ID, userID)
+	}
+	return e, nil
+}
+
+// Build runs an export job to completion, the same work Request does in the background
+func (m *Manager) Build(exportID, userID int) error {
+	started, err := m.DB.StartDataExport(exportID)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return fmt.Errorf("export ID %d is not pending", exportID)
+	}
+
+	path, size, err := m.writeArchive(exportID, userID)
+	if err != nil {
+		if failErr := m.DB.FailDataExport(exportID, "failed to build archive"); failErr != nil {
+			log.Printf("Failed to record failure of export %d: %v", exportID, failErr)
+		}
+		return err
+	}
+
+	ttl := m.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if err := m.DB.CompleteDataExport(exportID, path, size, time.Now().Add(ttl)); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// run builds an export in the background and logs failures
+func (m *Manager) run(exportID, userID int) {
+	if err := m.Build(exportID, userID); err != nil {
+		log.Printf("Data export %d for user %d failed: %v", exportID, userID, err)
+	}
+}
+
+// archivePath returns where the archive of an export is written
+func (m *Manager) archivePath(exportID, userID int) string {
+	return filepath.Join(m.Dir, fmt.Sprintf("export-%d-user-%d.zip", exportID, userID))
+}
+
+// partialPath returns where the archive of an export is built before it's moved into place
+func (m *Manager) partialPath(exportID, userID int) string {
+	return m.archivePath(exportID, userID) + ".partial"
+}
+
+// writeArchive writes the zip to a temporary file and moves it into place once complete
+func (m *Manager) writeArchive(exportID, userID int) (string, int64, error) {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return "", 0, err
+	}
+
+	final := m.archivePath(exportID, userID)
+	tmp, err := os.Create(m.partialPath(exportID, userID))
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteArchive(m.DB, m.FM, userID, tmp); err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), final); err != nil {
+		return "", 0, err
+	}
+	return final, info.Size(), nil
+}
+
+// Cleanup expires old archives and deletes their files, along with whatever a job that was
+// interrupted left behind
+func (m *Manager) Cleanup() error {
+	exports, err := m.DB.ExpireDataExports(staleAfter)
+	if err != nil {
+		return err
+	}
+	for _, e := range exports {
+		paths := []string{e.FilePath}
+		if e.Status == database.ExportFailed {
+			// the job may have died while building the archive or just after moving it into place
+			paths = []string{m.partialPath(e.ID, e.UserID), m.archivePath(e.ID, e.UserID)}
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete %s of export %d: %v", path, e.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// StartJanitor runs Cleanup every interval until the process exits
+func (m *Manager) StartJanitor(interval time.Duration) {
+	for {
+		if err := m.Cleanup(); err != nil {
+			log.Printf("Data export cleanup failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
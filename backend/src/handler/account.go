@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"SpotLight/backend/src/auth"
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/mail"
+)
+
+// passwordResetTTL is how long an emailed reset token can be used
+const passwordResetTTL = time.Hour
+
+// resetLimits slows down one address asking for reset mail, every request counts. They're
+// kept with the login failures under resetIPKey.
+var resetLimits = loginLimits{
+	freeFailures: 5,
+	baseDelay:    time.Minute,
+	maxDelay:     time.Hour,
+	lockStatus:   http.StatusTooManyRequests,
+}
+
+func resetIPKey(ip string) string { return "reset:ip:" + ip }
+
+// mailer returns the configured mail sender, or a log sender if none was set
+func (h *RequestHandler) mailer() mail.Sender {
+	if h.Mail == nil {
+		return mail.LogSender{}
+	}
+	return h.Mail
+}
+
+// HandleChangePassword changes the caller's password after checking the current one
+func (h *RequestHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, `{"message": "Current and new password are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.ChangePassword(userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, database.ErrWrongPassword) {
+			http.Error(w, `{"message": "Current password is incorrect"}`, http.StatusForbidden)
+			return
+		}
+		log.Printf("Failed to change password for user %d: %v", userID, err)
+		http.Error(w, `{"message": "Failed to change password"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// sign out other devices, they may belong to whoever knew the old password
+	if err := h.DB.RevokeAllSessions(userID, SessionIDFromContext(r.Context())); err != nil {
+		log.Printf("Failed to revoke other sessions for user %d: %v", userID, err)
+	}
+	h.SyncRevokedSessions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"})
+}
+
+// HandleRequestPasswordReset emails a single-use reset token to the account's address.
+// The response is the same whether or not the account exists, and is sent before the account
+// is looked up, so usernames can't be probed by its content or timing.
+func (h *RequestHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" {
+		http.Error(w, `{"message": "Username is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	lf, ok, err := h.DB.ReserveLoginAttempt(resetIPKey(clientIP(r)), loginFailureWindow, func(lf database.LoginFailures) bool {
+		status, _ := resetLimits.retryAfter(lf, now)
+		return status == 0
+	})
+	if err != nil {
+		log.Printf("Failed to check reset requests: %v", err)
+	} else if !ok {
+		_, wait := resetLimits.retryAfter(lf, now)
+		writeRetryAfter(w, http.StatusTooManyRequests, wait, "Too many reset requests, try again later")
+		return
+	}
+
+	go h.sendPasswordReset(req.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account has an email on file, a reset link has been sent",
+	})
+}
+
+// sendPasswordReset issues and mails a reset token, failures are only logged
+func (h *RequestHandler) sendPasswordReset(username string) {
+	userID, email, err := h.DB.GetUserEmail(username)
+	if err != nil {
+		log.Printf("Password reset requested for unknown user %s", username)
+		return
+	}
+	if email == "" {
+		log.Printf("Password reset requested for user %d with no email on file", userID)
+		return
+	}
+
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to generate reset token for user %d: %v", userID, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(passwordResetTTL)
+	if err := h.DB.CreatePasswordReset(userID, tokenHash, expiresAt); err != nil {
+		log.Printf("Failed to store reset token for user %d: %v", userID, err)
+		return
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nUse this code to reset your SpotLight password: %s\n\n"+
+		"It expires at %s and can only be used once. If you didn't ask for this you can ignore this email.",
+		username, token, expiresAt.Format(time.RFC1123))
+	if err := h.mailer().Send(email, "Reset your SpotLight password", body); err != nil {
+		log.Printf("Failed to send reset mail to user %d: %v", userID, err)
+	}
+}
+
+// HandleConfirmPasswordReset sets a new password using an emailed reset token
+func (h *RequestHandler) HandleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		http.Error(w, `{"message": "Token and new password are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.DB.ConsumePasswordReset(auth.HashOpaqueToken(req.Token), req.NewPassword)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidResetToken) {
+			http.Error(w, `{"message": "Reset token is invalid or expired"}`, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to reset password: %v", err)
+		http.Error(w, `{"message": "Failed to reset password"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.DB.RevokeAllSessions(userID, 0); err != nil {
+		log.Printf("Failed to revoke sessions for user %d after reset: %v", userID, err)
+	}
+	h.SyncRevokedSessions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
+
+// HandleChangeUsername renames the caller's account. The old name stays reserved for them for a while.
+func (h *RequestHandler) HandleChangeUsername(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	oldUsername, err := h.DB.RenameUser(userID, req.Username, database.UsernameCooldown)
+	if errors.Is(err, database.ErrInvalidUsername) {
+		http.Error(w, `{"message": "Usernames must be 3-30 letters, digits, underscores or dots and start with a letter or digit"}`, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, database.ErrUsernameTaken) {
+		http.Error(w, `{"message": "Username is not available"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to rename user %d: %v", userID, err)
+		http.Error(w, `{"message": "Failed to change username"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":      "Username changed successfully",
+		"username":     req.Username,
+		"old_username": oldUsername,
+	})
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// adminTargetUser parses the {id} of an admin user route and makes sure the caller outranks
+// that user, so moderators can't act on other moderators or admins. Writes the error response.
+func (h *RequestHandler) adminTargetUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	targetID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid user ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+
+	callerID, _ := UserIDFromContext(r.Context())
+	if targetID == callerID {
+		http.Error(w, `{"message": "Admin actions cannot target your own account"}`, http.StatusBadRequest)
+		return 0, false
+	}
+
+	targetRole, err := h.DB.GetUserRole(targetID)
+	if err != nil {
+		writeLookupError(w, err, "User")
+		return 0, false
+	}
+	if targetRole != database.RoleUser && !h.hasRole(callerID, database.RoleAdmin) {
+		http.Error(w, `{"message": "Only admins can act on staff accounts"}`, http.StatusForbidden)
+		return 0, false
+	}
+	return targetID, true
+}
+
+// HandleAdminListUsers lists users with their role and suspension state
+func (h *RequestHandler) HandleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(params.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	users, err := h.DB.ListUsers(params.Get("query"), limit, offset)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to list users"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// HandleAdminSuspendUser suspends a user for a number of hours, or indefinitely, and ends their sessions
+func (h *RequestHandler) HandleAdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+		Hours  int    `json:"hours"` // 0 means until lifted
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Hours < 0 {
+		http.Error(w, `{"message": "Hours cannot be negative"}`, http.StatusBadRequest)
+		return
+	}
+
+	var until *time.Time
+	if req.Hours > 0 {
+		t := time.Now().Add(time.Duration(req.Hours) * time.Hour)
+		until = &t
+	}
+
+	if err := h.DB.SuspendUser(targetID, req.Reason, until); err != nil {
+		writeLookupError(w, err, "User")
+		return
+	}
+	h.SyncRevokedSessions()
+
+	callerID, _ := UserIDFromContext(r.Context())
+	log.Printf("Moderator %d suspended user %d (hours=%d): %s", callerID, targetID, req.Hours, req.Reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User suspended"})
+}
+
+// HandleAdminUnsuspendUser lifts a user's suspension
+func (h *RequestHandler) HandleAdminUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.UnsuspendUser(targetID); err != nil {
+		writeLookupError(w, err, "User")
+		return
+	}
+
+	callerID, _ := UserIDFromContext(r.Context())
+	log.Printf("Moderator %d lifted suspension of user %d", callerID, targetID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User unsuspended"})
+}
+
+// HandleAdminSetRole changes a user's role
+func (h *RequestHandler) HandleAdminSetRole(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+	if !database.ValidRole(req.Role) {
+		http.Error(w, `{"message": "Unknown role"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SetUserRole(targetID, req.Role); err != nil {
+		writeLookupError(w, err, "User")
+		return
+	}
+
+	callerID, _ := UserIDFromContext(r.Context())
+	log.Printf("Admin %d set role of user %d to %s", callerID, targetID, req.Role)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated"})
+}
+
+// HandleAdminDeleteUser removes any account along with its media folder
+func (h *RequestHandler) HandleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	username, err := h.DB.GetUserNameId(targetID)
+	if err != nil {
+		http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := h.DB.DeleteUser(username); err != nil {
+		http.Error(w, `{"message": "Failed to delete user"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.FM.DeleteUserFolder(targetID); err != nil {
+		http.Error(w, `{"message": "Failed to delete user's folder"}`, http.StatusInternalServerError)
+		return
+	}
+
+	callerID, _ := UserIDFromContext(r.Context())
+	log.Printf("Admin %d deleted user %d (%s)", callerID, targetID, username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
+}
+
+// HandleAdminDeletePost force-deletes any post
+func (h *RequestHandler) HandleAdminDeletePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := h.DB.GetPostOwner(postID)
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return
+	}
+
+	if err := h.DB.DeletePost(postID); err != nil {
+		http.Error(w, `{"message": "Failed to delete post"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := h.FM.DeletePostFolder(ownerID, postID); err != nil {
+		log.Printf("Failed to delete files of post %d: %v", postID, err)
+	}
+
+	callerID, _ := UserIDFromContext(r.Context())
+	log.Printf("Moderator %d deleted post %d", callerID, postID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Post deleted successfully"})
+}
+
+// HandleAdminDeleteComment force-deletes any comment and its replies
+func (h *RequestHandler) HandleAdminDeleteComment(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid comment ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.DB.GetCommentOwner(commentID); err != nil {
+		writeLookupError(w, err, "Comment")
+		return
+	}
+
+	if err := h.DB.DeleteComment(commentID); err != nil {
+		http.Error(w, `{"message": "Failed to delete comment"}`, http.StatusInternalServerError)
+		return
+	}
+
+	callerID, _ := UserIDFromContext(r.Context())
+	log.Printf("Moderator %d deleted comment %d", callerID, commentID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted"})
+}
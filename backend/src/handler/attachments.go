@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"SpotLight/backend/src/database"
+)
+
+// attachmentRequest is one entry of the attachments list in a create or edit request.
+// New files carry file_name and media, on edit an attachment_id keeps an existing one.
+type attachmentRequest struct {
+	AttachmentID int    `json:"attachment_id"`
+	FileName     string `json:"file_name"`
+	Media        string `json:"media"`
+}
+
+// upload is a file waiting to be written to a post's folder, either decoded from JSON into
+// memory or already streamed to a staging file by a multipart request
+type upload struct {
+	meta   database.Attachment
+	data   []byte
+	staged string
+}
+
+// decodeUploads validates and decodes the new files of an attachments list. Names in taken
+// are already used by the post. On failure it returns the status and a message for the client.
+func decodeUploads(reqs []attachmentRequest, taken map[string]bool, maxBytes int64) ([]upload, int, string) {
+	uploads := []upload{}
+	for _, a := range reqs {
+		if a.AttachmentID != 0 {
+			continue
+		}
+		if a.FileName == "" || a.Media == "" {
+			return nil, http.StatusBadRequest, "Each attachment needs a file_name and media"
+		}
+		if a.FileName != filepath.Base(a.FileName) || a.FileName == "." || a.FileName == ".." {
+			return nil, http.StatusBadRequest, "Invalid filename"
+		}
+		if taken[a.FileName] {
+			return nil, http.StatusBadRequest, "Each attachment needs a new, unique filename"
+		}
+		taken[a.FileName] = true
+
+		data, err := decodeMedia(a.FileName, a.Media)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid media encoding"
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is larger than %d bytes", a.FileName, maxBytes)
+		}
+		uploads = append(uploads, upload{meta: attachmentMeta(a.FileName, int64(len(data)), bytes.NewReader(data)), data: data})
+	}
+	return uploads, 0, ""
+}
+
+// attachmentMeta works out what we store about a file: its type from the content, falling
+// back to the extension, and for images the dimensions. Only the start of r is read.
+func attachmentMeta(fileName string, size int64, r io.Reader) database.Attachment {
+	meta := database.Attachment{FileName: fileName, SizeBytes: size}
+
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	meta.MimeType = http.DetectContentType(head)
+	if strings.HasPrefix(meta.MimeType, "application/octet-stream") || strings.HasPrefix(meta.MimeType, "text/plain") {
+		if byExt := mime.TypeByExtension(filepath.Ext(fileName)); byExt != "" {
+			meta.MimeType = byExt
+		}
+	}
+
+	if strings.HasPrefix(meta.MimeType, "image/") {
+		if cfg, _, err := image.DecodeConfig(br); err == nil {
+			meta.Width, meta.Height = &cfg.Width, &cfg.Height
+		}
+	}
+	return meta
+}
+
+// storeUploads writes files into a post's folder. If one fails the ones already written are removed.
+func (h *RequestHandler) storeUploads(userID, postID int, uploads []upload) ([]database.Attachment, error) {
+	stored := make([]database.Attachment, 0, len(uploads))
+	for _, u := range uploads {
+		var err error
+		if u.staged != "" {
+			err = h.FM.CommitUpload(u.staged, userID, postID, u.meta.FileName)
+		} else {
+			err = h.FM.CreatePostFile(userID, postID, u.meta.FileName, u.data)
+		}
+		if err != nil {
+			h.removeAttachmentFiles(userID, postID, stored)
+			return nil, err
+		}
+		stored = append(stored, u.meta)
+	}
+	return stored, nil
+}
+
+// removeAttachmentFiles deletes attachment files, logging rather than failing on errors
+func (h *RequestHandler) removeAttachmentFiles(userID, postID int, attachments []database.Attachment) {
+	for _, a := range attachments {
+		if err := h.FM.DeletePostFile(userID, postID, a.FileName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to delete %s of post %d: %v", a.FileName, postID, err)
+		}
+	}
+}
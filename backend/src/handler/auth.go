@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"SpotLight/backend/src/auth"
+)
+
+type contextKey string
+
+const (
+	userIDKey    contextKey = "userID"
+	sessionIDKey contextKey = "sessionID"
+)
+
+// WithUserID returns a copy of ctx carrying the authenticated user ID
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user ID, if any
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok && userID != 0
+}
+
+// SessionIDFromContext returns the session the caller's access token belongs to
+func SessionIDFromContext(ctx context.Context) int {
+	sessionID, _ := ctx.Value(sessionIDKey).(int)
+	return sessionID
+}
+
+// bearerToken pulls the session token from the Authorization header,
+// or from the token query param for WebSocket upgrades (browsers can't set headers there)
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	if r.URL.Path == "/ws" {
+		return r.URL.Query().Get("token")
+	}
+	return ""
+}
+
+// AuthMiddleware turns a Bearer token into the caller's identity on the request context.
+// Requests without a token pass through anonymously, requests with a bad token or one from a
+// revoked session are rejected.
+func (h *RequestHandler) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := auth.ParseToken(token)
+		if err != nil || sessionRevoked(claims.SessionID) {
+			http.Error(w, `{"message": "Invalid or expired session token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		ctx := WithUserID(r.Context(), claims.UserID)
+		ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireUser returns the authenticated user ID or writes a 401 response
+func requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"message": "Authentication required"}`, http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
+
+// requireMatchingUser authenticates the caller and rejects a client-supplied ID that isn't theirs.
+// A zero claimedID means the client left it out, which is fine.
+func requireMatchingUser(w http.ResponseWriter, r *http.Request, claimedID int) (int, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return 0, false
+	}
+	if claimedID != 0 && claimedID != userID {
+		http.Error(w, `{"message": "user_id does not match authenticated user"}`, http.StatusForbidden)
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// hasRole reports whether a user's role ranks at least minRole
+func (h *RequestHandler) hasRole(userID int, minRole string) bool {
+	role, err := h.DB.GetUserRole(userID)
+	if err != nil {
+		log.Printf("Failed to get role for user %d: %v", userID, err)
+		return false
+	}
+	return database.RoleAtLeast(role, minRole)
+}
+
+// RequireRole is a middleware guard that only lets users with at least minRole through
+func (h *RequestHandler) RequireRole(minRole string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := requireUser(w, r)
+			if !ok {
+				return
+			}
+			if !h.hasRole(userID, minRole) {
+				http.Error(w, `{"message": "`+minRole+` role required"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeContent lets the author of a post or comment, or a moderator, act on it.
+// Writes a 403 and returns false otherwise.
+func (h *RequestHandler) authorizeContent(w http.ResponseWriter, callerID, ownerID int) bool {
+	if callerID == ownerID || h.hasRole(callerID, database.RoleModerator) {
+		return true
+	}
+	http.Error(w, `{"message": "You do not have permission to modify this content"}`, http.StatusForbidden)
+	return false
+}
+
+// authorizeAccount lets a user act on their own account, or an admin act on anyone's.
+// Writes a 403 and returns false otherwise.
+func (h *RequestHandler) authorizeAccount(w http.ResponseWriter, callerID, accountID int) bool {
+	if callerID == accountID || h.hasRole(callerID, database.RoleAdmin) {
+		return true
+	}
+	http.Error(w, `{"message": "You do not have permission to modify this account"}`, http.StatusForbidden)
+	return false
+}
+
+// writeLookupError maps an owner lookup failure to a 404 or 500
+func writeLookupError(w http.ResponseWriter, err error, what string) {
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, `{"message": "`+what+` not found"}`, http.StatusNotFound)
+		return
+	}
+	http.Error(w, `{"message": "Failed to look up `+strings.ToLower(what)+`"}`, http.StatusInternalServerError)
+}
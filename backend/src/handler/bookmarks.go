@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleBookmarkPost saves a post for the caller, optionally into one of their collections.
+// Bookmarking an already saved post moves it to the collection given, or out of any.
+func (h *RequestHandler) HandleBookmarkPost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		CollectionID int `json:"collection_id"` // zero keeps the bookmark outside any collection
+	}
+	// the body is optional
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
+	if err := h.DB.BookmarkPost(userID, postID, req.CollectionID); err != nil {
+		writeLookupError(w, err, "Collection")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Post bookmarked"})
+}
+
+// HandleUnbookmarkPost removes a post from the caller's bookmarks
+func (h *RequestHandler) HandleUnbookmarkPost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.UnbookmarkPost(userID, postID); err != nil {
+		http.Error(w, `{"message": "Failed to unbookmark post"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Post unbookmarked"})
+}
+
+// HandleGetBookmarks returns a page of the caller's bookmarked posts, newest bookmark first,
+// from one collection when collection_id is given. Takes limit and offset like HandleGetPosts.
+func (h *RequestHandler) HandleGetBookmarks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireUser(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	collectionID := 0
+	if s := query.Get("collection_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id <= 0 {
+			http.Error(w, `{"message": "Invalid collection ID"}`, http.StatusBadRequest)
+			return
+		}
+		collectionID = id
+	}
+	limit, offset := pageFromQuery(query)
+
+	posts, err := h.DB.GetBookmarks(viewer(r), collectionID, limit, offset)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to retrieve bookmarks"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// HandleListBookmarkCollections returns the caller's bookmark collections
+func (h *RequestHandler) HandleListBookmarkCollections(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	collections, err := h.DB.ListBookmarkCollections(userID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to list collections"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// HandleCreateBookmarkCollection adds a named collection for the caller
+func (h *RequestHandler) HandleCreateBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := h.DB.CreateBookmarkCollection(userID, req.Name)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Collection created", "collection_id": id})
+}
+
+// HandleRenameBookmarkCollection renames one of the caller's collections
+func (h *RequestHandler) HandleRenameBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	collectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid collection ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.RenameBookmarkCollection(userID, collectionID, req.Name); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Collection renamed"})
+}
+
+// HandleDeleteBookmarkCollection deletes one of the caller's collections, keeping its bookmarks
+func (h *RequestHandler) HandleDeleteBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	collectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid collection ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.DeleteBookmarkCollection(userID, collectionID); err != nil {
+		writeLookupError(w, err, "Collection")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Collection deleted"})
+}
+
+// writeCollectionError maps a failure creating or renaming a collection to a response
+func writeCollectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrInvalidCollectionName):
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+	case errors.Is(err, database.ErrCollectionExists):
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusConflict)
+	default:
+		writeLookupError(w, err, "Collection")
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"SpotLight/backend/src/database"
+)
+
+// clusterMaxAge is how long, in seconds, clients and caches may reuse a tile's clusters
+const clusterMaxAge = 60
+
+// HandleGetPostClusters returns the posts in a viewport grouped into clusters for a map at low
+// zoom. Takes bbox, which is required, and zoom, along with the location, sort and time
+// parameters of HandleGetPosts. The clusters come back tile by tile; the bbox of a tile asks
+// for just that tile, which is how clients should request them to cache each one.
+func (h *RequestHandler) HandleGetPostClusters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !query.Has("bbox") {
+		http.Error(w, `{"message": "bbox is required"}`, http.StatusBadRequest)
+		return
+	}
+	f, err := postFilterFromQuery(query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	zoom, err := strconv.Atoi(query.Get("zoom"))
+	if err != nil {
+		zoom = -1 // rejected below with the valid range
+	}
+	// an invalid zoom or a viewport too large for it
+	if _, err := database.TilesFor(f.BBox, zoom); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	viewerID, _ := UserIDFromContext(r.Context())
+	tiles, err := h.DB.ClusterPosts(database.ViewerAt(viewerID, f.Latitude, f.Longitude), f, zoom)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to cluster posts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// what the caller may see depends on who they are, so only their own cache may keep it then
+	scope := "public"
+	if viewerID != 0 {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, clusterMaxAge))
+	w.Header().Set("Vary", "Authorization")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"zoom": zoom, "tiles": tiles})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleRequestExport starts building an archive of the caller's data
+func (h *RequestHandler) HandleRequestExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if h.Exports == nil {
+		http.Error(w, `{"message": "Data export is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	export, err := h.Exports.Request(userID)
+	if err != nil {
+		log.Printf("Failed to request export for user %d: %v", userID, err)
+		http.Error(w, `{"message": "Failed to start data export"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+// HandleListExports lists the caller's data exports
+func (h *RequestHandler) HandleListExports(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	exports, err := h.DB.ListDataExports(userID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to list data exports"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"exports": exports})
+}
+
+// HandleGetExport reports the status of one of the caller's exports
+func (h *RequestHandler) HandleGetExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := h.callerExport(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(export)
+}
+
+// HandleDownloadExport sends a finished archive
+func (h *RequestHandler) HandleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := h.callerExport(w, r)
+	if !ok {
+		return
+	}
+
+	switch export.Status {
+	case database.ExportReady:
+	case database.ExportExpired:
+		http.Error(w, `{"message": "This export has expired, please request a new one"}`, http.StatusGone)
+		return
+	case database.ExportFailed:
+		http.Error(w, `{"message": "This export failed, please request a new one"}`, http.StatusConflict)
+		return
+	default:
+		http.Error(w, `{"message": "This export is not ready yet"}`, http.StatusConflict)
+		return
+	}
+
+	// the janitor may not have caught up with an archive that just expired
+	if export.ExpiresAt != nil {
+		if expiresAt, err := time.Parse(time.RFC3339, *export.ExpiresAt); err == nil && time.Now().After(expiresAt) {
+			http.Error(w, `{"message": "This export has expired, please request a new one"}`, http.StatusGone)
+			return
+		}
+	}
+
+	file, err := os.Open(export.FilePath)
+	if err != nil {
+		log.Printf("Failed to open export %d: %v", export.ID, err)
+		http.Error(w, `{"message": "Export archive is missing, please request a new one"}`, http.StatusGone)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="spotlight-export-`+strconv.Itoa(export.ID)+`.zip"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(export.SizeBytes, 10))
+	http.ServeContent(w, r, "", time.Time{}, file)
+}
+
+// callerExport loads the export in the path if it belongs to the caller, writing an error otherwise
+func (h *RequestHandler) callerExport(w http.ResponseWriter, r *http.Request) (database.DataExport, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return database.DataExport{}, false
+	}
+
+	exportID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid export ID"}`, http.StatusBadRequest)
+		return database.DataExport{}, false
+	}
+
+	// other users' exports look the same as missing ones
+	export, err := h.DB.GetDataExport(userID, exportID)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, `{"message": "Export not found"}`, http.StatusNotFound)
+		return database.DataExport{}, false
+	}
+	if err != nil {
+		http.Error(w, `{"message": "Failed to look up export"}`, http.StatusInternalServerError)
+		return database.DataExport{}, false
+	}
+	return export, true
+}
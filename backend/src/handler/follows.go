@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleFollowUser makes the caller follow a user, which lets them see that user's
+// followers-only posts
+func (h *RequestHandler) HandleFollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Follow(userID, followeeID); err != nil {
+		switch {
+		case errors.Is(err, database.ErrSelfFollow):
+			http.Error(w, `{"message": "You can't follow yourself"}`, http.StatusBadRequest)
+		case errors.Is(err, database.ErrNotFound):
+			http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+		default:
+			http.Error(w, `{"message": "Failed to follow user"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "User followed"})
+}
+
+// HandleUnfollowUser stops the caller following a user
+func (h *RequestHandler) HandleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Unfollow(userID, followeeID); err != nil {
+		http.Error(w, `{"message": "Failed to unfollow user"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "User unfollowed"})
+}
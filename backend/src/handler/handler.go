@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,8 +16,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/events"
+	"SpotLight/backend/src/export"
+	"SpotLight/backend/src/mail"
+	"SpotLight/backend/src/oidc"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -24,8 +30,23 @@ import (
 
 // RequestHandler manages API requests
 type RequestHandler struct {
-	DB *database.DBInterface
-	FM *database.FileManager
+	DB   *database.DBInterface
+	FM   *database.FileManager
+	Mail mail.Sender // falls back to logging mail when nil
+
+	// OIDC holds the external login providers by name
+	OIDC map[string]*oidc.Provider
+	// OIDCFrontendURL receives tokens after a provider login, defaults to the local frontend
+	OIDCFrontendURL string
+
+	// Exports builds personal data archives, export routes answer 503 when nil
+	Exports *export.Manager
+
+	// Uploads bounds post uploads, zero values fall back to the defaults
+	Uploads UploadLimits
+
+	// Events tells the rest of the app about new posts, events are dropped when nil
+	Events *events.Bus
 }
 
 // HandleRegister processes user registration
@@ -33,6 +54,7 @@ func (h *RequestHandler) HandleRegister(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Email    string `json:"email"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -45,7 +67,16 @@ func (h *RequestHandler) HandleRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.DB.Register(req.Username, req.Password); err != nil {
+	if err := database.ValidateUsername(req.Username); err != nil {
+		http.Error(w, `{"message": "Usernames must be 3-30 letters, digits, underscores or dots and start with a letter or digit"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.RegisterWithEmail(req.Username, req.Password, req.Email); err != nil {
+		if errors.Is(err, database.ErrUsernameTaken) {
+			http.Error(w, `{"message": "Username is not available"}`, http.StatusConflict)
+			return
+		}
 		http.Error(w, `{"message": "User registration failed"}`, http.StatusInternalServerError)
 		return
 	}
@@ -71,16 +102,34 @@ func (h *RequestHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := clientIP(r)
+	reserved, ok := h.reserveLoginAttempt(w, req.Username, ip)
+	if !ok {
+		return
+	}
+
 	userID, err := h.DB.Authenticate(req.Username, req.Password)
+	if errors.Is(err, database.ErrAccountSuspended) {
+		h.loginSucceeded(req.Username, ip)
+		http.Error(w, `{"message": "This account has been suspended"}`, http.StatusForbidden)
+		return
+	}
 	if err != nil {
+		h.loginFailed(req.Username, ip, reserved)
 		http.Error(w, `{"message": "Invalid username or password"}`, http.StatusUnauthorized)
 		return
 	}
+	h.loginSucceeded(req.Username, ip)
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successful",
-		"user_id": userID,
-	})
+	tokens, err := h.startSession(r, userID)
+	if err != nil {
+		log.Printf("Failed to start session for user %d: %v", userID, err)
+		http.Error(w, `{"message": "Failed to create session"}`, http.StatusInternalServerError)
+		return
+	}
+
+	tokens["message"] = "Login successful"
+	json.NewEncoder(w).Encode(tokens)
 }
 
 // HandleDeleteUser processes user deletion
@@ -99,13 +148,27 @@ func (h *RequestHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	callerID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	accountID, err := h.DB.GetUserIdByName(req.Username)
+	if err != nil {
+		writeLookupError(w, err, "User")
+		return
+	}
+	if !h.authorizeAccount(w, callerID, accountID) {
+		return
+	}
+
 	if err := h.DB.DeleteUser(req.Username); err != nil {
 		http.Error(w, `{"message": "Failed to delete user"}`, http.StatusInternalServerError)
 		return
 	}
 
 	// if we delete user, we also delete associated folder
-	if err := h.FM.DeleteUserFolder(req.Username); err != nil {
+	if err := h.FM.DeleteUserFolder(accountID); err != nil {
 		http.Error(w, `{"message": "Failed to delete user's folder"}`, http.StatusInternalServerError)
 		return
 	}
@@ -115,71 +178,263 @@ func (h *RequestHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
 }
 
+// Bounds on expires_in for ephemeral posts
+const (
+	MinPostTTL = time.Minute
+	MaxPostTTL = 30 * 24 * time.Hour
+)
+
+// MaxScheduleAhead is how far in the future publish_at may be
+const MaxScheduleAhead = 365 * 24 * time.Hour
+
 // HandleCreatePost processes creating a post
 func (h *RequestHandler) HandleCreatePost(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		UserID    int     `json:"user_id"`
-		Content   string  `json:"content"`
-		FileName  string  `json:"file_name"`
-		Media     string  `json:"media"`
-		Latitude  float64 `json:"latitude"`
-		Longitude float64 `json:"longitude"`
+		UserID      int                 `json:"user_id"`
+		Content     string              `json:"content"`
+		FileName    string              `json:"file_name"`
+		Media       string              `json:"media"`
+		Attachments []attachmentRequest `json:"attachments"`
+		Latitude    float64             `json:"latitude"`
+		Longitude   float64             `json:"longitude"`
+		ExpiresIn   int64               `json:"expires_in"`   // seconds, zero keeps the post
+		PublishAt   string              `json:"publish_at"`   // RFC 3339, empty publishes right away
+		Visibility  string              `json:"visibility"`   // public when empty
+		LocalRadius int                 `json:"local_radius"` // meters, for local posts
+		// exact, 100m, neighborhood or city, how others see the location
+		LocationPrecision string       `json:"location_precision"`
+		Poll              *pollRequest `json:"poll"`
+		RepostOf          int          `json:"repost_of"`   // post ID this reposts or quotes
+		RepostKind        string       `json:"repost_kind"` // repost or quote
+	}
+
+	if !h.limitBody(w, r) {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
-		return
+	var uploads []upload
+	if isMultipart(r) {
+		// check the token before accepting any file data
+		if _, ok := requireUser(w, r); !ok {
+			return
+		}
+		fields, staged, ok := h.readMultipartPost(w, r)
+		if !ok {
+			return
+		}
+		uploads = staged
+		// committed files have already moved out of staging, this only catches failures
+		defer h.discardUploads(uploads)
+
+		// like the JSON body, absent fields are zero
+		var err error
+		if fields["user_id"] != "" {
+			req.UserID, err = strconv.Atoi(fields["user_id"])
+		}
+		if err == nil && fields["latitude"] != "" {
+			req.Latitude, err = strconv.ParseFloat(fields["latitude"], 64)
+		}
+		if err == nil && fields["longitude"] != "" {
+			req.Longitude, err = strconv.ParseFloat(fields["longitude"], 64)
+		}
+		if err == nil && fields["expires_in"] != "" {
+			req.ExpiresIn, err = strconv.ParseInt(fields["expires_in"], 10, 64)
+		}
+		if err == nil && fields["local_radius"] != "" {
+			req.LocalRadius, err = strconv.Atoi(fields["local_radius"])
+		}
+		if err == nil && fields["repost_of"] != "" {
+			req.RepostOf, err = strconv.Atoi(fields["repost_of"])
+		}
+		req.RepostKind = fields["repost_kind"]
+		req.PublishAt = fields["publish_at"]
+		req.Visibility = fields["visibility"]
+		req.LocationPrecision = fields["location_precision"]
+		if err == nil && fields["poll"] != "" {
+			err = json.Unmarshal([]byte(fields["poll"]), &req.Poll)
+		}
+		if err != nil {
+			http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+			return
+		}
+		req.Content = fields["content"]
+	} else {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				http.Error(w, fmt.Sprintf(`{"message": "Request is larger than %d bytes"}`, tooBig.Limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+			return
+		}
+
+		// the single file_name/media pair from older clients is a one item attachments list
+		if req.FileName != "" && req.Media != "" {
+			req.Attachments = append([]attachmentRequest{{FileName: req.FileName, Media: req.Media}}, req.Attachments...)
+		} else if req.FileName != "" && req.FileName != filepath.Base(req.FileName) {
+			http.Error(w, `{"message": "Invalid filename"}`, http.StatusBadRequest)
+			return
+		}
+		if len(req.Attachments) > database.MaxAttachments {
+			http.Error(w, fmt.Sprintf(`{"message": "A post can have at most %d attachments"}`, database.MaxAttachments), http.StatusBadRequest)
+			return
+		}
+		for _, a := range req.Attachments {
+			if a.AttachmentID != 0 {
+				http.Error(w, `{"message": "New posts can't reference existing attachments"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		var status int
+		var msg string
+		uploads, status, msg = decodeUploads(req.Attachments, map[string]bool{}, h.uploadLimits().MaxFileBytes)
+		if msg != "" {
+			http.Error(w, fmt.Sprintf(`{"message": %q}`, msg), status)
+			return
+		}
 	}
 
-	if req.UserID == 0 || req.Content == "" {
-		http.Error(w, `{"message": "User ID and content are required"}`, http.StatusBadRequest)
+	userID, ok := requireMatchingUser(w, r, req.UserID)
+	if !ok {
 		return
 	}
+	req.UserID = userID
 
-	if req.FileName != "" && req.Media != "" { // have fileName
-		if err := h.DB.CreatePostFile(req.UserID, req.Content, req.Latitude, req.Longitude, req.FileName); err != nil {
-			http.Error(w, `{"message": "Failed to create post"}`, http.StatusInternalServerError)
+	// a plain repost may say nothing of its own
+	if req.RepostOf != 0 || req.RepostKind != "" {
+		if req.RepostOf <= 0 {
+			http.Error(w, `{"message": "repost_of must be a post ID"}`, http.StatusBadRequest)
 			return
 		}
-		// after putting post in database, search for it and get it's id so we put the file in the fileList
-		lastPostVal, err1 := h.DB.GetLastPostByUser(req.UserID)
-		if err1 != nil {
-			http.Error(w, `{"message": "Failed to get last post"}`, http.StatusInternalServerError)
+		if err := database.ValidateRepost(req.RepostKind, req.Content); err != nil {
+			http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
 			return
 		}
-		userName, err1 := h.DB.GetUserNameId(req.UserID)
-		if err1 != nil {
-			http.Error(w, `{"message": "Failed to get userId"}`, http.StatusInternalServerError)
+	} else if req.Content == "" {
+		http.Error(w, `{"message": "Content is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var publishAt *time.Time
+	if req.PublishAt != "" {
+		t, ok := parsePublishAt(w, req.PublishAt)
+		if !ok {
 			return
 		}
+		publishAt = &t
+	}
 
-		// if file is text do simple convert, if binary conv base 64
-		ext := filepath.Ext(req.FileName)
-		var data []byte //var data []byte = []byte(req.Media)
-		var err error
-		if ext == ".txt" {
-			data = []byte(req.Media)
-		} else {
-			data, err = base64.StdEncoding.DecodeString(req.Media)
-			if err != nil {
-				fmt.Printf("Error decoding base64: %v\n", err)
-				return
-			}
+	// the lifetime of a scheduled post starts when it goes out
+	var expiresAt *time.Time
+	if req.ExpiresIn != 0 {
+		ttl := time.Duration(req.ExpiresIn) * time.Second
+		if ttl < MinPostTTL || ttl > MaxPostTTL {
+			http.Error(w, fmt.Sprintf(`{"message": "expires_in must be between %d and %d seconds"}`,
+				int64(MinPostTTL.Seconds()), int64(MaxPostTTL.Seconds())), http.StatusBadRequest)
+			return
+		}
+		t := time.Now().Add(ttl)
+		if publishAt != nil {
+			t = publishAt.Add(ttl)
 		}
+		expiresAt = &t
+	}
 
-		//h.FM.CreatePostFile(strconv.Itoa(req.UserID), lastPostVal, req.FileName, data)
-		h.FM.CreatePostFile(userName, lastPostVal, req.FileName, data)
+	if !checkVisibility(w, req.Visibility, req.LocalRadius) {
+		return
+	}
+	if err := database.ValidateLocation(req.Latitude, req.Longitude); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := database.ValidatePrecision(req.LocationPrecision); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
 
-	} else {
-		// Create post basic
-		if err := h.DB.CreatePost(req.UserID, req.Content, req.Latitude, req.Longitude); err != nil {
-			http.Error(w, `{"message": "Failed to create post"}`, http.StatusInternalServerError)
+	var poll *database.NewPoll
+	if req.Poll != nil {
+		if poll, ok = parsePoll(w, *req.Poll, publishAt); !ok {
+			return
+		}
+	}
+
+	metas := make([]database.Attachment, 0, len(uploads))
+	for _, u := range uploads {
+		metas = append(metas, u.meta)
+	}
+
+	// files are written inside the transaction, under the ID the insert returned
+	var filesPostID int
+	newPost := database.NewPost{
+		UserID:      req.UserID,
+		Content:     req.Content,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+		PublishAt:   publishAt,
+		ExpiresAt:   expiresAt,
+		Visibility:  req.Visibility,
+		LocalRadius: req.LocalRadius,
+		Attachments: metas,
+
+		LocationPrecision: req.LocationPrecision,
+		Poll:              poll,
+		RepostOf:          req.RepostOf,
+		RepostKind:        req.RepostKind,
+	}
+	postID, err := h.DB.SavePost(newPost, func(postID int) error {
+		if len(uploads) == 0 {
+			return nil
+		}
+		if _, err := h.storeUploads(req.UserID, postID, uploads); err != nil {
+			return err
+		}
+		filesPostID = postID
+		return nil
+	})
+	if err != nil {
+		// the commit failed after the files were written
+		if filesPostID != 0 {
+			if err := h.FM.DeletePostFolder(req.UserID, filesPostID); err != nil {
+				log.Printf("Failed to remove files of uncreated post %d: %v", filesPostID, err)
+			}
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, `{"message": "Original post not found"}`, http.StatusNotFound)
 			return
 		}
+		log.Printf("Failed to create post for user %d: %v", req.UserID, err)
+		http.Error(w, `{"message": "Failed to create post"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// scheduled posts are announced by the scheduler when they go out
+	if publishAt == nil {
+		h.Events.PublishPost(events.PostPublished{PostID: postID, UserID: req.UserID})
 	}
 
+	post, err := h.DB.GetPostByIdAs(postID, database.Viewer{UserID: req.UserID})
+	if err != nil {
+		// the post exists, so still report success with what we know
+		log.Printf("Failed to load created post %d: %v", postID, err)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Post created successfully", "post_id": postID})
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/posts/%d", postID))
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Post created successfully"})
+	json.NewEncoder(w).Encode(post)
+}
+
+// decodeMedia turns the media field of a post request into file bytes.
+// Text files are sent as is, anything else is base64.
+func decodeMedia(fileName, media string) ([]byte, error) {
+	if filepath.Ext(fileName) == ".txt" {
+		return []byte(media), nil
+	}
+	return base64.StdEncoding.DecodeString(media)
 }
 
 // HandleGetPosts retrieves all posts with optional geo-filtering
@@ -190,7 +445,25 @@ func (h *RequestHandler) HandleGetPosts(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	params := parsedURL.Query()
+	f, err := postFilterFromQuery(parsedURL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	h.writeFeed(w, r, f)
+}
+
+// postFilterFromQuery reads the location, paging, sort and time parameters of a feed request,
+// falling back to the defaults for anything missing or invalid. Only a malformed bbox is an
+// error, since a viewport can't sensibly be guessed.
+func postFilterFromQuery(params url.Values) (database.PostFilter, error) {
+	var bbox []database.Box
+	if params.Has("bbox") {
+		var err error
+		if bbox, err = database.ParseBBox(params.Get("bbox")); err != nil {
+			return database.PostFilter{}, err
+		}
+	}
 
 	latitude, err := strconv.ParseFloat(params.Get("latitude"), 64)
 	if err != nil {
@@ -207,18 +480,7 @@ func (h *RequestHandler) HandleGetPosts(w http.ResponseWriter, r *http.Request)
 		distance = -1 // Use -1 to signify default distance in DB function
 	}
 
-	// Parse limit and offset for pagination
-	limitStr := params.Get("limit")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = 20 // Default limit
-	}
-
-	offsetStr := params.Get("offset")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0 // Default offset
-	}
+	limit, offset := pageFromQuery(params)
 
 	// Parse sort order
 	sortOrder := strings.ToLower(params.Get("sort"))
@@ -238,8 +500,37 @@ func (h *RequestHandler) HandleGetPosts(w http.ResponseWriter, r *http.Request)
 		timeFilter = "all" // Default time filter
 	}
 
-	// Fetch posts using the DB function with all parameters
-	posts, err := h.DB.GetPosts(latitude, longitude, distance, limit, offset, sortOrder, timeFilter)
+	return database.PostFilter{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Distance:  distance,
+		Limit:     limit,
+		Offset:    offset,
+		Sort:      sortOrder,
+		Time:      timeFilter,
+		BBox:      bbox,
+	}, nil
+}
+
+// pageFromQuery reads the limit and offset of a paginated request
+func pageFromQuery(params url.Values) (limit, offset int) {
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20 // Default limit
+	}
+
+	offset, err = strconv.Atoi(params.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0 // Default offset
+	}
+	return limit, offset
+}
+
+// writeFeed answers with the posts matching f that the caller may see. Local-only posts are
+// matched against the same location the feed is filtered around.
+func (h *RequestHandler) writeFeed(w http.ResponseWriter, r *http.Request, f database.PostFilter) {
+	viewerID, _ := UserIDFromContext(r.Context())
+	posts, err := h.DB.GetPostsAs(database.ViewerAt(viewerID, f.Latitude, f.Longitude), f)
 	if err != nil {
 		http.Error(w, `{"message": "Failed to retrieve posts"}`, http.StatusInternalServerError)
 		return
@@ -258,7 +549,7 @@ func (h *RequestHandler) HandleGetProfilePosts(w http.ResponseWriter, r *http.Re
 	}
 
 	// Call the updated DB function
-	userProfile, posts, err := h.DB.GetUserPosts(userID)
+	userProfile, posts, err := h.DB.GetUserPostsAs(userID, viewer(r))
 	if err != nil {
 		// Check if the error is specifically "user not found"
 		if err.Error() == fmt.Sprintf("user not found: failed to query user profile for ID %d", userID) ||
@@ -289,9 +580,10 @@ func (h *RequestHandler) HandleGetSpecificPost(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	post, err := h.DB.GetPostById(postID)
+	// authors can also open their own scheduled and private posts
+	post, err := h.DB.GetPostByIdAs(postID, viewer(r))
 	if err != nil {
-		http.Error(w, `{"message": "Failed to get post"}`, http.StatusInternalServerError)
+		writeLookupError(w, err, "Post")
 		return
 	}
 
@@ -311,6 +603,12 @@ func (h *RequestHandler) HandleSendDM(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	senderID, ok := requireMatchingUser(w, r, req.SenderID)
+	if !ok {
+		return
+	}
+	req.SenderID = senderID
+
 	err := h.DB.InsertMessage(req.SenderID, req.ReceiverID, req.Content)
 	if err != nil {
 		http.Error(w, `{"message": "Failed to send message"}`, http.StatusInternalServerError)
@@ -321,10 +619,21 @@ func (h *RequestHandler) HandleSendDM(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *RequestHandler) HandleGetDMHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	query := r.URL.Query()
 	senderID, _ := strconv.Atoi(query.Get("sender_id"))
 	receiverID, _ := strconv.Atoi(query.Get("receiver_id"))
 
+	// only a participant of the conversation may read it
+	if senderID != userID && receiverID != userID {
+		http.Error(w, `{"message": "Not a participant of this conversation"}`, http.StatusForbidden)
+		return
+	}
+
 	messages, err := h.DB.GetMessages(senderID, receiverID)
 	if err != nil {
 		http.Error(w, `{"message": "Failed to fetch messages"}`, http.StatusInternalServerError)
@@ -335,7 +644,10 @@ func (h *RequestHandler) HandleGetDMHistory(w http.ResponseWriter, r *http.Reque
 }
 
 func (h *RequestHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -343,7 +655,7 @@ func (h *RequestHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	client := &WSClient{userID: userID, conn: conn}
+	client := &WSClient{userID: userID, sessionID: SessionIDFromContext(r.Context()), conn: conn}
 	Hub.register <- client
 
 	// connection closure and unregistration on function exit
@@ -366,10 +678,12 @@ func (h *RequestHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request)
 			}
 			break // Exit loop on read error or close
 		}
-		// Add sender ID if missing (it should be the connected user)
-		if msg.From == 0 {
-			msg.From = userID
+		// Sender is always the connected user
+		if msg.From != 0 && msg.From != userID {
+			log.Printf("Dropping WebSocket message from user %d claiming to be %d", userID, msg.From)
+			continue
 		}
+		msg.From = userID
 
 		// Basic validation
 		if msg.To == 0 || msg.Content == "" {
@@ -398,11 +712,30 @@ func (h *RequestHandler) HandleDeletePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	callerID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID, err := h.DB.GetPostOwner(postID)
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return
+	}
+	if !h.authorizeContent(w, callerID, ownerID) {
+		return
+	}
+
 	if err := h.DB.DeletePost(postID); err != nil {
 		http.Error(w, `{"message": "Failed to delete post"}`, http.StatusInternalServerError)
 		return
 	}
 
+	// attachment rows go with the post, their files have to be removed here
+	if err := h.FM.DeletePostFolder(ownerID, postID); err != nil {
+		log.Printf("Failed to delete files of post %d: %v", postID, err)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Post deleted successfully"})
 }
@@ -419,7 +752,16 @@ func (h *RequestHandler) HandleLikePost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.DB.LikePost(req.UserID, req.PostID); err != nil {
+	userID, ok := requireMatchingUser(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireVisiblePost(w, r, req.PostID); !ok {
+		return
+	}
+
+	if err := h.DB.LikePost(userID, req.PostID); err != nil {
 		http.Error(w, `{"message": "`+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
@@ -440,7 +782,16 @@ func (h *RequestHandler) HandleUnlikePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := h.DB.UnlikePost(req.UserID, req.PostID); err != nil {
+	userID, ok := requireMatchingUser(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireVisiblePost(w, r, req.PostID); !ok {
+		return
+	}
+
+	if err := h.DB.UnlikePost(userID, req.PostID); err != nil {
 		http.Error(w, `{"message": "`+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
@@ -458,6 +809,10 @@ func (h *RequestHandler) HandleGetPostLikes(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
 	usernames, err := h.DB.GetPostLikes(postID)
 	if err != nil {
 		http.Error(w, `{"message": "Failed to retrieve likes"}`, http.StatusInternalServerError)
@@ -480,6 +835,10 @@ func (h *RequestHandler) HandleCheckPostLiked(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
 	parsedURL, err := url.Parse(r.RequestURI)
 	// check get request param for userID
 	params := parsedURL.Query()
@@ -513,6 +872,10 @@ func (h *RequestHandler) HandleGetNestedComments(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
 	comments, err := h.DB.GetNestedComments(postID)
 	if err != nil {
 		http.Error(w, `{"message": "Failed to retrieve comments"}`, http.StatusInternalServerError)
@@ -544,7 +907,16 @@ func (h *RequestHandler) HandleCreateComment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := h.DB.CreateNestedComment(postID, req.UserID, req.ParentID, req.Content); err != nil {
+	userID, ok := requireMatchingUser(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
+	if err := h.DB.CreateNestedComment(postID, userID, req.ParentID, req.Content); err != nil {
 		http.Error(w, `{"message": "Failed to post comment"}`, http.StatusInternalServerError)
 		return
 	}
@@ -562,6 +934,20 @@ func (h *RequestHandler) HandleDeleteComment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	callerID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID, err := h.DB.GetCommentOwner(commentID)
+	if err != nil {
+		writeLookupError(w, err, "Comment")
+		return
+	}
+	if !h.authorizeContent(w, callerID, ownerID) {
+		return
+	}
+
 	if err := h.DB.DeleteComment(commentID); err != nil {
 		http.Error(w, `{"message": "Failed to delete comment"}`, http.StatusInternalServerError)
 		return
@@ -613,17 +999,23 @@ func (h *RequestHandler) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userName, err := h.DB.GetUserNameId(userId)
-	if err != nil {
-		fmt.Printf("Error getting username for userId %d: %v\n", userId, err)
-		http.Error(w, fmt.Sprintf(`{"message": "Error getting username for userId %d: %v"}`, userId, err), http.StatusInternalServerError)
+	// files of expired posts stay on disk until the reaper gets to them, and files of posts
+	// the caller can't see are as missing as the post
+	ownerID, ok := h.requireVisiblePost(w, r, postId)
+	if !ok {
+		return
+	}
+	if ownerID != userId {
+		http.Error(w, `{"message": "File not found"}`, http.StatusNotFound)
 		return
 	}
-	fmt.Printf("Retrieved username: %s\n", userName)
 
 	// Attempt to get the file
-	fmt.Printf("Attempting to get file: user=%s, postId=%d, fileName=%s\n", userName, postId, fileName)
-	data, err := h.FM.GetPostFile(userName, postId, fileName)
+	data, err := h.FM.GetPostFile(userId, postId, fileName)
+	if errors.Is(err, database.ErrInvalidFileName) {
+		http.Error(w, `{"message": "Invalid filename"}`, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		fmt.Printf("Error getting file: %v\n", err)
 		http.Error(w, fmt.Sprintf(`{"message": "Failed to get file: %v"}`, err), http.StatusInternalServerError)
@@ -681,7 +1073,7 @@ func (h *RequestHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 
 	go func() {
 		defer wg.Done()
-		posts, postErr = h.DB.SearchPosts(query, limit)
+		posts, postErr = h.DB.SearchPostsAs(query, limit, viewer(r))
 	}()
 
 	wg.Wait()
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SpotLight/backend/src/database"
+)
+
+// loginLimits is the backoff policy for one kind of login failure key
+type loginLimits struct {
+	freeFailures int           // failures allowed without delay, the attempt after the last of them waits
+	baseDelay    time.Duration // delay after the first counted failure, doubles each time
+	maxDelay     time.Duration
+	lockAfter    int // failures that trigger a lockout
+	lockFor      time.Duration
+	lockStatus   int // status returned while locked out
+}
+
+var (
+	// usernameLimits protects a single account from password guessing
+	usernameLimits = loginLimits{
+		freeFailures: 3,
+		baseDelay:    time.Second,
+		maxDelay:     5 * time.Minute,
+		lockAfter:    10,
+		lockFor:      15 * time.Minute,
+		lockStatus:   http.StatusLocked,
+	}
+	// ipLimits slows down one address spraying guesses across many accounts
+	ipLimits = loginLimits{
+		freeFailures: 10,
+		baseDelay:    time.Second,
+		maxDelay:     5 * time.Minute,
+		lockAfter:    50,
+		lockFor:      time.Hour,
+		lockStatus:   http.StatusTooManyRequests,
+	}
+)
+
+// loginFailureWindow is how long a failure counts against a key
+const loginFailureWindow = time.Hour
+
+func usernameKey(username string) string { return "user:" + username }
+func ipKey(ip string) string             { return "ip:" + ip }
+
+// backoff returns how long to wait after the given number of failures
+func (l loginLimits) backoff(failures int) time.Duration {
+	counted := failures - l.freeFailures + 1
+	if counted <= 0 {
+		return 0
+	}
+	delay := float64(l.baseDelay) * math.Pow(2, float64(counted-1))
+	if delay > float64(l.maxDelay) {
+		return l.maxDelay
+	}
+	return time.Duration(delay)
+}
+
+// retryAfter returns the status and wait before the key may try again, or 0 if it may try now
+func (l loginLimits) retryAfter(lf database.LoginFailures, now time.Time) (int, time.Duration) {
+	if lf.LockedUntil != nil && lf.LockedUntil.After(now) {
+		return l.lockStatus, lf.LockedUntil.Sub(now)
+	}
+	if now.Sub(lf.LastFailureAt) > loginFailureWindow {
+		return 0, 0
+	}
+	if wait := lf.LastFailureAt.Add(l.backoff(lf.Failures)).Sub(now); wait > 0 {
+		return http.StatusTooManyRequests, wait
+	}
+	return 0, 0
+}
+
+// writeThrottled answers a throttled login with a Retry-After header
+func writeThrottled(w http.ResponseWriter, status int, wait time.Duration) {
+	if status == http.StatusLocked {
+		writeRetryAfter(w, status, wait, "Account temporarily locked after too many failed logins")
+		return
+	}
+	writeRetryAfter(w, status, wait, "Too many failed logins, try again later")
+}
+
+// writeRetryAfter answers a throttled request with a Retry-After header
+func writeRetryAfter(w http.ResponseWriter, status int, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf(`{"message": %q, "retry_after": %d}`, message, seconds), status)
+}
+
+// loginCheck is a key a login is counted against, with its limits
+type loginCheck struct {
+	key    string
+	limits loginLimits
+}
+
+// loginChecks returns the keys a login for username from ip is counted against
+func loginChecks(username, ip string) []loginCheck {
+	return []loginCheck{
+		{usernameKey(username), usernameLimits},
+		{ipKey(ip), ipLimits},
+	}
+}
+
+// reserveLoginAttempt counts a login as failed against the username and IP before the password
+// is checked, so guesses sent in parallel are throttled like ones sent in turn. Writes a
+// 423/429 and returns false if either must wait. Otherwise the attempt is settled with
+// loginFailed or loginSucceeded once the outcome is known.
+func (h *RequestHandler) reserveLoginAttempt(w http.ResponseWriter, username, ip string) ([]database.LoginFailures, bool) {
+	var reserved []database.LoginFailures
+	var counted []string
+	for _, check := range loginChecks(username, ip) {
+		now := time.Now()
+		lf, ok, err := h.DB.ReserveLoginAttempt(check.key, loginFailureWindow, func(lf database.LoginFailures) bool {
+			status, _ := check.limits.retryAfter(lf, now)
+			return status == 0
+		})
+		if err != nil {
+			// fail open, a broken counter shouldn't lock everyone out
+			log.Printf("Failed to check login failures: %v", err)
+			reserved = append(reserved, database.LoginFailures{})
+			continue
+		}
+		if !ok {
+			for _, key := range counted {
+				h.releaseLoginAttempt(key)
+			}
+			status, wait := check.limits.retryAfter(lf, now)
+			writeThrottled(w, status, wait)
+			return nil, false
+		}
+		reserved = append(reserved, lf)
+		counted = append(counted, check.key)
+	}
+	return reserved, true
+}
+
+// loginFailed locks out the username or IP of a failed login whose reserved attempt took it
+// past the limit
+func (h *RequestHandler) loginFailed(username, ip string, reserved []database.LoginFailures) {
+	for i, check := range loginChecks(username, ip) {
+		if reserved[i].Failures >= check.limits.lockAfter {
+			log.Printf("Locking out %s after %d failed logins", check.key, reserved[i].Failures)
+			if err := h.DB.LockLogin(check.key, time.Now().Add(check.limits.lockFor)); err != nil {
+				log.Printf("Failed to lock out %s: %v", check.key, err)
+			}
+		}
+	}
+}
+
+// loginSucceeded settles the attempt of a login whose password was right: the account's
+// counter is reset and the attempt is taken back from the IP, whose counter is left to expire
+func (h *RequestHandler) loginSucceeded(username, ip string) {
+	if err := h.DB.ClearLoginFailures(usernameKey(username)); err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", username, err)
+	}
+	h.releaseLoginAttempt(ipKey(ip))
+}
+
+// releaseLoginAttempt gives back an attempt counted against a key
+func (h *RequestHandler) releaseLoginAttempt(key string) {
+	if err := h.DB.ReleaseLoginAttempt(key); err != nil {
+		log.Printf("Failed to release login attempt for %s: %v", key, err)
+	}
+}
+
+// HandleClearLoginLockout lets an admin clear the failure counters of a username and/or IP
+func (h *RequestHandler) HandleClearLoginLockout(w http.ResponseWriter, r *http.Request) {
+	callerID, _ := UserIDFromContext(r.Context())
+
+	var req struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" && req.IP == "" {
+		http.Error(w, `{"message": "Username or IP is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Username != "" {
+		if err := h.DB.ClearLoginFailures(usernameKey(req.Username)); err != nil {
+			http.Error(w, `{"message": "Failed to clear lockout"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.IP != "" {
+		if err := h.DB.ClearLoginFailures(ipKey(req.IP)); err != nil {
+			http.Error(w, `{"message": "Failed to clear lockout"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Printf("Admin %d cleared login lockout for username=%q ip=%q", callerID, req.Username, req.IP)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Lockout cleared"})
+}
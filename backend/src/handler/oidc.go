@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"SpotLight/backend/src/auth"
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/oidc"
+
+	"github.com/gorilla/mux"
+)
+
+// oidcStateTTL is how long a user has to finish logging in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie holds a hash of the state of the login the browser started, so a callback
+// only completes in the browser that began it
+const oidcStateCookie = "oidc_state"
+
+// defaultOIDCFrontendURL receives the result of a provider login when OIDCFrontendURL isn't set
+const defaultOIDCFrontendURL = "http://localhost:3000/login/callback"
+
+// HandleListAuthProviders lists the configured external login providers
+func (h *RequestHandler) HandleListAuthProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range h.OIDC {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"providers": names})
+}
+
+// HandleOIDCStart sends the browser to the provider to log in
+func (h *RequestHandler) HandleOIDCStart(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := h.beginOIDCLogin(w, r, provider, 0)
+	if err != nil {
+		log.Printf("Failed to start %s login: %v", provider.Name, err)
+		http.Error(w, `{"message": "Failed to start login"}`, http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleLinkIdentity starts a provider login that links the identity to the caller's account.
+// The URL is returned rather than redirected to since the request carries the caller's token;
+// the request must be sent with credentials so the browser keeps the state cookie.
+func (h *RequestHandler) HandleLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := h.beginOIDCLogin(w, r, provider, userID)
+	if err != nil {
+		log.Printf("Failed to start %s link for user %d: %v", provider.Name, userID, err)
+		http.Error(w, `{"message": "Failed to start login"}`, http.StatusBadGateway)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"authorization_url": authURL})
+}
+
+// HandleListIdentities lists the external identities linked to the caller's account
+func (h *RequestHandler) HandleListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := h.DB.ListIdentities(userID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to list identities"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"identities": identities})
+}
+
+// HandleOIDCCallback finishes a provider login and hands a normal session to the frontend.
+// Results go back in the URL fragment so tokens never reach server logs.
+func (h *RequestHandler) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		h.finishOIDC(w, r, url.Values{"error": {"access_denied"}})
+		return
+	}
+	if query.Get("state") == "" || query.Get("code") == "" {
+		h.finishOIDC(w, r, url.Values{"error": {"invalid_request"}})
+		return
+	}
+
+	// a callback URL from someone else's login must not complete in this browser
+	cookie, err := r.Cookie(oidcStateCookie)
+	setOIDCStateCookie(w, "", -1)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(auth.HashOpaqueToken(query.Get("state")))) != 1 {
+		h.finishOIDC(w, r, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	state, err := h.DB.ConsumeOIDCLoginState(auth.HashOpaqueToken(query.Get("state")), provider.Name)
+	if err != nil {
+		if !errors.Is(err, database.ErrInvalidLoginState) {
+			log.Printf("Failed to load %s login state: %v", provider.Name, err)
+		}
+		h.finishOIDC(w, r, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("Failed to complete %s login: %v", provider.Name, err)
+		h.finishOIDC(w, r, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		err := h.DB.LinkIdentity(state.LinkUserID, provider.Name, identity.Subject, identity.Email)
+		if errors.Is(err, database.ErrIdentityLinked) {
+			h.finishOIDC(w, r, url.Values{"error": {"identity_linked"}})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to link %s identity to user %d: %v", provider.Name, state.LinkUserID, err)
+			h.finishOIDC(w, r, url.Values{"error": {"server_error"}})
+			return
+		}
+		h.finishOIDC(w, r, url.Values{"linked": {provider.Name}})
+		return
+	}
+
+	userID, err := h.DB.GetIdentityUser(provider.Name, identity.Subject)
+	if errors.Is(err, database.ErrNotFound) {
+		// first visit, an existing account is only ever joined by linking from inside it
+		userID, _, err = h.DB.CreateUserWithIdentity(usernameFromIdentity(identity),
+			provider.Name, identity.Subject, identity.Email, identity.EmailVerified)
+	}
+	if err != nil {
+		log.Printf("Failed to resolve %s identity %s: %v", provider.Name, identity.Subject, err)
+		h.finishOIDC(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	suspended, err := h.DB.IsSuspended(userID)
+	if err != nil {
+		h.finishOIDC(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+	if suspended {
+		h.finishOIDC(w, r, url.Values{"error": {"suspended"}})
+		return
+	}
+
+	username, err := h.DB.GetUserNameId(userID)
+	if err != nil {
+		h.finishOIDC(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	tokens, err := h.startSession(r, userID)
+	if err != nil {
+		log.Printf("Failed to start session for user %d: %v", userID, err)
+		h.finishOIDC(w, r, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	result := url.Values{"username": {username}}
+	for key, value := range tokens {
+		result.Set(key, fmt.Sprint(value))
+	}
+	h.finishOIDC(w, r, result)
+}
+
+// oidcProvider looks up the provider named in the path, writing a 404 if it isn't configured
+func (h *RequestHandler) oidcProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := h.OIDC[mux.Vars(r)["provider"]]
+	if !ok {
+		http.Error(w, `{"message": "Unknown login provider"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
+
+// beginOIDCLogin stores a fresh state, nonce and PKCE verifier, binds the state to the browser
+// with a cookie and returns the provider URL
+func (h *RequestHandler) beginOIDCLogin(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, linkUserID int) (string, error) {
+	state, nonce, verifier, err := oidc.NewLoginSecrets()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	err = h.DB.CreateOIDCLoginState(auth.HashOpaqueToken(state), database.OIDCLoginState{
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+	}, time.Now().Add(oidcStateTTL))
+	if err != nil {
+		return "", err
+	}
+	setOIDCStateCookie(w, auth.HashOpaqueToken(state), int(oidcStateTTL.Seconds()))
+	return authURL, nil
+}
+
+// setOIDCStateCookie sets the state cookie for the provider callbacks, or clears it when maxAge
+// is negative
+func setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// finishOIDC redirects to the frontend with the result in the URL fragment
+func (h *RequestHandler) finishOIDC(w http.ResponseWriter, r *http.Request, result url.Values) {
+	target := h.OIDCFrontendURL
+	if target == "" {
+		target = defaultOIDCFrontendURL
+	}
+	http.Redirect(w, r, target+"#"+result.Encode(), http.StatusFound)
+}
+
+// usernameFromIdentity suggests a username for a new account from what the provider told us
+func usernameFromIdentity(identity *oidc.Identity) string {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, c := range base {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+			b.WriteRune(c)
+		}
+		if b.Len() == 20 {
+			break
+		}
+	}
+
+	// usernames have to start with a letter or digit
+	name := strings.TrimLeft(b.String(), "_")
+	if len(name) < 3 {
+		return "user"
+	}
+	return name
+}
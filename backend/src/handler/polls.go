@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// pollRequest is the poll part of a create post request
+type pollRequest struct {
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multiple_choice"`
+	ClosesAt       string   `json:"closes_at"` // RFC 3339, empty keeps the poll open
+}
+
+// parsePoll checks the poll of a new post. A poll on a scheduled post has to close after the
+// post goes out. Writes a 400 and returns false if anything is wrong.
+func parsePoll(w http.ResponseWriter, req pollRequest, publishAt *time.Time) (*database.NewPoll, bool) {
+	poll := &database.NewPoll{Options: req.Options, MultipleChoice: req.MultipleChoice}
+	if err := database.ValidatePoll(poll); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if req.ClosesAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ClosesAt)
+		if err != nil {
+			http.Error(w, `{"message": "closes_at must be an RFC 3339 time"}`, http.StatusBadRequest)
+			return nil, false
+		}
+		opens := time.Now()
+		if publishAt != nil {
+			opens = *publishAt
+		}
+		if !t.After(opens) {
+			http.Error(w, `{"message": "closes_at must be after the post goes out"}`, http.StatusBadRequest)
+			return nil, false
+		}
+		poll.ClosesAt = &t
+	}
+	return poll, true
+}
+
+// HandleVotePoll casts the caller's vote in a post's poll
+func (h *RequestHandler) HandleVotePoll(w http.ResponseWriter, r *http.Request) {
+	h.handleVote(w, r, false)
+}
+
+// HandleChangePollVote replaces the caller's vote in a post's poll
+func (h *RequestHandler) HandleChangePollVote(w http.ResponseWriter, r *http.Request) {
+	h.handleVote(w, r, true)
+}
+
+// handleVote reads {"option_ids": [...]} and answers with the poll's new results
+func (h *RequestHandler) handleVote(w http.ResponseWriter, r *http.Request, change bool) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		OptionIDs []int `json:"option_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
+	if change {
+		err = h.DB.ChangeVote(postID, userID, req.OptionIDs)
+	} else {
+		err = h.DB.CastVote(postID, userID, req.OptionIDs)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			http.Error(w, `{"message": "Poll not found"}`, http.StatusNotFound)
+		case errors.Is(err, database.ErrInvalidVote):
+			http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		case errors.Is(err, database.ErrPollClosed):
+			http.Error(w, `{"message": "Poll is closed"}`, http.StatusConflict)
+		case errors.Is(err, database.ErrAlreadyVoted):
+			http.Error(w, `{"message": "Already voted, change the vote instead"}`, http.StatusConflict)
+		case errors.Is(err, database.ErrNotVoted):
+			http.Error(w, `{"message": "No vote to change yet"}`, http.StatusConflict)
+		default:
+			log.Printf("Failed to vote in poll of post %d: %v", postID, err)
+			http.Error(w, `{"message": "Failed to vote"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	post, err := h.DB.GetPostByIdAs(postID, viewer(r))
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return
+	}
+	json.NewEncoder(w).Encode(post["poll"])
+}
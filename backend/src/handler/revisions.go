@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleEditPost lets the author change a post's text and attachments, keeping the old version
+func (h *RequestHandler) HandleEditPost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	callerID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.limitBody(w, r) {
+		return
+	}
+
+	var req struct {
+		Content     string              `json:"content"`
+		FileName    string              `json:"file_name"`
+		Media       string              `json:"media"`
+		RemoveFile  bool                `json:"remove_file"`
+		Attachments []attachmentRequest `json:"attachments"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" {
+		http.Error(w, `{"message": "Content is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := h.DB.GetPostOwner(postID)
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return
+	}
+	// unlike deletion, moderators can't put words in someone's mouth
+	if callerID != ownerID {
+		http.Error(w, `{"message": "Only the author can edit this post"}`, http.StatusForbidden)
+		return
+	}
+
+	current, err := h.DB.GetAttachments(postID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to get post"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// older clients edit a single file, which maps onto a one item list (or an empty one)
+	if req.Attachments == nil && (req.RemoveFile || (req.FileName != "" && req.Media != "")) {
+		req.Attachments = []attachmentRequest{}
+		if req.FileName != "" && req.Media != "" {
+			req.Attachments = append(req.Attachments, attachmentRequest{FileName: req.FileName, Media: req.Media})
+		}
+	}
+
+	// nil keeps the current attachments
+	var next []database.Attachment
+	if req.Attachments != nil {
+		if len(req.Attachments) > database.MaxAttachments {
+			http.Error(w, fmt.Sprintf(`{"message": "A post can have at most %d attachments"}`, database.MaxAttachments), http.StatusBadRequest)
+			return
+		}
+
+		// every current name is taken, overwriting a file in place would lose it if the update failed
+		taken := map[string]bool{}
+		for _, a := range current {
+			taken[a.FileName] = true
+		}
+		uploads, status, msg := decodeUploads(req.Attachments, taken, h.uploadLimits().MaxFileBytes)
+		if msg != "" {
+			http.Error(w, fmt.Sprintf(`{"message": %q}`, msg), status)
+			return
+		}
+
+		stored, err := h.storeUploads(ownerID, postID, uploads)
+		if err != nil {
+			log.Printf("Failed to store files for post %d: %v", postID, err)
+			http.Error(w, `{"message": "Failed to store file"}`, http.StatusInternalServerError)
+			return
+		}
+
+		next = make([]database.Attachment, 0, len(req.Attachments))
+		for _, a := range req.Attachments {
+			if a.AttachmentID != 0 {
+				next = append(next, database.Attachment{ID: a.AttachmentID})
+				continue
+			}
+			next = append(next, stored[0])
+			stored = stored[1:]
+		}
+	}
+
+	removed, err := h.DB.UpdatePost(postID, req.Content, next)
+	if err != nil {
+		// drop the files written for this edit
+		added := []database.Attachment{}
+		for _, a := range next {
+			if a.ID == 0 {
+				added = append(added, a)
+			}
+		}
+		h.removeAttachmentFiles(ownerID, postID, added)
+
+		if errors.Is(err, database.ErrInvalidAttachment) {
+			http.Error(w, `{"message": "Unknown attachment for this post"}`, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, `{"message": "Post not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to edit post %d: %v", postID, err)
+		http.Error(w, `{"message": "Failed to edit post"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// replaced or removed files go away, revisions only keep their metadata
+	h.removeAttachmentFiles(ownerID, postID, removed)
+
+	post, err := h.DB.GetPostByIdAs(postID, database.Viewer{UserID: ownerID})
+	if err != nil {
+		http.Error(w, `{"message": "Failed to get post"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// HandleGetPostRevisions lists the earlier versions of a post, newest first
+func (h *RequestHandler) HandleGetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	// earlier versions are only for those who may see the post
+	if _, ok := h.requireVisiblePost(w, r, postID); !ok {
+		return
+	}
+
+	revisions, err := h.DB.GetPostRevisions(postID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to get post history"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"post_id": postID, "revisions": revisions})
+}
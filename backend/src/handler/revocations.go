@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"SpotLight/backend/src/auth"
+)
+
+// revokedSessions holds the sessions revoked within the lifetime of an access token, so
+// AuthMiddleware can turn away their access tokens without a query per request. Sessions
+// drop out once every access token issued for them has expired.
+var revokedSessions = struct {
+	sync.Mutex
+	until map[int]time.Time // session ID to when its last access token expires
+}{until: make(map[int]time.Time)}
+
+// sessionRevoked reports whether a session is known to be revoked
+func sessionRevoked(sessionID int) bool {
+	revokedSessions.Lock()
+	defer revokedSessions.Unlock()
+	_, ok := revokedSessions.until[sessionID]
+	return ok
+}
+
+// markSessionsRevoked adds sessions to revokedSessions and closes the WebSocket connections of
+// those that weren't in it yet
+func markSessionsRevoked(sessionIDs []int) {
+	now := time.Now()
+	var added []int
+
+	revokedSessions.Lock()
+	for id, until := range revokedSessions.until {
+		if now.After(until) {
+			delete(revokedSessions.until, id)
+		}
+	}
+	for _, id := range sessionIDs {
+		if _, ok := revokedSessions.until[id]; !ok {
+			revokedSessions.until[id] = now.Add(auth.AccessTokenTTL)
+			added = append(added, id)
+		}
+	}
+	revokedSessions.Unlock()
+
+	if len(added) > 0 {
+		// don't hold up the caller on the hub
+		go func() { Hub.drop <- added }()
+	}
+}
+
+// SyncRevokedSessions loads the sessions revoked in the database within the lifetime of an
+// access token. It runs after every revocation here and periodically for those made elsewhere,
+// by another instance or before a restart.
+func (h *RequestHandler) SyncRevokedSessions() {
+	sessionIDs, err := h.DB.RevokedSessionsSince(time.Now().Add(-auth.AccessTokenTTL))
+	if err != nil {
+		log.Printf("Failed to load revoked sessions: %v", err)
+		return
+	}
+	markSessionsRevoked(sessionIDs)
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// parsePublishAt reads an RFC 3339 publish time, which must be in the future and no more than
+// MaxScheduleAhead away. Writes a 400 and returns false otherwise.
+func parsePublishAt(w http.ResponseWriter, value string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		http.Error(w, `{"message": "publish_at must be an RFC 3339 time"}`, http.StatusBadRequest)
+		return t, false
+	}
+	now := time.Now()
+	if !t.After(now) {
+		http.Error(w, `{"message": "publish_at must be in the future"}`, http.StatusBadRequest)
+		return t, false
+	}
+	if t.After(now.Add(MaxScheduleAhead)) {
+		http.Error(w, fmt.Sprintf(`{"message": "publish_at can be at most %d days ahead"}`, int(MaxScheduleAhead.Hours()/24)), http.StatusBadRequest)
+		return t, false
+	}
+	return t, true
+}
+
+// scheduledPostOwner parses the post ID from the path and checks the caller wrote the post
+func (h *RequestHandler) scheduledPostOwner(w http.ResponseWriter, r *http.Request) (postID, ownerID int, ok bool) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid post ID"}`, http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	callerID, ok := requireUser(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	ownerID, err = h.DB.GetPostOwner(postID)
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return 0, 0, false
+	}
+	// someone else's scheduled post isn't supposed to exist for the caller yet
+	if ownerID != callerID {
+		http.Error(w, `{"message": "Post not found"}`, http.StatusNotFound)
+		return 0, 0, false
+	}
+	return postID, ownerID, true
+}
+
+// writeScheduleError maps errors from rescheduling and cancelling to responses
+func writeScheduleError(w http.ResponseWriter, err error, postID int) {
+	switch {
+	case errors.Is(err, database.ErrNotScheduled):
+		http.Error(w, `{"message": "Post has already been published"}`, http.StatusConflict)
+	case errors.Is(err, database.ErrNotFound):
+		http.Error(w, `{"message": "Post not found"}`, http.StatusNotFound)
+	case errors.Is(err, database.ErrPollClosesTooSoon):
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, database.ErrPollClosesTooSoon.Error()), http.StatusBadRequest)
+	default:
+		log.Printf("Failed to update scheduled post %d: %v", postID, err)
+		http.Error(w, `{"message": "Failed to update scheduled post"}`, http.StatusInternalServerError)
+	}
+}
+
+// HandleListScheduledPosts lists the caller's posts that haven't gone out yet
+func (h *RequestHandler) HandleListScheduledPosts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	posts, err := h.DB.ListScheduledPosts(userID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to get scheduled posts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(posts)
+}
+
+// HandleReschedulePost moves one of the caller's scheduled posts to a new publish_at
+func (h *RequestHandler) HandleReschedulePost(w http.ResponseWriter, r *http.Request) {
+	postID, ownerID, ok := h.scheduledPostOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PublishAt string `json:"publish_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		return
+	}
+	publishAt, ok := parsePublishAt(w, req.PublishAt)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.ReschedulePost(postID, publishAt); err != nil {
+		writeScheduleError(w, err, postID)
+		return
+	}
+
+	post, err := h.DB.GetPostByIdAs(postID, database.Viewer{UserID: ownerID})
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return
+	}
+	json.NewEncoder(w).Encode(post)
+}
+
+// HandleCancelScheduledPost deletes one of the caller's posts before it goes out
+func (h *RequestHandler) HandleCancelScheduledPost(w http.ResponseWriter, r *http.Request) {
+	postID, ownerID, ok := h.scheduledPostOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.CancelScheduledPost(postID); err != nil {
+		writeScheduleError(w, err, postID)
+		return
+	}
+	if err := h.FM.DeletePostFolder(ownerID, postID); err != nil {
+		log.Printf("Failed to delete files of post %d: %v", postID, err)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Scheduled post cancelled"})
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"SpotLight/backend/src/auth"
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// clientIP returns the caller's address without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession creates a session row and returns the login token payload for it
+func (h *RequestHandler) startSession(r *http.Request, userID int) (map[string]interface{}, error) {
+	refreshToken, refreshHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := time.Now().Add(auth.RefreshTokenTTL)
+
+	sessionID, err := h.DB.CreateSession(userID, r.UserAgent(), clientIP(r), refreshHash, refreshExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenPayload(userID, sessionID, refreshToken, refreshExpiresAt)
+}
+
+// tokenPayload signs an access token and bundles it with the refresh token for the client
+func tokenPayload(userID, sessionID int, refreshToken string, refreshExpiresAt time.Time) (map[string]interface{}, error) {
+	accessToken, expiresAt, err := auth.IssueToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"user_id":            userID,
+		"session_id":         sessionID,
+		"token":              accessToken,
+		"expires_at":         expiresAt.Format(time.RFC3339),
+		"refresh_token":      refreshToken,
+		"refresh_expires_at": refreshExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// HandleRefreshToken exchanges a refresh token for a new access token and refresh token
+func (h *RequestHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, `{"message": "Refresh token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	newToken, newHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		http.Error(w, `{"message": "Failed to refresh session"}`, http.StatusInternalServerError)
+		return
+	}
+	refreshExpiresAt := time.Now().Add(auth.RefreshTokenTTL)
+
+	userID, sessionID, err := h.DB.RotateRefreshToken(auth.HashOpaqueToken(req.RefreshToken), newHash,
+		r.UserAgent(), clientIP(r), refreshExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRefreshTokenReused):
+			log.Printf("Refresh token reuse detected from %s, session revoked", clientIP(r))
+			h.SyncRevokedSessions()
+			http.Error(w, `{"message": "Refresh token was already used, session has been revoked"}`, http.StatusUnauthorized)
+		case errors.Is(err, database.ErrInvalidRefreshToken):
+			http.Error(w, `{"message": "Refresh token is invalid or expired"}`, http.StatusUnauthorized)
+		default:
+			log.Printf("Failed to rotate refresh token: %v", err)
+			http.Error(w, `{"message": "Failed to refresh session"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tokens, err := tokenPayload(userID, sessionID, newToken, refreshExpiresAt)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to refresh session"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// HandleLogout revokes the session the caller's access token belongs to
+func (h *RequestHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.RevokeSession(userID, SessionIDFromContext(r.Context())); err != nil && !errors.Is(err, database.ErrNotFound) {
+		http.Error(w, `{"message": "Failed to log out"}`, http.StatusInternalServerError)
+		return
+	}
+	h.SyncRevokedSessions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+// HandleListSessions lists the caller's active sessions, flagging the current one
+func (h *RequestHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.DB.ListSessions(userID)
+	if err != nil {
+		http.Error(w, `{"message": "Failed to retrieve sessions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	currentID := SessionIDFromContext(r.Context())
+	response := make([]map[string]interface{}, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, map[string]interface{}{
+			"session_id":   s.ID,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt,
+			"last_used_at": s.LastUsedAt,
+			"current":      s.ID == currentID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleRevokeSession revokes one of the caller's sessions
+func (h *RequestHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid session ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.RevokeSession(userID, sessionID); err != nil {
+		writeLookupError(w, err, "Session")
+		return
+	}
+	h.SyncRevokedSessions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// HandleRevokeAllSessions logs the caller out everywhere, including the current session
+func (h *RequestHandler) HandleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.RevokeAllSessions(userID, 0); err != nil {
+		http.Error(w, `{"message": "Failed to revoke sessions"}`, http.StatusInternalServerError)
+		return
+	}
+	h.SyncRevokedSessions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "All sessions revoked"})
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"SpotLight/backend/src/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleGetTagPosts returns the posts with a hashtag, taking the same query parameters as
+// HandleGetPosts
+func (h *RequestHandler) HandleGetTagPosts(w http.ResponseWriter, r *http.Request) {
+	tag, err := database.NormalizeTag(mux.Vars(r)["tag"])
+	if err != nil {
+		http.Error(w, `{"message": "Invalid tag"}`, http.StatusBadRequest)
+		return
+	}
+
+	f, err := postFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	f.Tag = tag
+	h.writeFeed(w, r, f)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"SpotLight/backend/src/database"
+)
+
+// Upload limits used when none are configured
+const (
+	DefaultMaxFileBytes    int64 = 25 << 20
+	DefaultMaxRequestBytes int64 = 100 << 20
+)
+
+// maxFieldBytes caps the text fields of a multipart post
+const maxFieldBytes = 64 << 10
+
+// UploadLimits bounds what a single post upload may send
+type UploadLimits struct {
+	MaxFileBytes    int64 // per attachment
+	MaxRequestBytes int64 // whole request body, files included
+}
+
+// UploadLimitsFromEnv reads MAX_UPLOAD_FILE_MB and MAX_UPLOAD_REQUEST_MB, keeping the defaults for unset values
+func UploadLimitsFromEnv() UploadLimits {
+	limits := UploadLimits{MaxFileBytes: DefaultMaxFileBytes, MaxRequestBytes: DefaultMaxRequestBytes}
+	if mb, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_FILE_MB"), 10, 64); err == nil && mb > 0 {
+		limits.MaxFileBytes = mb << 20
+	}
+	if mb, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_REQUEST_MB"), 10, 64); err == nil && mb > 0 {
+		limits.MaxRequestBytes = mb << 20
+	}
+	return limits
+}
+
+// uploadLimits returns the configured limits with defaults filled in
+func (h *RequestHandler) uploadLimits() UploadLimits {
+	limits := h.Uploads
+	if limits.MaxFileBytes <= 0 {
+		limits.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if limits.MaxRequestBytes <= 0 {
+		limits.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	return limits
+}
+
+// limitBody rejects a request whose declared size is already over the limit, before any of it
+// is read, and caps the body of the rest
+func (h *RequestHandler) limitBody(w http.ResponseWriter, r *http.Request) bool {
+	limit := h.uploadLimits().MaxRequestBytes
+	if r.ContentLength > limit {
+		http.Error(w, fmt.Sprintf(`{"message": "Request is larger than %d bytes"}`, limit), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// isMultipart reports whether a request carries multipart/form-data
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// readMultipartPost streams a multipart post: text parts become fields, each file part is
+// written straight to a staging file. On failure the error response is written, staged files
+// are removed and ok is false.
+func (h *RequestHandler) readMultipartPost(w http.ResponseWriter, r *http.Request) (fields map[string]string, uploads []upload, ok bool) {
+	limits := h.uploadLimits()
+	fields = map[string]string{}
+
+	fail := func(status int, message string) (map[string]string, []upload, bool) {
+		h.discardUploads(uploads)
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, message), status)
+		return nil, nil, false
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return fail(http.StatusBadRequest, "Invalid multipart body")
+	}
+
+	taken := map[string]bool{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request is larger than %d bytes", limits.MaxRequestBytes))
+			}
+			return fail(http.StatusBadRequest, "Invalid multipart body")
+		}
+
+		fileName := part.FileName()
+		if fileName == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes+1))
+			part.Close()
+			if err != nil || len(value) > maxFieldBytes {
+				return fail(http.StatusBadRequest, "Invalid form field "+part.FormName())
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		if len(uploads) == database.MaxAttachments {
+			part.Close()
+			return fail(http.StatusBadRequest, fmt.Sprintf("A post can have at most %d attachments", database.MaxAttachments))
+		}
+		// FileName already strips directories, but reject names that tried to have one
+		if fileName == "." || fileName == ".." || strings.ContainsAny(fileName, `/\`) || fileName != filepath.Base(fileName) {
+			part.Close()
+			return fail(http.StatusBadRequest, "Invalid filename")
+		}
+		if taken[fileName] {
+			part.Close()
+			return fail(http.StatusBadRequest, "Each attachment needs a new, unique filename")
+		}
+		taken[fileName] = true
+
+		staged, size, err := h.FM.StageUpload(part, limits.MaxFileBytes)
+		part.Close()
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			switch {
+			case errors.Is(err, database.ErrFileTooLarge):
+				return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is larger than %d bytes", fileName, limits.MaxFileBytes))
+			case errors.As(err, &tooBig):
+				return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request is larger than %d bytes", limits.MaxRequestBytes))
+			}
+			log.Printf("Failed to stage upload %s: %v", fileName, err)
+			return fail(http.StatusInternalServerError, "Failed to store file")
+		}
+
+		u := upload{staged: staged, meta: database.Attachment{FileName: fileName, SizeBytes: size}}
+		if f, err := h.FM.OpenUpload(staged); err == nil {
+			u.meta = attachmentMeta(fileName, size, f)
+			f.Close()
+		}
+		uploads = append(uploads, u)
+	}
+
+	return fields, uploads, true
+}
+
+// discardUploads removes staging files that never made it into a post
+func (h *RequestHandler) discardUploads(uploads []upload) {
+	for _, u := range uploads {
+		if u.staged == "" {
+			continue
+		}
+		if err := h.FM.DiscardUpload(u.staged); err != nil {
+			log.Printf("Failed to remove staged upload %s: %v", u.staged, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"SpotLight/backend/src/database"
+)
+
+// viewer is who a request reads posts as: the signed in user, if any, at the latitude and
+// longitude query parameters, if given. Local-only posts need the location.
+func viewer(r *http.Request) database.Viewer {
+	userID, _ := UserIDFromContext(r.Context())
+	v := database.Viewer{UserID: userID}
+	query := r.URL.Query()
+	lat, latErr := strconv.ParseFloat(query.Get("latitude"), 64)
+	lon, lonErr := strconv.ParseFloat(query.Get("longitude"), 64)
+	if latErr == nil && lonErr == nil {
+		v = database.ViewerAt(userID, lat, lon)
+	}
+	return v
+}
+
+// requireVisiblePost checks the caller may see a post before reading or acting on its likes,
+// comments or files. Posts hidden from the caller are a 404, like ones that don't exist.
+func (h *RequestHandler) requireVisiblePost(w http.ResponseWriter, r *http.Request, postID int) (ownerID int, ok bool) {
+	ownerID, err := h.DB.VisiblePostOwner(postID, viewer(r))
+	if err != nil {
+		writeLookupError(w, err, "Post")
+		return 0, false
+	}
+	return ownerID, true
+}
+
+// checkVisibility validates the visibility and local radius of a new post.
+// Writes a 400 and returns false if either is invalid.
+func checkVisibility(w http.ResponseWriter, visibility string, localRadius int) bool {
+	if err := database.ValidateVisibility(visibility); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message": %q}`, err.Error()), http.StatusBadRequest)
+		return false
+	}
+	if localRadius != 0 && (localRadius < database.MinLocalRadius || localRadius > database.MaxLocalRadius) {
+		http.Error(w, fmt.Sprintf(`{"message": "local_radius must be between %d and %d meters"}`,
+			database.MinLocalRadius, database.MaxLocalRadius), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
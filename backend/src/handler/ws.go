@@ -23,14 +23,17 @@ var upgrader = websocket.Upgrader{
 
 type WebSocketHub struct {
 	clients    map[int]*websocket.Conn // userID to connection
+	sessions   map[int]int             // userID to the session the connection was opened with
 	register   chan *WSClient
 	unregister chan int
 	broadcast  chan WSMessage
+	drop       chan []int // sessions whose connections are closed, once they're revoked
 }
 
 type WSClient struct {
-	userID int
-	conn   *websocket.Conn
+	userID    int
+	sessionID int
+	conn      *websocket.Conn
 }
 
 type WSMessage struct {
@@ -41,9 +44,11 @@ type WSMessage struct {
 
 var Hub = WebSocketHub{
 	clients:    make(map[int]*websocket.Conn),
+	sessions:   make(map[int]int),
 	register:   make(chan *WSClient),
 	unregister: make(chan int),
 	broadcast:  make(chan WSMessage),
+	drop:       make(chan []int),
 }
 
 // StartHub runs the WebSocket message router
@@ -54,14 +59,29 @@ func StartHub() {
 		case client := <-Hub.register:
 			log.Printf("Registering client: User %d", client.userID)
 			Hub.clients[client.userID] = client.conn
+			Hub.sessions[client.userID] = client.sessionID
 		case userID := <-Hub.unregister:
 			log.Printf("Unregistering client: User %d", userID)
 			// Check if client exists before deleting and closing
 			if conn, ok := Hub.clients[userID]; ok {
 				delete(Hub.clients, userID)
+				delete(Hub.sessions, userID)
 				conn.Close() // Ensure connection is closed if hub removes it
 				log.Printf("Closed connection for unregistered user %d", userID)
 			}
+		case sessionIDs := <-Hub.drop:
+			revoked := make(map[int]bool, len(sessionIDs))
+			for _, id := range sessionIDs {
+				revoked[id] = true
+			}
+			for userID, sessionID := range Hub.sessions {
+				if revoked[sessionID] {
+					log.Printf("Closing connection for user %d, session %d was revoked", userID, sessionID)
+					Hub.clients[userID].Close()
+					delete(Hub.clients, userID)
+					delete(Hub.sessions, userID)
+				}
+			}
 		case msg := <-Hub.broadcast:
 			log.Printf("Hub received broadcast message: From %d To %d", msg.From, msg.To)
 			
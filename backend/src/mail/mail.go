@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sender delivers an email, swap implementations to change how mail goes out
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// LogSender writes outgoing mail to the server log, handy for local development
+type LogSender struct{}
+
+// Send logs the message instead of delivering it
+func (LogSender) Send(to, subject, body string) error {
+	log.Printf("Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// FileSender writes each outgoing mail as a .eml file into Dir for local development
+type FileSender struct {
+	Dir string
+}
+
+// NewFileSender creates a sender that drops mail into dir
+func NewFileSender(dir string) *FileSender {
+	return &FileSender{Dir: dir}
+}
+
+// Send writes the message to a new file in the outbox directory
+func (fs *FileSender) Send(to, subject, body string) error {
+	if err := os.MkdirAll(fs.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create outbox: %w", err)
+	}
+
+	// keep the recipient readable in the file name but strip anything path-like
+	safeTo := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, to)
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), safeTo)
+
+	msg := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n", to, subject, time.Now().Format(time.RFC1123Z), body)
+	if err := os.WriteFile(filepath.Join(fs.Dir, name), []byte(msg), 0644); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+
+	log.Printf("Mail to %s written to %s", to, filepath.Join(fs.Dir, name))
+	return nil
+}
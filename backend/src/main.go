@@ -1,14 +1,23 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"SpotLight/backend/src/batch"
 	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/events"
+	"SpotLight/backend/src/export"
 	"SpotLight/backend/src/handler"
+	"SpotLight/backend/src/mail"
+	"SpotLight/backend/src/oidc"
+	"SpotLight/backend/src/reaper"
 	"SpotLight/backend/src/routes"
+	"SpotLight/backend/src/scheduler"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -18,6 +27,9 @@ import (
 const portNum = ":8080"
 
 func main() {
+	migrateMedia := flag.Bool("migrate-media", false, "move uploads from data/<username>/ into the ID based layout and exit")
+	flag.Parse()
+
 	log.Println("Starting the API backend...")
 
 	// Create file management system based on default relative path
@@ -40,8 +52,37 @@ func main() {
 	}
 	defer db.Close()
 
+	if *migrateMedia {
+		runMediaMigration(db, fm)
+		return
+	}
+
+	// Outgoing mail is written to files until a real mail provider is configured
+	mailer := mail.NewFileSender("../outbox/")
+
 	// Create request handler
-	handlerInstance := &handler.RequestHandler{DB: db, FM: fm}
+	handlerInstance := &handler.RequestHandler{DB: db, FM: fm, Mail: mailer}
+
+	// External login providers come from OIDC_* environment variables
+	handlerInstance.OIDC = oidc.LoadProvidersFromEnv()
+	handlerInstance.OIDCFrontendURL = os.Getenv("OIDC_FRONTEND_URL")
+
+	// Post upload size limits come from MAX_UPLOAD_FILE_MB and MAX_UPLOAD_REQUEST_MB
+	handlerInstance.Uploads = handler.UploadLimitsFromEnv()
+
+	// Personal data exports are built in the background and deleted once they expire
+	handlerInstance.Exports = export.NewManager(db, fm, "../exports/")
+	go handlerInstance.Exports.StartJanitor(time.Hour)
+
+	// Ephemeral posts are deleted along with their media once they expire
+	go reaper.NewReaper(db, fm).Start(time.Minute)
+
+	// New posts are announced on the event bus, scheduled ones once they go out
+	handlerInstance.Events = events.NewBus()
+	handlerInstance.Events.OnPostPublished(func(e events.PostPublished) {
+		log.Printf("Post %d by user %d published", e.PostID, e.UserID)
+	})
+	go scheduler.NewPublisher(db, handlerInstance.Events).Start(30 * time.Second)
 
 	// Initialize router and register routes
 	router := mux.NewRouter()
@@ -50,13 +91,17 @@ func main() {
 	// Enable CORS
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins([]string{"http://localhost:3000"}), // Allow frontend requests
-		handlers.AllowedMethods([]string{"GET", "POST", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowCredentials(), // the identity link request sets the login state cookie
 	)(router)
 
 	// Start the WebSocket Hub
 	go handler.StartHub()
 
+	// Access tokens of revoked sessions are refused, including those revoked by another instance
+	go batch.Every(5*time.Second, handlerInstance.SyncRevokedSessions)
+
 	// Start the HTTP server
 	log.Printf("Server started on port %s", portNum)
 	fmt.Println("Press CTRL+C to stop the server.")
@@ -65,3 +110,23 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// runMediaMigration moves legacy uploads into the ID based layout and reports anything left over
+func runMediaMigration(db *database.DBInterface, fm *database.FileManager) {
+	report, err := fm.MigrateLegacyMedia(db)
+	if err != nil {
+		log.Fatalf("Media migration failed after moving %d files: %v", report.Moved, err)
+	}
+
+	log.Printf("Moved %d files", report.Moved)
+	for _, skipped := range report.Skipped {
+		log.Printf("Skipped %s", skipped)
+	}
+	for _, missing := range report.Missing {
+		log.Printf("Missing file %q for post %d of user %d", missing.FileName, missing.PostID, missing.UserID)
+	}
+	if len(report.Missing) > 0 {
+		log.Fatalf("Verification failed: %d post files are missing", len(report.Missing))
+	}
+	log.Println("Media migration verified")
+}
@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may drift from ours
+const clockSkew = time.Minute
+
+// jsonWebKey is an RSA public key from the provider's JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+
+	public *rsa.PublicKey
+}
+
+// idTokenClaims are the ID token claims we check or use
+type idTokenClaims struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"`
+	ExpiresAt         int64           `json:"exp"`
+	IssuedAt          int64           `json:"iat"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	EmailVerified     bool            `json:"email_verified"`
+	PreferredUsername string          `json:"preferred_username"`
+}
+
+// audiences handles aud being either a string or an array
+func (c idTokenClaims) audiences() []string {
+	var single string
+	if json.Unmarshal(c.Audience, &single) == nil {
+		return []string{single}
+	}
+	var many []string
+	json.Unmarshal(c.Audience, &many)
+	return many
+}
+
+// publicKey returns the RSA key with the given kid, refetching the JWKS once if it's unknown
+func (p *Provider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key.public, nil
+	}
+
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, doc.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch keys for %s: %w", p.Name, err)
+	}
+
+	keys := map[string]*jsonWebKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		k.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		keys[k.Kid] = k
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key.public, nil
+	}
+	return nil, fmt.Errorf("no key %q published by %s", kid, p.Name)
+}
+
+// verifyIDToken checks the RS256 signature and the standard claims of an ID token
+func (p *Provider) verifyIDToken(ctx context.Context, token, nonce string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed id token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported id token algorithm %q", header.Alg)
+	}
+
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid id token signature: %w", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token payload: %w", err)
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed id token payload: %w", err)
+	}
+
+	if claims.Issuer != p.Issuer {
+		return nil, fmt.Errorf("id token issuer %q does not match %q", claims.Issuer, p.Issuer)
+	}
+	audienceOK := false
+	for _, aud := range claims.audiences() {
+		if aud == p.ClientID {
+			audienceOK = true
+		}
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("id token was not issued for this client")
+	}
+	if time.Now().Add(-clockSkew).Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("id token expired")
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("id token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("id token has no subject")
+	}
+
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package reaper
+
+import (
+	"log"
+	"time"
+
+	"SpotLight/backend/src/batch"
+	"SpotLight/backend/src/database"
+)
+
+// Reaper deletes expired posts and their media. Any number of reapers may run against the same
+// database, each batch is claimed with SKIP LOCKED so no post is handled twice.
+type Reaper struct {
+	DB        *database.DBInterface
+	FM        *database.FileManager
+	BatchSize int // batch.DefaultSize when zero
+}
+
+// NewReaper returns a reaper using the default batch size
+func NewReaper(db *database.DBInterface, fm *database.FileManager) *Reaper {
+	return &Reaper{DB: db, FM: fm, BatchSize: batch.DefaultSize}
+}
+
+// RunOnce reaps batches until no expired posts are left and returns how many were deleted
+func (r *Reaper) RunOnce() (int, error) {
+	return batch.Drain(r.BatchSize, func(size int) (int, error) {
+		reaped, err := r.DB.ReapExpiredPosts(size)
+		if err != nil {
+			return 0, err
+		}
+
+		// the rows are gone, so a failure here only leaves files nobody can reach
+		for _, post := range reaped {
+			if err := r.FM.DeletePostFolder(post.UserID, post.PostID); err != nil {
+				log.Printf("Failed to delete files of expired post %d: %v", post.PostID, err)
+			}
+		}
+		return len(reaped), nil
+	})
+}
+
+// Start runs RunOnce every interval until the process exits
+func (r *Reaper) Start(interval time.Duration) {
+	batch.Every(interval, func() {
+		if n, err := r.RunOnce(); err != nil {
+			log.Printf("Expired post cleanup failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d expired posts", n)
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package routes
 
 import (
+	"net/http"
+
+	"SpotLight/backend/src/database"
 	"SpotLight/backend/src/handler"
 
 	"github.com/gorilla/mux"
@@ -8,17 +11,57 @@ import (
 
 // RegisterRoutes sets up API endpoints
 func RegisterRoutes(router *mux.Router, h *handler.RequestHandler) {
+	// Resolve the caller's identity from the Authorization header
+	router.Use(h.AuthMiddleware)
+
 	// User-related routes
 	router.HandleFunc("/api/register", h.HandleRegister).Methods("POST")
 	router.HandleFunc("/api/login", h.HandleLogin).Methods("POST")
 	router.HandleFunc("/api/delete-user", h.HandleDeleteUser).Methods("DELETE")
 	router.HandleFunc("/api/profile/{id}", h.HandleGetProfilePosts).Methods("GET")
+	router.HandleFunc("/api/users/{id}/follow", h.HandleFollowUser).Methods("POST")
+	router.HandleFunc("/api/users/{id}/follow", h.HandleUnfollowUser).Methods("DELETE")
+
+	// Session routes
+	router.HandleFunc("/api/token/refresh", h.HandleRefreshToken).Methods("POST")
+	router.HandleFunc("/api/logout", h.HandleLogout).Methods("POST")
+	router.HandleFunc("/api/sessions", h.HandleListSessions).Methods("GET")
+	router.HandleFunc("/api/sessions", h.HandleRevokeAllSessions).Methods("DELETE")
+	router.HandleFunc("/api/sessions/{id}", h.HandleRevokeSession).Methods("DELETE")
+
+	// External login routes
+	router.HandleFunc("/api/auth/providers", h.HandleListAuthProviders).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/{provider}/start", h.HandleOIDCStart).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/{provider}/callback", h.HandleOIDCCallback).Methods("GET")
+	router.HandleFunc("/api/account/identities", h.HandleListIdentities).Methods("GET")
+	router.HandleFunc("/api/account/identities/{provider}", h.HandleLinkIdentity).Methods("POST")
+
+	// Account and password routes
+	router.HandleFunc("/api/account/password", h.HandleChangePassword).Methods("POST")
+	router.HandleFunc("/api/account/username", h.HandleChangeUsername).Methods("PUT")
+	router.HandleFunc("/api/password-reset/request", h.HandleRequestPasswordReset).Methods("POST")
+	router.HandleFunc("/api/password-reset/confirm", h.HandleConfirmPasswordReset).Methods("POST")
+
+	// Data export routes
+	router.HandleFunc("/api/account/exports", h.HandleRequestExport).Methods("POST")
+	router.HandleFunc("/api/account/exports", h.HandleListExports).Methods("GET")
+	router.HandleFunc("/api/account/exports/{id}", h.HandleGetExport).Methods("GET")
+	router.HandleFunc("/api/account/exports/{id}/download", h.HandleDownloadExport).Methods("GET")
 
 	// Post-related routes
 	router.HandleFunc("/api/posts", h.HandleGetPosts).Methods("GET")
 	router.HandleFunc("/api/posts", h.HandleCreatePost).Methods("POST")
+	// Map clusters, ahead of /api/posts/{id} which would match them too
+	router.HandleFunc("/api/posts/clusters", h.HandleGetPostClusters).Methods("GET")
 	router.HandleFunc("/api/posts/{id}", h.HandleGetSpecificPost).Methods("GET")
+	router.HandleFunc("/api/posts/{id}", h.HandleEditPost).Methods("PUT")
 	router.HandleFunc("/api/posts/{id}", h.HandleDeletePost).Methods("DELETE")
+	router.HandleFunc("/api/posts/{id}/revisions", h.HandleGetPostRevisions).Methods("GET")
+
+	// Scheduled post routes
+	router.HandleFunc("/api/account/scheduled-posts", h.HandleListScheduledPosts).Methods("GET")
+	router.HandleFunc("/api/account/scheduled-posts/{id}", h.HandleReschedulePost).Methods("PUT")
+	router.HandleFunc("/api/account/scheduled-posts/{id}", h.HandleCancelScheduledPost).Methods("DELETE")
 
 	// Like-related routes
 	router.HandleFunc("/api/posts/{id}/like", h.HandleLikePost).Methods("POST")
@@ -26,6 +69,19 @@ func RegisterRoutes(router *mux.Router, h *handler.RequestHandler) {
 	router.HandleFunc("/api/posts/{id}/likes", h.HandleGetPostLikes).Methods("GET")
 	router.HandleFunc("/api/posts/{id}/liked", h.HandleCheckPostLiked).Methods("GET")
 
+	// Bookmark routes
+	router.HandleFunc("/api/posts/{id}/bookmark", h.HandleBookmarkPost).Methods("POST")
+	router.HandleFunc("/api/posts/{id}/unbookmark", h.HandleUnbookmarkPost).Methods("POST")
+	router.HandleFunc("/api/bookmarks", h.HandleGetBookmarks).Methods("GET")
+	router.HandleFunc("/api/bookmarks/collections", h.HandleListBookmarkCollections).Methods("GET")
+	router.HandleFunc("/api/bookmarks/collections", h.HandleCreateBookmarkCollection).Methods("POST")
+	router.HandleFunc("/api/bookmarks/collections/{id}", h.HandleRenameBookmarkCollection).Methods("PUT")
+	router.HandleFunc("/api/bookmarks/collections/{id}", h.HandleDeleteBookmarkCollection).Methods("DELETE")
+
+	// Poll routes
+	router.HandleFunc("/api/posts/{id}/poll/vote", h.HandleVotePoll).Methods("POST")
+	router.HandleFunc("/api/posts/{id}/poll/vote", h.HandleChangePollVote).Methods("PUT")
+
 	// Comment-related routes
 	router.HandleFunc("/api/posts/{id}/comments", h.HandleCreateComment).Methods("POST")
 	router.HandleFunc("/api/posts/{id}/comments", h.HandleGetNestedComments).Methods("GET")
@@ -41,4 +97,18 @@ func RegisterRoutes(router *mux.Router, h *handler.RequestHandler) {
 
 	// Search route
 	router.HandleFunc("/api/search", h.HandleSearch).Methods("GET")
+	router.HandleFunc("/api/tags/{tag}", h.HandleGetTagPosts).Methods("GET")
+
+	// Admin routes, moderators and up get in, admin-only routes are guarded again
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(h.RequireRole(database.RoleModerator))
+	adminOnly := h.RequireRole(database.RoleAdmin)
+	admin.HandleFunc("/users", h.HandleAdminListUsers).Methods("GET")
+	admin.HandleFunc("/users/{id}/suspend", h.HandleAdminSuspendUser).Methods("POST")
+	admin.HandleFunc("/users/{id}/unsuspend", h.HandleAdminUnsuspendUser).Methods("POST")
+	admin.Handle("/users/{id}/role", adminOnly(http.HandlerFunc(h.HandleAdminSetRole))).Methods("PUT")
+	admin.Handle("/users/{id}", adminOnly(http.HandlerFunc(h.HandleAdminDeleteUser))).Methods("DELETE")
+	admin.HandleFunc("/posts/{id}", h.HandleAdminDeletePost).Methods("DELETE")
+	admin.HandleFunc("/comments/{id}", h.HandleAdminDeleteComment).Methods("DELETE")
+	admin.Handle("/lockouts", adminOnly(http.HandlerFunc(h.HandleClearLoginLockout))).Methods("DELETE")
 }
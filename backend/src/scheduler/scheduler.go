@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"SpotLight/backend/src/batch"
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/events"
+)
+
+// Publisher puts scheduled posts out once their time comes and raises the same PostPublished
+// event a normal post gets. Several publishers may share a database, each post is claimed once.
+type Publisher struct {
+	DB        *database.DBInterface
+	Events    *events.Bus
+	BatchSize int // batch.DefaultSize when zero
+}
+
+// NewPublisher returns a publisher claiming batch.DefaultSize posts at a time
+func NewPublisher(db *database.DBInterface, bus *events.Bus) *Publisher {
+	return &Publisher{DB: db, Events: bus, BatchSize: batch.DefaultSize}
+}
+
+// RunOnce publishes every post that is due and returns how many went out
+func (p *Publisher) RunOnce() (int, error) {
+	return batch.Drain(p.BatchSize, func(size int) (int, error) {
+		published, err := p.DB.PublishDuePosts(size)
+		if err != nil {
+			return 0, err
+		}
+		for _, post := range published {
+			p.Events.PublishPost(events.PostPublished{PostID: post.PostID, UserID: post.UserID})
+		}
+		return len(published), nil
+	})
+}
+
+// Start publishes due posts every interval, logging failures, until the process exits
+func (p *Publisher) Start(interval time.Duration) {
+	batch.Every(interval, func() {
+		if _, err := p.RunOnce(); err != nil {
+			log.Printf("Publishing scheduled posts failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestAdminRoutesRequireRole verifies regular users can't reach the admin API
+func TestAdminRoutesRequireRole(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db})
+	for _, rc := range routeCases {
+		if !strings.HasPrefix(rc.path, "/api/admin/") {
+			continue
+		}
+		req := httptest.NewRequest(rc.method, strings.ReplaceAll(rc.path, "{id}", "1"), strings.NewReader(`{}`))
+		req = bearer(t, req, userID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403 for a regular user, got %d", rc.method, rc.path, rec.Code)
+		}
+	}
+}
+
+// TestModeratorActions verifies moderators can suspend users and remove content but not delete accounts
+func TestModeratorActions(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	modID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if err := db.SetUserRole(modID, database.RoleModerator); err != nil {
+		t.Fatalf("Failed to promote moderator: %v", err)
+	}
+
+	if err := db.CreatePost(userID, "Rule breaking post", 0, 0); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	_, posts, err := db.GetUserPosts(userID)
+	if err != nil || len(posts) == 0 {
+		t.Fatalf("Failed to retrieve posts: %v", err)
+	}
+	postID := extractPostID(t, posts[0]["post_id"])
+
+	handlerInstance := &handler.RequestHandler{DB: db, FM: fm}
+	router := newTestRouter(handlerInstance)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = bearer(t, req, modID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	userPath := "/api/admin/users/" + strconv.Itoa(userID)
+
+	rec := send("GET", "/api/admin/users?query=testUser", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 listing users, got %d", rec.Code)
+	}
+	var users []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&users); err != nil {
+		t.Fatalf("Failed to decode users: %v", err)
+	}
+	foundMod := false
+	for _, u := range users {
+		if u["username"] == "testUser2" && u["role"] == database.RoleModerator {
+			foundMod = true
+		}
+	}
+	if !foundMod {
+		t.Errorf("Expected moderator role in user listing, got %v", users)
+	}
+
+	// suspend blocks login, unsuspend restores it
+	if rec := send("POST", userPath+"/suspend", `{"reason":"spam","hours":1}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 suspending user, got %d", rec.Code)
+	}
+	if rec := attemptLogin(handlerInstance, "password"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 logging into a suspended account, got %d", rec.Code)
+	}
+	if rec := send("POST", userPath+"/unsuspend", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 unsuspending user, got %d", rec.Code)
+	}
+	if rec := attemptLogin(handlerInstance, "password"); rec.Code != http.StatusOK {
+		t.Errorf("Expected login after unsuspend, got %d", rec.Code)
+	}
+
+	if rec := send("DELETE", "/api/admin/posts/"+strconv.Itoa(postID), ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected moderator to force-delete post, got %d", rec.Code)
+	}
+
+	// account deletion and role changes are admin-only
+	if rec := send("DELETE", userPath, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for moderator deleting an account, got %d", rec.Code)
+	}
+	if rec := send("PUT", userPath+"/role", `{"role":"admin"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for moderator changing roles, got %d", rec.Code)
+	}
+
+	// an admin can delete the account
+	if err := db.SetUserRole(modID, database.RoleAdmin); err != nil {
+		t.Fatalf("Failed to promote admin: %v", err)
+	}
+	if rec := send("DELETE", userPath, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected admin to delete account, got %d", rec.Code)
+	}
+	if _, err := db.Authenticate("testUser", "password"); err == nil {
+		t.Errorf("Deleted account can still log in")
+	}
+}
@@ -0,0 +1,122 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pngMedia returns a base64 encoded PNG of the given size
+func pngMedia(t *testing.T, width, height int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode png: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// TestPostAttachments creates a post with several files, edits the album and deletes the post
+func TestPostAttachments(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, bearer(t, req, userID))
+		return rec
+	}
+
+	body := fmt.Sprintf(`{"user_id":%d,"content":"Album","attachments":[
+		{"file_name":"wide.png","media":%q},
+		{"file_name":"notes.txt","media":"some notes"},
+		{"file_name":"tall.png","media":%q}]}`, userID, pngMedia(t, 4, 2), pngMedia(t, 1, 3))
+	if rec := send("POST", "/api/posts", body); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected create 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	postID, err := db.GetLastPostByUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+
+	attachments, err := db.GetAttachments(postID)
+	if err != nil || len(attachments) != 3 {
+		t.Fatalf("Expected 3 attachments, got %+v, %v", attachments, err)
+	}
+	wide, notes, tall := attachments[0], attachments[1], attachments[2]
+	if wide.FileName != "wide.png" || wide.MimeType != "image/png" || wide.Width == nil || *wide.Width != 4 || *wide.Height != 2 {
+		t.Errorf("Unexpected first attachment %+v", wide)
+	}
+	if notes.FileName != "notes.txt" || !strings.HasPrefix(notes.MimeType, "text/plain") || notes.Width != nil || notes.SizeBytes != int64(len("some notes")) {
+		t.Errorf("Unexpected second attachment %+v", notes)
+	}
+	if tall.Position != 2 || *tall.Width != 1 || *tall.Height != 3 {
+		t.Errorf("Unexpected third attachment %+v", tall)
+	}
+
+	post, err := db.GetPostById(postID)
+	if err != nil || post["file_name"] != "wide.png" {
+		t.Errorf("Expected file_name to point at the first attachment, got %v, %v", post["file_name"], err)
+	}
+
+	// keep the notes, drop both images and add a new file in front
+	postPath := "/api/posts/" + strconv.Itoa(postID)
+	edit := fmt.Sprintf(`{"content":"Album v2","attachments":[{"file_name":"new.txt","media":"new"},{"attachment_id":%d}]}`, notes.ID)
+	if rec := send("PUT", postPath, edit); rec.Code != http.StatusOK {
+		t.Fatalf("Expected edit 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var edited struct {
+		FileName    string                `json:"file_name"`
+		Attachments []database.Attachment `json:"attachments"`
+	}
+	rec := send("GET", postPath, "")
+	json.NewDecoder(rec.Body).Decode(&edited)
+	if len(edited.Attachments) != 2 || edited.Attachments[0].FileName != "new.txt" || edited.Attachments[1].ID != notes.ID || edited.FileName != "new.txt" {
+		t.Errorf("Unexpected attachments after edit %+v", edited)
+	}
+	if _, err := fm.GetPostFile(userID, postID, "wide.png"); err == nil {
+		t.Errorf("Expected dropped attachment files to be removed")
+	}
+
+	if rec := send("PUT", postPath, `{"content":"x","attachments":[{"attachment_id":999999}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown attachment, got %d", rec.Code)
+	}
+	if rec := send("PUT", postPath, `{"content":"x","attachments":[{"file_name":"notes.txt","media":"again"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 reusing a current filename, got %d", rec.Code)
+	}
+
+	revisions, err := db.GetPostRevisions(postID)
+	if err != nil || len(revisions) != 1 || len(revisions[0].Attachments) != 3 {
+		t.Fatalf("Expected the revision to keep the old album, got %+v, %v", revisions, err)
+	}
+
+	if rec := send("DELETE", postPath, ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected delete 200, got %d", rec.Code)
+	}
+	if _, err := fm.GetPostFile(userID, postID, "notes.txt"); err == nil {
+		t.Errorf("Expected the post folder to be removed with the post")
+	}
+}
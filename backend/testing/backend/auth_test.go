@@ -0,0 +1,171 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/auth"
+	"SpotLight/backend/src/handler"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTokenRoundTrip verifies an issued token parses back to the same user
+func TestTokenRoundTrip(t *testing.T) {
+	token, expiresAt, err := auth.IssueToken(42, 3)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	if claims.UserID != 42 {
+		t.Errorf("Expected user 42, got %d", claims.UserID)
+	}
+	if claims.SessionID != 3 {
+		t.Errorf("Expected session 3, got %d", claims.SessionID)
+	}
+	if claims.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("Expected expiry %d, got %d", expiresAt.Unix(), claims.ExpiresAt)
+	}
+}
+
+// TestTamperedTokenRejected verifies a token with a modified payload fails verification
+func TestTamperedTokenRejected(t *testing.T) {
+	token, _, err := auth.IssueToken(1, 1)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	other, _, err := auth.IssueToken(2, 2)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	// swap the payload of user 2 into user 1's token
+	parts := strings.Split(token, ".")
+	otherParts := strings.Split(other, ".")
+	forged := parts[0] + "." + otherParts[1] + "." + parts[2]
+
+	if _, err := auth.ParseToken(forged); err == nil {
+		t.Fatalf("Expected forged token to be rejected")
+	}
+}
+
+// TestAuthMiddleware verifies the middleware sets identity for good tokens and rejects bad ones
+func TestAuthMiddleware(t *testing.T) {
+	h := &handler.RequestHandler{}
+	var seenID int
+	var seenOK bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID, seenOK = handler.UserIDFromContext(r.Context())
+	})
+	mw := h.AuthMiddleware(next)
+
+	// valid token
+	token, _, _ := auth.IssueToken(7, 5)
+	req := httptest.NewRequest("GET", "/api/posts", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if !seenOK || seenID != 7 {
+		t.Errorf("Expected user 7 on context, got %d (ok=%v)", seenID, seenOK)
+	}
+
+	// no token passes through anonymously
+	seenID, seenOK = 0, false
+	req = httptest.NewRequest("GET", "/api/posts", nil)
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if seenOK {
+		t.Errorf("Expected anonymous request, got user %d", seenID)
+	}
+
+	// garbage token is rejected
+	req = httptest.NewRequest("GET", "/api/posts", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for bad token, got %d", rec.Code)
+	}
+}
+
+// TestLoginReturnsToken verifies login issues a token for the logged in user
+func TestLoginReturnsToken(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"testUser","password":"password"}`))
+	rec := httptest.NewRecorder()
+	handlerInstance := handler.RequestHandler{DB: db}
+	handlerInstance.HandleLogin(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var responseData map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&responseData); err != nil {
+		t.Fatalf("Failed to decode response JSON: %v", err)
+	}
+
+	token, _ := responseData["token"].(string)
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		t.Fatalf("Login returned an unusable token: %v", err)
+	}
+	if claims.UserID != int(responseData["user_id"].(float64)) {
+		t.Errorf("Token user %d does not match user_id %v", claims.UserID, responseData["user_id"])
+	}
+}
+
+// TestCreatePostRequiresMatchingUser verifies posts can't be created without auth or for someone else
+func TestCreatePostRequiresMatchingUser(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	postBody, _ := json.Marshal(map[string]interface{}{
+		"user_id":   userID,
+		"content":   "Impersonated post",
+		"latitude":  0,
+		"longitude": 0,
+	})
+	handlerInstance := handler.RequestHandler{DB: db}
+
+	// anonymous
+	req := httptest.NewRequest("POST", "/api/posts", bytes.NewBuffer(postBody))
+	rec := httptest.NewRecorder()
+	handlerInstance.HandleCreatePost(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a session, got %d", rec.Code)
+	}
+
+	// authenticated as a different user
+	req = httptest.NewRequest("POST", "/api/posts", bytes.NewBuffer(postBody))
+	req = authenticate(req, userID+1)
+	rec = httptest.NewRecorder()
+	handlerInstance.HandleCreatePost(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for mismatched user_id, got %d", rec.Code)
+	}
+}
@@ -31,6 +31,11 @@ func extractPostID(t *testing.T, raw interface{}) int {
 	}
 }
 
+// authenticate attaches a user's identity to a request the same way AuthMiddleware does
+func authenticate(req *http.Request, userID int) *http.Request {
+	return req.WithContext(handler.WithUserID(req.Context(), userID))
+}
+
 // setupTestDB initializes the test database connection
 func setupTestDB(t *testing.T) (*database.DBInterface, *bool) {
 	t.Helper()
@@ -53,26 +58,21 @@ func cleanupTestData(db *database.DBInterface, userCreated *bool, t *testing.T)
 	}
 }
 
-// alternative cleanup removes test users at the end of each test
+// alternative cleanup removes test users and their media folders at the end of each test
 func cleanupTestDataAll(db *database.DBInterface, fm *database.FileManager, userCreated *bool, t *testing.T) {
 	t.Helper()
 	if *userCreated {
-		err := db.DeleteUser("testUser")
-		if err != nil {
-			t.Logf("Warning: Failed to delete test user: %v", err)
-		}
-		err = fm.DeleteUserFolder("testUser")
-		if err != nil {
-			t.Logf("Warning: Failed to delete test user folder: %v", err)
-		}
 		// second user if it exists
-		err = db.DeleteUser("testUser2")
-		if err != nil {
-			t.Logf("Warning: Failed to delete test user: %v", err)
-		}
-		err = fm.DeleteUserFolder("testUser2")
-		if err != nil {
-			t.Logf("Warning: Failed to delete test user folder: %v", err)
+		for _, username := range []string{"testUser", "testUser2"} {
+			// folders are keyed by ID, so look it up before the user is gone
+			if userID, err := db.GetUserIdByName(username); err == nil {
+				if err := fm.DeleteUserFolder(userID); err != nil {
+					t.Logf("Warning: Failed to delete test user folder: %v", err)
+				}
+			}
+			if err := db.DeleteUser(username); err != nil {
+				t.Logf("Warning: Failed to delete test user: %v", err)
+			}
 		}
 	}
 }
@@ -170,6 +170,7 @@ func TestCreatePostEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db}
+	req = authenticate(req, userID)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -213,10 +214,16 @@ func TestDeleteUserEndpoint(t *testing.T) {
 	}
 	*userCreated = true
 
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
 	// Send DELETE request to API
 	reqBody, _ := json.Marshal(map[string]string{"username": "testUser"})
 	req := httptest.NewRequest("DELETE", "/api/delete-user", bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
+	req = authenticate(req, userID)
 	rec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db, FM: fm}
@@ -269,6 +276,7 @@ func TestDeletePostEndpoint(t *testing.T) {
 	postRec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db}
+	postReq = authenticate(postReq, userID)
 	handlerInstance.HandleCreatePost(postRec, postReq)
 
 	if postRec.Code != http.StatusCreated {
@@ -296,6 +304,7 @@ func TestDeletePostEndpoint(t *testing.T) {
 
 	deleteReq := httptest.NewRequest("DELETE", "/api/posts/"+strconv.Itoa(postID), nil)
 	deleteReq = mux.SetURLVars(deleteReq, map[string]string{"id": strconv.Itoa(postID)})
+	deleteReq = authenticate(deleteReq, userID)
 	deleteRec := httptest.NewRecorder()
 
 	handlerInstance.HandleDeletePost(deleteRec, deleteReq)
@@ -364,6 +373,7 @@ func TestCreatePostFileEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db, FM: fm}
+	req = authenticate(req, userID)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -409,6 +419,7 @@ func TestGetPostFileEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db, FM: fm}
+	req = authenticate(req, userID)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -532,6 +543,7 @@ func TestGetPostByIdEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db, FM: fm}
+	req = authenticate(req, userID)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -555,6 +567,7 @@ func TestGetPostByIdEndpoint(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rec = httptest.NewRecorder()
 
+	req = authenticate(req, userID)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -665,6 +678,7 @@ func TestGetProfilePostsEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	handlerInstance := handler.RequestHandler{DB: db, FM: fm}
+	req = authenticate(req, userID)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -688,6 +702,7 @@ func TestGetProfilePostsEndpoint(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rec = httptest.NewRecorder()
 
+	req = authenticate(req, userID2)
 	handlerInstance.HandleCreatePost(rec, req)
 
 	if rec.Code != http.StatusCreated {
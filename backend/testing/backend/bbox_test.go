@@ -0,0 +1,172 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestParseBBox checks viewports are validated and split at the antimeridian
+func TestParseBBox(t *testing.T) {
+	cases := map[string][]database.Box{
+		"-82.5,29.5,-82,30":   {{MinLon: -82.5, MinLat: 29.5, MaxLon: -82, MaxLat: 30}},
+		"-180,-90,180,90":     {{MinLon: -180, MinLat: -90, MaxLon: 180, MaxLat: 90}},
+		"170, -10, -170, 10":  {{MinLon: 170, MinLat: -10, MaxLon: 180, MaxLat: 10}, {MinLon: -180, MinLat: -10, MaxLon: -170, MaxLat: 10}},
+		"179.5,60,179.5,60.5": {{MinLon: 179.5, MinLat: 60, MaxLon: 179.5, MaxLat: 60.5}},
+	}
+	for in, want := range cases {
+		if got, err := database.ParseBBox(in); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %+v, got %+v, %v", in, want, got, err)
+		}
+	}
+
+	for _, bad := range []string{"", "1,2,3", "1,2,3,4,5", "a,0,1,1", "-181,0,0,1", "0,-91,1,0", "0,0,181,1", "0,10,1,5", "NaN,0,1,1", "0,0,Inf,1"} {
+		if _, err := database.ParseBBox(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+
+	router := newTestRouter(&handler.RequestHandler{})
+	for _, path := range []string{"/api/posts?bbox=0,10,1,5", "/api/posts?bbox=", "/api/tags/uf?bbox=0,0,200,1"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, rec.Code)
+		}
+	}
+}
+
+// TestBBoxFeed checks the viewport mode finds posts on both sides of the antimeridian and
+// combines with sorting and paging
+func TestBBoxFeed(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	// east of the antimeridian, west of it, and one just outside the viewport
+	var ids []int
+	for _, p := range [][2]float64{{-17.7, 178.4}, {-17.8, -179.9}, {-17.75, 180}, {-17.7, 177.9}} {
+		id, err := db.SavePost(database.NewPost{UserID: userID, Content: "bboxcheck", Latitude: p[0], Longitude: p[1]}, nil)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := db.LikePost(userID, ids[1]); err != nil {
+		t.Fatalf("Failed to like post: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	feed := func(query string) []int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/posts?bbox=178,-18,-179,-17"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var posts []map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&posts)
+		found := []int{}
+		for _, p := range posts {
+			if extractPostID(t, p["user_id"]) == userID {
+				found = append(found, extractPostID(t, p["post_id"]))
+			}
+		}
+		return found
+	}
+
+	if got := feed("&sort=new"); !reflect.DeepEqual(got, []int{ids[2], ids[1], ids[0]}) {
+		t.Errorf("Expected the three posts in the viewport, newest first, got %v", got)
+	}
+	if got := feed("&sort=top&limit=1"); !reflect.DeepEqual(got, []int{ids[1]}) {
+		t.Errorf("Expected the liked post first, got %v", got)
+	}
+	if got := feed("&sort=new&limit=1&offset=2&time=today"); !reflect.DeepEqual(got, []int{ids[0]}) {
+		t.Errorf("Expected the oldest post on the last page, got %v", got)
+	}
+	// the radius is ignored in favour of the viewport
+	if got := feed("&latitude=0&longitude=0&distance=1"); len(got) != 3 {
+		t.Errorf("Expected the viewport to replace the radius, got %v", got)
+	}
+}
+
+// TestBBoxFeedShownLocation checks viewports match posts where the caller is shown them, so
+// shrinking one around a coarse post can't find its true location
+func TestBBoxFeedShownLocation(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	readerID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	const lat, lon = -48.8367, -123.3633
+	postID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "bboxcheck", Latitude: lat, Longitude: lon,
+		LocationPrecision: database.PrecisionCity}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	shownLat, shownLon := database.SnapLocation(lat, lon, database.PrecisionCity)
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	// feed returns the post's location in the viewport around a point, if it's listed
+	feed := func(userID int, lat, lon float64) (map[string]interface{}, bool) {
+		t.Helper()
+		path := fmt.Sprintf("/api/posts?bbox=%v,%v,%v,%v", lon-0.001, lat-0.001, lon+0.001, lat+0.001)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, bearer(t, httptest.NewRequest("GET", path, nil), userID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var posts []map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&posts)
+		for _, p := range posts {
+			if extractPostID(t, p["post_id"]) == postID {
+				return p, true
+			}
+		}
+		return nil, false
+	}
+
+	if _, ok := feed(readerID, lat, lon); ok {
+		t.Errorf("Expected a viewport around the true location to miss the coarse post")
+	}
+	if p, ok := feed(readerID, shownLat, shownLon); !ok || p["latitude"] != shownLat || p["longitude"] != shownLon {
+		t.Errorf("Expected the coarse post in a viewport around %v, %v, got %v", shownLat, shownLon, p)
+	}
+	if _, ok := feed(authorID, lat, lon); !ok {
+		t.Errorf("Expected the author to find their post where it is")
+	}
+	if _, ok := feed(authorID, shownLat, shownLon); ok {
+		t.Errorf("Expected the author's viewport to use the true location")
+	}
+}
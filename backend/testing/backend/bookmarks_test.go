@@ -0,0 +1,162 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBookmarks checks saving and removing posts, paging through them, grouping them into
+// collections and the bookmarked flag in the feed
+func TestBookmarks(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	readerID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	send := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = bearer(t, req, userID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	bookmarks := func(query string) []int {
+		t.Helper()
+		rec := send("GET", "/api/bookmarks"+query, readerID, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected bookmarks 200, got %d", rec.Code)
+		}
+		var posts []map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&posts)
+		ids := []int{}
+		for _, p := range posts {
+			if p["bookmarked"] != true {
+				t.Errorf("Expected bookmarked posts to be flagged, got %v", p["bookmarked"])
+			}
+			ids = append(ids, extractPostID(t, p["post_id"]))
+		}
+		return ids
+	}
+
+	var posts []int
+	for i := 0; i < 3; i++ {
+		id, err := db.SavePost(database.NewPost{UserID: authorID, Content: fmt.Sprintf("bookmarkcheck %d", i)}, nil)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		posts = append(posts, id)
+	}
+	privateID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "Just me", Visibility: database.VisibilityPrivate}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	rec := send("POST", "/api/bookmarks/collections", readerID, `{"name":"Food spots"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected collection 201, got %d", rec.Code)
+	}
+	var created struct {
+		CollectionID int `json:"collection_id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec := send("POST", "/api/bookmarks/collections", readerID, `{"name":" Food spots "}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate name, got %d", rec.Code)
+	}
+	if rec := send("POST", "/api/bookmarks/collections", readerID, `{"name":""}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty name, got %d", rec.Code)
+	}
+
+	for _, id := range posts {
+		if rec := send("POST", fmt.Sprintf("/api/posts/%d/bookmark", id), readerID, ""); rec.Code != http.StatusOK {
+			t.Fatalf("Expected bookmark 200, got %d", rec.Code)
+		}
+	}
+	// bookmarking again moves the post into the collection
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/bookmark", posts[0]), readerID, fmt.Sprintf(`{"collection_id":%d}`, created.CollectionID)); rec.Code != http.StatusOK {
+		t.Fatalf("Expected bookmark 200, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/bookmark", privateID), readerID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 bookmarking a hidden post, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/bookmark", posts[1]), authorID, fmt.Sprintf(`{"collection_id":%d}`, created.CollectionID)); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for someone else's collection, got %d", rec.Code)
+	}
+
+	if ids := bookmarks(""); len(ids) != 3 || ids[0] != posts[2] {
+		t.Errorf("Expected three bookmarks, newest first, got %v", ids)
+	}
+	if ids := bookmarks("?limit=2&offset=2"); len(ids) != 1 || ids[0] != posts[0] {
+		t.Errorf("Expected the last page to hold the first bookmark, got %v", ids)
+	}
+	if ids := bookmarks(fmt.Sprintf("?collection_id=%d", created.CollectionID)); len(ids) != 1 || ids[0] != posts[0] {
+		t.Errorf("Expected the collection to hold one post, got %v", ids)
+	}
+
+	var collections []database.BookmarkCollection
+	json.NewDecoder(send("GET", "/api/bookmarks/collections", readerID, "").Body).Decode(&collections)
+	if len(collections) != 1 || collections[0].Name != "Food spots" || collections[0].BookmarkCount != 1 {
+		t.Errorf("Unexpected collections %+v", collections)
+	}
+	collectionPath := fmt.Sprintf("/api/bookmarks/collections/%d", created.CollectionID)
+	if rec := send("PUT", collectionPath, authorID, `{"name":"Mine now"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 renaming someone else's collection, got %d", rec.Code)
+	}
+	if rec := send("PUT", collectionPath, readerID, `{"name":"Eats"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected rename 200, got %d", rec.Code)
+	}
+
+	// the feed flags the caller's own bookmarks only
+	for userID, want := range map[int]bool{readerID: true, authorID: false} {
+		var feed []map[string]interface{}
+		json.NewDecoder(send("GET", "/api/posts?limit=100", userID, "").Body).Decode(&feed)
+		found := false
+		for _, p := range feed {
+			if extractPostID(t, p["post_id"]) == posts[1] {
+				found = true
+				if p["bookmarked"] != want {
+					t.Errorf("User %d: expected bookmarked %v, got %v", userID, want, p["bookmarked"])
+				}
+			}
+		}
+		if !found {
+			t.Errorf("User %d: expected the post in the feed", userID)
+		}
+	}
+
+	// deleting the collection keeps its bookmarks, unbookmarking removes one
+	if rec := send("DELETE", collectionPath, readerID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected delete 200, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/unbookmark", posts[1]), readerID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected unbookmark 200, got %d", rec.Code)
+	}
+	if ids := bookmarks(""); len(ids) != 2 || ids[0] != posts[2] || ids[1] != posts[0] {
+		t.Errorf("Expected two bookmarks left, got %v", ids)
+	}
+	if rec := send("GET", "/api/bookmarks?collection_id=abc", readerID, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid collection ID, got %d", rec.Code)
+	}
+}
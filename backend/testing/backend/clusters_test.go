@@ -0,0 +1,226 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// clustersResponse is the body of GET /api/posts/clusters
+type clustersResponse struct {
+	Zoom  int                     `json:"zoom"`
+	Tiles []database.TileClusters `json:"tiles"`
+}
+
+// TestTilesFor checks viewports map onto the tiles covering them, and that the bbox of a tile
+// asks for that tile alone
+func TestTilesFor(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		zoom := rng.Intn(database.MaxClusterZoom + 1)
+		tile := database.Tile{Zoom: zoom, X: rng.Intn(1 << zoom), Y: rng.Intn(1 << zoom)}
+		if i%4 == 0 {
+			tile.X = 1<<zoom - 1 // the eastmost column ends on the antimeridian
+		}
+		b := tile.Box()
+		got, err := database.TilesFor([]database.Box{b}, zoom)
+		if err != nil || !reflect.DeepEqual(got, []database.Tile{tile}) {
+			t.Errorf("%v: expected only itself for %+v, got %v, %v", tile, b, got, err)
+		}
+	}
+
+	cases := []struct {
+		bbox  string
+		zoom  int
+		tiles []string
+	}{
+		{"-180,-90,180,90", 0, []string{"0/0/0"}},
+		{"-180,-90,180,90", 1, []string{"1/0/0", "1/1/0", "1/0/1", "1/1/1"}},
+		{"170,-10,-170,10", 3, []string{"3/7/3", "3/7/4", "3/0/3", "3/0/4"}},
+		{"170,-10,-170,10", 0, []string{"0/0/0"}},
+		{"10,10,10,10", 5, []string{"5/16/14"}},
+	}
+	for _, c := range cases {
+		boxes, err := database.ParseBBox(c.bbox)
+		if err != nil {
+			t.Fatalf("%s: %v", c.bbox, err)
+		}
+		tiles, err := database.TilesFor(boxes, c.zoom)
+		got := []string{}
+		for _, tile := range tiles {
+			got = append(got, tile.String())
+		}
+		if err != nil || !reflect.DeepEqual(got, c.tiles) {
+			t.Errorf("%s at zoom %d: expected %v, got %v, %v", c.bbox, c.zoom, c.tiles, got, err)
+		}
+	}
+
+	world, _ := database.ParseBBox("-180,-90,180,90")
+	for _, zoom := range []int{-1, database.MaxClusterZoom + 1} {
+		if _, err := database.TilesFor(world, zoom); !errors.Is(err, database.ErrInvalidZoom) {
+			t.Errorf("Zoom %d: expected ErrInvalidZoom, got %v", zoom, err)
+		}
+	}
+	if _, err := database.TilesFor(world, 5); !errors.Is(err, database.ErrTooManyTiles) {
+		t.Errorf("Expected ErrTooManyTiles for the world at zoom 5, got %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{})
+	for _, query := range []string{"zoom=3", "bbox=0,10,1,5&zoom=3", "bbox=0,0,1,1", "bbox=0,0,1,1&zoom=x", "bbox=0,0,1,1&zoom=21", "bbox=-180,-90,180,90&zoom=5"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/posts/clusters?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+// TestPostClusters checks counts, centroids, top posts and timestamps of clusters, that
+// they're built from the locations the caller is shown, and that tiles fetched one by one add
+// up to the viewport
+func TestPostClusters(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	readerID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	// out in the South Pacific, where nothing else is posted
+	const lat, lon = -48.8767, -123.3933
+	post := func(p database.NewPost) int {
+		t.Helper()
+		p.UserID, p.Content = authorID, "clustercheck"
+		id, err := db.SavePost(p, nil)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		return id
+	}
+	var stacked []int
+	for i := 0; i < 3; i++ {
+		stacked = append(stacked, post(database.NewPost{Latitude: lat, Longitude: lon}))
+	}
+	if err := db.LikePost(readerID, stacked[1]); err != nil {
+		t.Fatalf("Failed to like post: %v", err)
+	}
+	hiddenID := post(database.NewPost{Latitude: lat, Longitude: lon, Visibility: database.VisibilityPrivate})
+	coarse := post(database.NewPost{Latitude: lat + 0.3, Longitude: lon + 0.3, LocationPrecision: database.PrecisionCity})
+	// near the pole a city cell is far wider than the true longitude is from its centre
+	polar := post(database.NewPost{Latitude: 89.97, Longitude: 10, LocationPrecision: database.PrecisionCity})
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	clusters := func(query string, userID int) (clustersResponse, *httptest.ResponseRecorder) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/posts/clusters?"+query, nil)
+		if userID != 0 {
+			req = bearer(t, req, userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp clustersResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp, rec
+	}
+	// find returns the cluster at a point, if any
+	find := func(resp clustersResponse, lat, lon float64) (database.Cluster, bool) {
+		for _, tile := range resp.Tiles {
+			for _, c := range tile.Clusters {
+				if math.Abs(c.Latitude-lat) < 1e-9 && math.Abs(c.Longitude-lon) < 1e-9 {
+					return c, true
+				}
+			}
+		}
+		return database.Cluster{}, false
+	}
+	bbox := fmt.Sprintf("bbox=%f,%f,%f,%f", lon-1, lat-1, lon+1, lat+1)
+
+	resp, rec := clusters(bbox+"&zoom=8&sort=top", readerID)
+	if resp.Zoom != 8 || len(resp.Tiles) < 2 {
+		t.Fatalf("Expected the viewport over several tiles, got %+v", resp)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private, max-age=60" {
+		t.Errorf("Expected a private cache for a signed in caller, got %q", got)
+	}
+	// the private post is left out for the reader
+	c, ok := find(resp, lat, lon)
+	if !ok || c.Count != 3 || c.TopPostID != stacked[1] {
+		t.Errorf("Expected three visible posts led by the liked one, got %+v", c)
+	}
+	latest, err := db.GetPostById(stacked[2])
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if c.NewestAt != latest["created_at"] {
+		t.Errorf("Expected newest_at %v, got %s", latest["created_at"], c.NewestAt)
+	}
+	newest, _ := clusters(bbox+"&zoom=8&sort=new", readerID)
+	if c, _ := find(newest, lat, lon); c.TopPostID != stacked[2] {
+		t.Errorf("Expected the newest post on top with sort=new, got %d", c.TopPostID)
+	}
+
+	// the reader sees the coarse post where it's shown to them, the author where it is
+	shownLat, shownLon := database.SnapLocation(lat+0.3, lon+0.3, database.PrecisionCity)
+	if c, ok := find(resp, shownLat, shownLon); !ok || c.Count != 1 || c.TopPostID != coarse {
+		t.Errorf("Expected the coarse post alone at its snapped location, got %+v", c)
+	}
+	mine, _ := clusters(bbox+"&zoom=8", authorID)
+	if c, ok := find(mine, lat+0.3, lon+0.3); !ok || c.TopPostID != coarse {
+		t.Errorf("Expected the author to see their post where it is, got %+v", c)
+	}
+	if c, _ := find(mine, lat, lon); c.Count != 4 || c.TopPostID != hiddenID {
+		t.Errorf("Expected the author to count their private post too, got %+v", c)
+	}
+
+	// fetching each tile on its own gives the same clusters, and anonymously a public cache
+	for _, tile := range resp.Tiles {
+		b := tile.BBox
+		one, rec := clusters(fmt.Sprintf("bbox=%v,%v,%v,%v&zoom=8&sort=top", b[0], b[1], b[2], b[3]), readerID)
+		if len(one.Tiles) != 1 || !reflect.DeepEqual(one.Tiles[0], tile) {
+			t.Errorf("Tile %s: expected %+v alone, got %+v", tile.Tile, tile, one.Tiles)
+		}
+		if rec.Header().Get("Vary") != "Authorization" {
+			t.Errorf("Expected responses to vary by caller")
+		}
+	}
+	if _, rec := clusters(bbox+"&zoom=8", 0); rec.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("Expected a public cache for anonymous callers, got %q", rec.Header().Get("Cache-Control"))
+	}
+
+	// the polar post is found in the tile its shown location falls in, far from its true one
+	polarLat, polarLon := database.SnapLocation(89.97, 10, database.PrecisionCity)
+	tiles, err := database.TilesFor([]database.Box{{MinLon: polarLon, MinLat: polarLat, MaxLon: polarLon, MaxLat: polarLat}}, 12)
+	if err != nil || len(tiles) != 1 {
+		t.Fatalf("Failed to find the polar tile: %v, %v", tiles, err)
+	}
+	b := tiles[0].Box()
+	polarResp, _ := clusters(fmt.Sprintf("bbox=%v,%v,%v,%v&zoom=12", b.MinLon, b.MinLat, b.MaxLon, b.MaxLat), readerID)
+	if c, ok := find(polarResp, polarLat, polarLon); !ok || c.TopPostID != polar {
+		t.Errorf("Expected the polar post at %v, %v, got %+v", polarLat, polarLon, polarResp.Tiles)
+	}
+}
@@ -55,6 +55,7 @@ func TestCreateTopLevelComment(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
+	req = authenticate(req, userID)
 	h.HandleCreateComment(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -77,6 +78,7 @@ func TestCreateReplyComment(t *testing.T) {
 	topReq = mux.SetURLVars(topReq, map[string]string{"id": strconv.Itoa(postID)})
 	topReq.Header.Set("Content-Type", "application/json")
 	topRec := httptest.NewRecorder()
+	topReq = authenticate(topReq, userID)
 	h.HandleCreateComment(topRec, topReq)
 
 	if topRec.Code != http.StatusOK {
@@ -100,6 +102,7 @@ func TestCreateReplyComment(t *testing.T) {
 	replyReq = mux.SetURLVars(replyReq, map[string]string{"id": strconv.Itoa(postID)})
 	replyReq.Header.Set("Content-Type", "application/json")
 	replyRec := httptest.NewRecorder()
+	replyReq = authenticate(replyReq, userID)
 	h.HandleCreateComment(replyRec, replyReq)
 
 	if replyRec.Code != http.StatusOK {
@@ -166,6 +169,7 @@ func TestDeleteCommentAndReplies(t *testing.T) {
 	// Delete parent
 	req := httptest.NewRequest("DELETE", "/api/comments/"+strconv.Itoa(parentID), nil)
 	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(parentID)})
+	req = authenticate(req, userID)
 	rec := httptest.NewRecorder()
 	h.HandleDeleteComment(rec, req)
 
@@ -0,0 +1,188 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCreatePostRejectsBadRequests checks every field of a new post is validated before
+// anything is stored. The handler has no database, so a request that gets past validation
+// fails here instead of being stored.
+func TestCreatePostRejectsBadRequests(t *testing.T) {
+	router := newTestRouter(&handler.RequestHandler{Uploads: handler.UploadLimits{MaxFileBytes: 16, MaxRequestBytes: 4096}})
+
+	tooMany := make([]string, database.MaxAttachments+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`{"file_name":"f%d.txt","media":"x"}`, i)
+	}
+	oversized := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("x"), 17))
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+
+	cases := []struct {
+		name   string
+		body   string
+		status int // 400 when left out
+	}{
+		// expires_in
+		{name: "negative ttl", body: `{"content":"hi","expires_in":-60}`},
+		{name: "short ttl", body: `{"content":"hi","expires_in":5}`},
+		{name: "long ttl", body: fmt.Sprintf(`{"content":"hi","expires_in":%d}`, int64((handler.MaxPostTTL + time.Second).Seconds()))},
+
+		// attachments
+		{name: "too many attachments", body: `{"content":"hi","attachments":[` + strings.Join(tooMany, ",") + `]}`},
+		{name: "duplicate attachment name", body: `{"content":"hi","attachments":[{"file_name":"a.txt","media":"x"},{"file_name":"a.txt","media":"y"}]}`},
+		{name: "path in attachment name", body: `{"content":"hi","attachments":[{"file_name":"../a.txt","media":"x"}]}`},
+		{name: "attachment without media", body: `{"content":"hi","attachments":[{"file_name":"a.png"}]}`},
+		{name: "existing attachment id", body: `{"content":"hi","attachments":[{"attachment_id":3}]}`},
+		{name: "attachment not base64", body: `{"content":"hi","attachments":[{"file_name":"a.png","media":"not base64!"}]}`},
+		{name: "oversized file", body: `{"content":"hi","file_name":"big.png","media":"` + oversized + `"}`, status: http.StatusRequestEntityTooLarge},
+
+		// publish_at
+		{name: "publish_at not a time", body: `{"content":"hi","publish_at":"tomorrow"}`},
+		{name: "publish_at in the past", body: fmt.Sprintf(`{"content":"hi","publish_at":%q}`, past)},
+		{name: "publish_at too far ahead", body: fmt.Sprintf(`{"content":"hi","publish_at":%q}`, time.Now().Add(handler.MaxScheduleAhead+time.Hour).Format(time.RFC3339))},
+
+		// visibility
+		{name: "unknown visibility", body: `{"content":"hi","visibility":"friends"}`},
+		{name: "small local radius", body: `{"content":"hi","visibility":"local","local_radius":10}`},
+		{name: "large local radius", body: `{"content":"hi","visibility":"local","local_radius":1000000}`},
+
+		// location
+		{name: "latitude past the pole", body: `{"content":"hi","latitude":90.5,"longitude":0}`},
+		{name: "longitude past the antimeridian", body: `{"content":"hi","latitude":0,"longitude":-181}`},
+		{name: "both out of range", body: `{"content":"hi","latitude":-100,"longitude":540}`},
+		{name: "unknown precision", body: `{"content":"hi","location_precision":"street"}`},
+
+		// poll
+		{name: "one poll option", body: `{"content":"hi","poll":{"options":["only"]}}`},
+		{name: "too many poll options", body: `{"content":"hi","poll":{"options":["1","2","3","4","5","6","7"]}}`},
+		{name: "duplicate poll options", body: `{"content":"hi","poll":{"options":["same"," same "]}}`},
+		{name: "empty poll option", body: `{"content":"hi","poll":{"options":["a",""]}}`},
+		{name: "closes_at not a time", body: `{"content":"hi","poll":{"options":["a","b"],"closes_at":"soon"}}`},
+		{name: "closes_at in the past", body: fmt.Sprintf(`{"content":"hi","poll":{"options":["a","b"],"closes_at":%q}}`, past)},
+
+		// repost_of
+		{name: "unknown repost kind", body: `{"content":"hi","repost_of":1,"repost_kind":"share"}`},
+		{name: "repost without kind", body: `{"content":"hi","repost_of":1}`},
+		{name: "blank quote", body: `{"content":"  ","repost_of":1,"repost_kind":"quote"}`},
+		{name: "negative repost_of", body: `{"content":"hi","repost_of":-1,"repost_kind":"repost"}`},
+		{name: "kind without repost_of", body: `{"content":"hi","repost_kind":"quote"}`},
+	}
+	for _, c := range cases {
+		want := c.status
+		if want == 0 {
+			want = http.StatusBadRequest
+		}
+		req := httptest.NewRequest("POST", "/api/posts", strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		func() {
+			defer func() {
+				if recover() != nil {
+					t.Errorf("%s: passed validation and reached the database", c.name)
+				}
+			}()
+			router.ServeHTTP(rec, bearer(t, req, 1))
+			if rec.Code != want {
+				t.Errorf("%s: expected %d, got %d", c.name, want, rec.Code)
+			}
+		}()
+	}
+}
+
+// TestCreatePostReturnsPost checks that creating a post answers with the stored post, that
+// concurrent posts keep their own files and that a failed file write leaves no post behind
+func TestCreatePostReturnsPost(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	create := func(h *handler.RequestHandler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/posts", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		newTestRouter(h).ServeHTTP(rec, bearer(t, req, userID))
+		return rec
+	}
+	h := &handler.RequestHandler{DB: db, FM: fm}
+
+	rec := create(h, `{"content":"Hello","latitude":1.5,"longitude":2.5,"file_name":"hello.txt","media":"hi"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var post map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&post)
+	postID := extractPostID(t, post["post_id"])
+	if post["content"] != "Hello" || post["username"] != "testUser" || post["file_name"] != "hello.txt" || post["latitude"] != 1.5 {
+		t.Errorf("Unexpected created post %v", post)
+	}
+	if loc := rec.Header().Get("Location"); loc != fmt.Sprintf("/api/posts/%d", postID) {
+		t.Errorf("Unexpected Location %q", loc)
+	}
+	if data, err := fm.GetPostFile(userID, postID, "hello.txt"); err != nil || string(data) != "hi" {
+		t.Errorf("Expected the file under the returned ID, got %q, %v", data, err)
+	}
+
+	// every post must end up with its own file, whatever order the inserts land in
+	const parallel = 8
+	var wg sync.WaitGroup
+	ids := make([]int, parallel)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := create(h, fmt.Sprintf(`{"content":"Post %d","file_name":"f%d.txt","media":"%d"}`, i, i, i))
+			if rec.Code != http.StatusCreated {
+				t.Errorf("Post %d: expected 201, got %d", i, rec.Code)
+				return
+			}
+			var created map[string]interface{}
+			json.NewDecoder(rec.Body).Decode(&created)
+			ids[i] = extractPostID(t, created["post_id"])
+		}(i)
+	}
+	wg.Wait()
+	for i, id := range ids {
+		if data, err := fm.GetPostFile(userID, id, fmt.Sprintf("f%d.txt", i)); err != nil || string(data) != fmt.Sprint(i) {
+			t.Errorf("Post %d lost its file: %q, %v", id, data, err)
+		}
+	}
+
+	beforePosts := len(postsOf(t, db, userID))
+	broken := &handler.RequestHandler{DB: db, FM: database.NewFileManagerPath(filepath.Join(t.TempDir(), "missing"))}
+	if rec := create(broken, `{"content":"Orphan","file_name":"lost.txt","media":"x"}`); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 when the file can't be written, got %d", rec.Code)
+	}
+	if after := len(postsOf(t, db, userID)); after != beforePosts {
+		t.Errorf("Expected the failed post to be rolled back, had %d posts and now %d", beforePosts, after)
+	}
+}
+
+// postsOf returns a user's posts
+func postsOf(t *testing.T, db *database.DBInterface, userID int) []map[string]interface{} {
+	t.Helper()
+	_, posts, err := db.GetUserPosts(userID)
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	return posts
+}
@@ -66,6 +66,7 @@ func TestSendDMEndpoint(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
+	req = authenticate(req, senderID)
 	handlerInstance.HandleSendDM(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -106,6 +107,7 @@ func TestGetDMHistoryEndpoint(t *testing.T) {
 		"/api/dm/history?sender_id="+strconv.Itoa(senderID)+"&receiver_id="+strconv.Itoa(receiverID), nil)
 	rec := httptest.NewRecorder()
 
+	req = authenticate(req, senderID)
 	handlerInstance.HandleGetDMHistory(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -171,6 +173,7 @@ func TestGetDMHistoryEndpointAdvanced(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
+		req = authenticate(req, msg.fromID)
 		handlerInstance.HandleSendDM(rec, req)
 
 		if rec.Code != http.StatusOK {
@@ -182,6 +185,7 @@ func TestGetDMHistoryEndpointAdvanced(t *testing.T) {
 	req := httptest.NewRequest("GET",
 		"/api/dm/history?sender_id="+strconv.Itoa(senderID)+"&receiver_id="+strconv.Itoa(receiverID), nil)
 	rec := httptest.NewRecorder()
+	req = authenticate(req, senderID)
 	handlerInstance.HandleGetDMHistory(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -0,0 +1,164 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseEntities checks which hashtags and mentions are found and the ranges they get
+func TestParseEntities(t *testing.T) {
+	cases := map[string][]database.Entity{
+		"Sunset at #Gainesville with @alice.": {
+			{Type: database.EntityHashtag, Start: 10, End: 22, Tag: "gainesville"},
+			{Type: database.EntityMention, Start: 28, End: 34, Username: "alice"},
+		},
+		"#café, #Café and #café_2": {
+			{Type: database.EntityHashtag, Start: 0, End: 5, Tag: "café"},
+			{Type: database.EntityHashtag, Start: 7, End: 12, Tag: "café"},
+			{Type: database.EntityHashtag, Start: 17, End: 24, Tag: "café_2"},
+		},
+		"mail me@example.com, see page#top, #1 @ab": {},
+		"(@bob_smith)": {{Type: database.EntityMention, Start: 1, End: 11, Username: "bob_smith"}},
+		// the emoji is two UTF-16 code units, as JavaScript counts them
+		"🎉 #party with @alice": {
+			{Type: database.EntityHashtag, Start: 3, End: 9, Tag: "party"},
+			{Type: database.EntityMention, Start: 15, End: 21, Username: "alice"},
+		},
+	}
+	for content, want := range cases {
+		if got := database.ParseEntities(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %+v, got %+v", content, want, got)
+		}
+	}
+
+	for in, want := range map[string]string{"SpotLight": "spotlight", "#UF": "uf", "𝒜lpha": "𝒜lpha"} {
+		if got, err := database.NormalizeTag(in); err != nil || got != want {
+			t.Errorf("NormalizeTag(%q): expected %q, got %q, %v", in, want, got, err)
+		}
+	}
+	for _, bad := range []string{"", "123", "two words", "a-b"} {
+		if _, err := database.NormalizeTag(bad); err == nil {
+			t.Errorf("NormalizeTag(%q): expected an error", bad)
+		}
+	}
+}
+
+// TestTagsAndMentions checks posts and comments are indexed on create and edit, that the tag
+// feed filters like the main feed and that mentions follow a user through a rename
+func TestTagsAndMentions(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	send := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if userID != 0 {
+			req = bearer(t, req, userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	tagged := func(query string) []map[string]interface{} {
+		t.Helper()
+		rec := send("GET", "/api/tags/EntityCheck"+query, 0, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected tag feed 200, got %d", rec.Code)
+		}
+		var posts []map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&posts)
+		return posts
+	}
+
+	rec := send("POST", "/api/posts", authorID, `{"content":"Out with @testUser2 #entitycheck #EntityCheck","latitude":29.65,"longitude":-82.32}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var post map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&post)
+	postID := extractPostID(t, post["post_id"])
+
+	entities, _ := post["entities"].([]interface{})
+	if len(entities) != 3 {
+		t.Fatalf("Expected a mention and two hashtags, got %v", post["entities"])
+	}
+	mention := entities[0].(map[string]interface{})
+	if mention["type"] != "mention" || mention["start"] != 9.0 || mention["end"] != 19.0 || extractPostID(t, mention["user_id"]) != otherID {
+		t.Errorf("Unexpected mention %v", mention)
+	}
+
+	if posts := tagged(""); len(posts) != 1 || extractPostID(t, posts[0]["post_id"]) != postID {
+		t.Errorf("Expected the post in its tag feed once, got %v", posts)
+	}
+	if posts := tagged("?latitude=40&longitude=-74&distance=1000"); len(posts) != 0 {
+		t.Errorf("Expected the radius filter to apply to the tag feed, got %d posts", len(posts))
+	}
+	if rec := send("GET", "/api/tags/not-a-tag", 0, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid tag, got %d", rec.Code)
+	}
+
+	// a renamed user is still the one mentioned, under their new name
+	if _, err := db.RenameUser(otherID, "testUser3", 0); err != nil {
+		t.Fatalf("Failed to rename user: %v", err)
+	}
+	renamed, err := db.GetPostById(postID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	m := renamed["entities"].([]database.Entity)[0]
+	if m.UserID != otherID || m.Username != "testUser3" {
+		t.Errorf("Expected the mention to follow the rename, got %+v", m)
+	}
+	if _, err := db.RenameUser(otherID, "testUser2", 0); err != nil {
+		t.Fatalf("Failed to rename user back: %v", err)
+	}
+
+	comment := fmt.Sprintf(`{"user_id":%d,"content":"@testUser see #EntityCheck"}`, otherID)
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/comments", postID), otherID, comment); rec.Code != http.StatusOK {
+		t.Fatalf("Expected comment 200, got %d", rec.Code)
+	}
+	comments, err := db.GetNestedComments(postID)
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("Expected one comment, got %v, %v", comments, err)
+	}
+	want := []database.Entity{
+		{Type: database.EntityMention, Start: 0, End: 9, UserID: authorID, Username: "testUser"},
+		{Type: database.EntityHashtag, Start: 14, End: 26, Tag: "entitycheck"},
+	}
+	if !reflect.DeepEqual(comments[0].Entities, want) {
+		t.Errorf("Expected comment entities %+v, got %+v", want, comments[0].Entities)
+	}
+
+	// editing the tag away takes the post out of the feed
+	if rec := send("PUT", fmt.Sprintf("/api/posts/%d", postID), authorID, `{"content":"Out with friends"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected edit 200, got %d", rec.Code)
+	}
+	if posts := tagged(""); len(posts) != 0 {
+		t.Errorf("Expected the edited post to leave the tag feed, got %d posts", len(posts))
+	}
+}
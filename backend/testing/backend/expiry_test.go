@@ -0,0 +1,116 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"SpotLight/backend/src/reaper"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestExpiredPostsHiddenAndReaped checks every read path skips expired posts and the reaper
+// removes them and their files, also with two reapers racing
+func TestExpiredPostsHiddenAndReaped(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	create := func(content string, expiresAt *time.Time) int {
+		t.Helper()
+		files := []database.Attachment{{FileName: "note.txt", MimeType: "text/plain", SizeBytes: 4}}
+		postID, err := db.SavePost(database.NewPost{UserID: userID, Content: content, ExpiresAt: expiresAt, Attachments: files}, func(postID int) error {
+			return fm.CreatePostFile(userID, postID, "note.txt", []byte("note"))
+		})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		return postID
+	}
+
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Minute)
+	liveID := create("ephemeralcheck live", &future)
+	expiredIDs := []int{}
+	for i := 0; i < 5; i++ {
+		expiredIDs = append(expiredIDs, create(fmt.Sprintf("ephemeralcheck gone %d", i), &past))
+	}
+
+	live, err := db.GetPostById(liveID)
+	if err != nil || live["expires_at"] == nil {
+		t.Fatalf("Expected the live post with expires_at, got %v, %v", live, err)
+	}
+	if _, err := db.GetPostById(expiredIDs[0]); err == nil {
+		t.Errorf("Expected GetPostById to skip an expired post")
+	}
+
+	isExpired := map[int]bool{}
+	for _, id := range expiredIDs {
+		isExpired[id] = true
+	}
+	check := func(source string, posts []map[string]interface{}) {
+		for _, p := range posts {
+			if isExpired[extractPostID(t, p["post_id"])] {
+				t.Errorf("%s returned an expired post", source)
+			}
+		}
+	}
+	posts, err := db.GetPosts(0, 0, -1, 100, 0, "new", "all")
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	check("GetPosts", posts)
+	found, err := db.SearchPosts("ephemeralcheck", 50)
+	if err != nil || len(found) != 1 {
+		t.Errorf("Expected search to find only the live post, got %d, %v", len(found), err)
+	}
+	check("SearchPosts", found)
+	check("GetUserPosts", postsOf(t, db, userID))
+
+	rec := httptest.NewRecorder()
+	newTestRouter(&handler.RequestHandler{DB: db, FM: fm}).ServeHTTP(rec, httptest.NewRequest("GET",
+		fmt.Sprintf("/api/file?userId=%d&postId=%d&fileName=note.txt", userID, expiredIDs[0]), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the file of an expired post, got %d", rec.Code)
+	}
+
+	// small batches force several rounds, two reapers must not trip over each other
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := reaper.NewReaper(db, fm)
+			r.BatchSize = 2
+			if _, err := r.RunOnce(); err != nil {
+				t.Errorf("Reaper failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range expiredIDs {
+		if _, err := db.GetPostOwner(id); err == nil {
+			t.Errorf("Expected expired post %d to be deleted", id)
+		}
+		if _, err := fm.GetPostFile(userID, id, "note.txt"); err == nil {
+			t.Errorf("Expected the files of post %d to be deleted", id)
+		}
+	}
+	if _, err := db.GetPostOwner(liveID); err != nil {
+		t.Errorf("Expected the live post to survive: %v", err)
+	}
+}
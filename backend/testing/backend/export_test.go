@@ -0,0 +1,216 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/export"
+	"SpotLight/backend/src/handler"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestDataExportArchive requests an export through the API, waits for it and checks the archive
+func TestDataExportArchive(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	if err := db.CreatePostFile(userID, "Post with a file", 0, 0, "hello.txt"); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	postID, err := db.GetLastPostByUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if err := fm.CreatePostFile(userID, postID, "hello.txt", []byte("hello")); err != nil {
+		t.Fatalf("Failed to store file: %v", err)
+	}
+	if err := db.CreateNestedComment(postID, userID, nil, "My comment"); err != nil {
+		t.Fatalf("Failed to comment: %v", err)
+	}
+	if err := db.LikePost(userID, postID); err != nil {
+		t.Fatalf("Failed to like: %v", err)
+	}
+	if err := db.InsertMessage(otherID, userID, "Hi there"); err != nil {
+		t.Fatalf("Failed to send DM: %v", err)
+	}
+
+	exports := export.NewManager(db, fm, t.TempDir())
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm, Exports: exports})
+	send := func(method, path string, userID int) *httptest.ResponseRecorder {
+		req := bearer(t, httptest.NewRequest(method, path, nil), userID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("POST", "/api/account/exports", userID)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", rec.Code)
+	}
+	var created database.DataExport
+	json.NewDecoder(rec.Body).Decode(&created)
+	exportPath := "/api/account/exports/" + strconv.Itoa(created.ID)
+
+	// someone else can't see it
+	if rec := send("GET", exportPath, otherID); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's export, got %d", rec.Code)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	var status database.DataExport
+	for {
+		rec := send("GET", exportPath, userID)
+		json.NewDecoder(rec.Body).Decode(&status)
+		if status.Status == database.ExportReady || status.Status == database.ExportFailed || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status.Status != database.ExportReady {
+		t.Fatalf("Expected export to be ready, got %s", status.Status)
+	}
+
+	rec = send("GET", exportPath+"/download", userID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected download 200, got %d", rec.Code)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Download is not a zip: %v", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"manifest.json", "profile.json", "posts.json", "comments.json", "likes.json", "messages.json", "media.json"} {
+		if files[name] == nil {
+			t.Errorf("Archive is missing %s", name)
+		}
+	}
+
+	media := files["media/"+strconv.Itoa(postID)+"/hello.txt"]
+	if media == nil {
+		t.Fatalf("Archive is missing the uploaded file")
+	}
+	r, _ := media.Open()
+	var content bytes.Buffer
+	content.ReadFrom(r)
+	if content.String() != "hello" {
+		t.Errorf("Unexpected media content %q", content.String())
+	}
+
+	var conversations []struct {
+		With     database.UserProfile     `json:"with"`
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	r, _ = files["messages.json"].Open()
+	json.NewDecoder(r).Decode(&conversations)
+	if len(conversations) != 1 || conversations[0].With.UserID != otherID || len(conversations[0].Messages) != 1 {
+		t.Errorf("Unexpected messages.json %+v", conversations)
+	}
+}
+
+// TestDataExportCleanup checks expired archives are deleted from disk, and that an export
+// interrupted while building is failed with its partial file removed
+func TestDataExportCleanup(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	dir := t.TempDir()
+	exports := export.NewManager(db, fm, dir)
+	ready, _, err := db.CreateDataExport(userID)
+	if err != nil {
+		t.Fatalf("Failed to queue export: %v", err)
+	}
+	if err := exports.Build(ready.ID, userID); err != nil {
+		t.Fatalf("Failed to build export: %v", err)
+	}
+	built, err := db.GetDataExport(userID, ready.ID)
+	if err != nil || built.FilePath == "" {
+		t.Fatalf("Expected a built archive, got %+v, %v", built, err)
+	}
+
+	// a job that died halfway through its archive an hour and a half ago
+	stale, _, err := db.CreateDataExport(otherID)
+	if err != nil {
+		t.Fatalf("Failed to queue export: %v", err)
+	}
+	partial := filepath.Join(dir, fmt.Sprintf("export-%d-user-%d.zip.partial", stale.ID, otherID))
+	if err := os.WriteFile(partial, []byte("half a zip"), 0600); err != nil {
+		t.Fatalf("Failed to write partial archive: %v", err)
+	}
+
+	pool := connectPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+	if _, err := pool.Exec(ctx, "UPDATE data_exports SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1", ready.ID); err != nil {
+		t.Fatalf("Failed to backdate export: %v", err)
+	}
+	if _, err := pool.Exec(ctx, "UPDATE data_exports SET status = $2, created_at = NOW() - INTERVAL '90 minutes' WHERE id = $1",
+		stale.ID, database.ExportRunning); err != nil {
+		t.Fatalf("Failed to backdate export: %v", err)
+	}
+
+	if err := exports.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+
+	for _, path := range []string{built.FilePath, partial} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted, got %v", path, err)
+		}
+	}
+	if e, err := db.GetDataExport(userID, ready.ID); err != nil || e.Status != database.ExportExpired || e.FilePath != "" {
+		t.Errorf("Expected the archive's export to be expired, got %+v, %v", e, err)
+	}
+	if e, err := db.GetDataExport(otherID, stale.ID); err != nil || e.Status != database.ExportFailed {
+		t.Errorf("Expected the interrupted export to be failed, got %+v, %v", e, err)
+	}
+}
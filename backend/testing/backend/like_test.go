@@ -49,6 +49,7 @@ func TestLikePost(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
+	req = authenticate(req, userID)
 	handlerInstance.HandleLikePost(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -68,6 +69,7 @@ func TestDoubleLikePost(t *testing.T) {
 	req := httptest.NewRequest("POST", "/api/posts/like", bytes.NewBuffer(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
+	req = authenticate(req, userID)
 	handlerInstance.HandleLikePost(rec, req)
 
 	// Second like (should fail)
@@ -91,12 +93,14 @@ func TestUnlikePost(t *testing.T) {
 	likeReq := httptest.NewRequest("POST", "/api/posts/like", bytes.NewBuffer(jsonBody))
 	likeReq.Header.Set("Content-Type", "application/json")
 	likeRec := httptest.NewRecorder()
+	likeReq = authenticate(likeReq, userID)
 	handlerInstance.HandleLikePost(likeRec, likeReq)
 
 	// Then unlike
 	unlikeReq := httptest.NewRequest("POST", "/api/posts/unlike", bytes.NewBuffer(jsonBody))
 	unlikeReq.Header.Set("Content-Type", "application/json")
 	unlikeRec := httptest.NewRecorder()
+	unlikeReq = authenticate(unlikeReq, userID)
 	handlerInstance.HandleUnlikePost(unlikeRec, unlikeReq)
 
 	if unlikeRec.Code != http.StatusOK {
@@ -116,6 +120,7 @@ func TestDoubleUnlikePost(t *testing.T) {
 	unlikeReq := httptest.NewRequest("POST", "/api/posts/unlike", bytes.NewBuffer(jsonBody))
 	unlikeReq.Header.Set("Content-Type", "application/json")
 	unlikeRec := httptest.NewRecorder()
+	unlikeReq = authenticate(unlikeReq, userID)
 	handlerInstance.HandleUnlikePost(unlikeRec, unlikeReq)
 
 	if unlikeRec.Code != http.StatusBadRequest {
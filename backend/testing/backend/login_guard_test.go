@@ -0,0 +1,184 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLoginIP is the address httptest requests come from
+const testLoginIP = "192.0.2.1"
+
+// clearLoginCounters removes failure history left behind by a test
+func clearLoginCounters(db *database.DBInterface, t *testing.T) {
+	t.Helper()
+	for _, key := range []string{"user:testUser", "ip:" + testLoginIP} {
+		if err := db.ClearLoginFailures(key); err != nil {
+			t.Logf("Warning: Failed to clear %s: %v", key, err)
+		}
+	}
+}
+
+// attemptLogin posts credentials to the login handler
+func attemptLogin(h *handler.RequestHandler, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/login",
+		strings.NewReader(`{"username":"testUser","password":"`+password+`"}`))
+	rec := httptest.NewRecorder()
+	h.HandleLogin(rec, req)
+	return rec
+}
+
+// TestLoginBackoff verifies repeated failures are throttled with a Retry-After header
+func TestLoginBackoff(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+	defer clearLoginCounters(db, t)
+	clearLoginCounters(db, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	handlerInstance := &handler.RequestHandler{DB: db}
+
+	// the first few mistakes are free
+	for i := 0; i < 3; i++ {
+		if rec := attemptLogin(handlerInstance, "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+
+	// even the right password has to wait out the backoff
+	rec := attemptLogin(handlerInstance, "password")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 during backoff, got %d", rec.Code)
+	}
+	if seconds, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || seconds < 1 {
+		t.Errorf("Expected a positive Retry-After, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// counters live in the database, so a fresh handler (a restarted server) still throttles
+	if rec := attemptLogin(&handler.RequestHandler{DB: db}, "password"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected backoff to survive a restart, got %d", rec.Code)
+	}
+}
+
+// TestLoginBackoffParallel verifies guesses sent at once are throttled like guesses sent in turn
+func TestLoginBackoffParallel(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+	defer clearLoginCounters(db, t)
+	clearLoginCounters(db, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	handlerInstance := &handler.RequestHandler{DB: db}
+	codes := make(chan int, 12)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- attemptLogin(handlerInstance, "wrong").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusUnauthorized] != 3 || counts[http.StatusTooManyRequests] != cap(codes)-3 {
+		t.Errorf("Expected only the 3 free guesses checked and the rest throttled, got %v", counts)
+	}
+	pool := connectPool(t)
+	defer pool.Close()
+	var failures int
+	err := pool.QueryRow(context.Background(), "SELECT failures FROM login_failures WHERE key = 'user:testUser'").Scan(&failures)
+	if err != nil || failures != 3 {
+		t.Errorf("Expected 3 failures counted, got %d, %v", failures, err)
+	}
+}
+
+// TestLoginLockoutAndAdminClear verifies an account locks out and an admin can unlock it
+func TestLoginLockoutAndAdminClear(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+	defer clearLoginCounters(db, t)
+	clearLoginCounters(db, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	adminID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	// simulate a long run of failures without waiting out each backoff
+	pool := connectPool(t)
+	defer pool.Close()
+	_, err = pool.Exec(context.Background(), `
+		INSERT INTO login_failures (key, failures, last_failure_at) VALUES ('user:testUser', 10, NOW())
+		ON CONFLICT (key) DO UPDATE SET failures = 10, last_failure_at = NOW()`)
+	if err != nil {
+		t.Fatalf("Failed to seed failures: %v", err)
+	}
+	if err := db.LockLogin("user:testUser", time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+
+	handlerInstance := &handler.RequestHandler{DB: db}
+	rec := attemptLogin(handlerInstance, "password")
+	if rec.Code != http.StatusLocked {
+		t.Fatalf("Expected 423 while locked, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After on a locked account")
+	}
+
+	router := newTestRouter(handlerInstance)
+	clearLockout := func() int {
+		req := httptest.NewRequest("DELETE", "/api/admin/lockouts", strings.NewReader(`{"username":"testUser"}`))
+		req = bearer(t, req, adminID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := clearLockout(); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", code)
+	}
+
+	if err := db.SetUserRole(adminID, database.RoleAdmin); err != nil {
+		t.Fatalf("Failed to promote admin: %v", err)
+	}
+	if code := clearLockout(); code != http.StatusOK {
+		t.Fatalf("Expected 200 clearing lockout, got %d", code)
+	}
+
+	if rec := attemptLogin(handlerInstance, "password"); rec.Code != http.StatusOK {
+		t.Errorf("Expected login to work after clearing, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// TestValidateUsername checks the registration naming rules
+func TestValidateUsername(t *testing.T) {
+	valid := []string{"testUser", "abc", "Elwyn.Skiles", "Maxime_Nienow", "user42"}
+	for _, name := range valid {
+		if err := database.ValidateUsername(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+
+	invalid := []string{"", "ab", "../etc", "with space", "_leading", ".hidden", "a/b", "ünïcode", "abcdefghijklmnopqrstuvwxyz12345"}
+	for _, name := range invalid {
+		if err := database.ValidateUsername(name); !errors.Is(err, database.ErrInvalidUsername) {
+			t.Errorf("Expected %q to be rejected, got %v", name, err)
+		}
+	}
+}
+
+// TestPostFilesKeyedByID verifies files land under the user and post IDs and can't escape them
+func TestPostFilesKeyedByID(t *testing.T) {
+	root := t.TempDir()
+	fm := database.NewFileManagerPath(root)
+
+	if err := fm.CreatePostFile(7, 42, "hello.txt", []byte("hi")); err != nil {
+		t.Fatalf("Failed to create post file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, database.MediaStoreDir, "7", "42", "hello.txt")); err != nil {
+		t.Errorf("Expected file under users/7/42: %v", err)
+	}
+
+	data, err := fm.GetPostFile(7, 42, "hello.txt")
+	if err != nil || string(data) != "hi" {
+		t.Errorf("Expected to read back the file, got %q, %v", data, err)
+	}
+
+	for _, name := range []string{"../42/hello.txt", "..", "", "sub/hello.txt"} {
+		if _, err := fm.GetPostFile(7, 42, name); !errors.Is(err, database.ErrInvalidFileName) {
+			t.Errorf("Expected %q to be rejected, got %v", name, err)
+		}
+	}
+
+	if err := fm.DeleteUserFolder(7); err != nil {
+		t.Fatalf("Failed to delete user folder: %v", err)
+	}
+	if _, err := fm.GetPostFile(7, 42, "hello.txt"); err == nil {
+		t.Errorf("Expected file to be gone with its user folder")
+	}
+}
+
+// TestMigrateLegacyMedia moves a username based folder into the ID layout and verifies it
+func TestMigrateLegacyMedia(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if err := db.CreatePostFile(userID, "Legacy post", 0, 0, "old.txt"); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	postID, err := db.GetLastPostByUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+
+	root := t.TempDir()
+	legacyDir := filepath.Join(root, "testUser")
+	os.Mkdir(legacyDir, 0755)
+	os.WriteFile(filepath.Join(legacyDir, strconv.Itoa(postID)+"_old.txt"), []byte("legacy"), 0644)
+	os.WriteFile(filepath.Join(legacyDir, "notes.txt"), []byte("stray"), 0644)
+	os.Mkdir(filepath.Join(root, "ghostUser"), 0755)
+
+	fm := database.NewFileManagerPath(root)
+	report, err := fm.MigrateLegacyMedia(db)
+	if err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if report.Moved != 1 || len(report.Skipped) != 2 {
+		t.Errorf("Expected 1 moved and 2 skipped, got %+v", report)
+	}
+	for _, missing := range report.Missing {
+		if missing.PostID == postID {
+			t.Errorf("Migrated post %d reported missing", postID)
+		}
+	}
+
+	data, err := fm.GetPostFile(userID, postID, "old.txt")
+	if err != nil || string(data) != "legacy" {
+		t.Errorf("Expected migrated file, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, strconv.Itoa(postID)+"_old.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy file to be removed")
+	}
+
+	// a second run has nothing left to do
+	report, err = fm.MigrateLegacyMedia(db)
+	if err != nil || report.Moved != 0 {
+		t.Errorf("Expected rerun to move nothing, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,274 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/handler"
+	"SpotLight/backend/src/oidc"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIdP is a minimal OpenID provider that signs ID tokens with its own RSA key
+type mockIdP struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	subject string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+
+	// overrides let tests hand out bad tokens
+	audience string
+	nonce    string
+}
+
+// mockGrant is what the IdP remembers about an authorization code
+type mockGrant struct {
+	nonce     string
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, subject: "mock-subject-1", codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		grant, ok := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken(t, grant.nonce)})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+// provider returns a SpotLight provider config pointing at the mock
+func (idp *mockIdP) provider() *oidc.Provider {
+	return &oidc.Provider{
+		Name:        "mock",
+		Issuer:      idp.server.URL,
+		ClientID:    "spotlight",
+		RedirectURL: "http://localhost:8080/api/auth/oidc/mock/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+}
+
+// authorize plays the user approving the login, returning the code and state for the callback
+func (idp *mockIdP) authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Bad authorization URL %q: %v", authURL, err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Authorization URL is missing PKCE: %s", authURL)
+	}
+
+	code := "code-" + q.Get("state")[:8]
+	idp.mu.Lock()
+	idp.codes[code] = mockGrant{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+// idToken signs an ID token for the mock subject
+func (idp *mockIdP) idToken(t *testing.T, nonce string) string {
+	audience := "spotlight"
+	if idp.audience != "" {
+		audience = idp.audience
+	}
+	if idp.nonce != "" {
+		nonce = idp.nonce
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":                idp.server.URL,
+		"sub":                idp.subject,
+		"aud":                audience,
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "testUser",
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign id token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestOIDCExchangeVerifiesIDToken checks PKCE, signature, audience and nonce handling against the mock
+func TestOIDCExchangeVerifiesIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+	provider := idp.provider()
+	ctx := context.Background()
+
+	login := func() (*oidc.Identity, error) {
+		state, nonce, verifier, err := oidc.NewLoginSecrets()
+		if err != nil {
+			t.Fatalf("Failed to create login secrets: %v", err)
+		}
+		authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+		if err != nil {
+			t.Fatalf("Failed to build authorization URL: %v", err)
+		}
+		code, _ := idp.authorize(t, authURL)
+		return provider.Exchange(ctx, code, verifier, nonce)
+	}
+
+	identity, err := login()
+	if err != nil {
+		t.Fatalf("Expected exchange to succeed, got %v", err)
+	}
+	if identity.Subject != "mock-subject-1" || identity.PreferredUsername != "testUser" {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+
+	idp.audience = "someone-else"
+	if _, err := login(); err == nil {
+		t.Errorf("Expected a token for another client to be rejected")
+	}
+	idp.audience = ""
+
+	idp.nonce = "replayed-nonce"
+	if _, err := login(); err == nil {
+		t.Errorf("Expected a token with the wrong nonce to be rejected")
+	}
+	idp.nonce = ""
+
+	// a code verifier that doesn't match the challenge is refused by the provider
+	state, nonce, verifier, _ := oidc.NewLoginSecrets()
+	authURL, _ := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	code, _ := idp.authorize(t, authURL)
+	if _, err := provider.Exchange(ctx, code, verifier+"x", nonce); err == nil {
+		t.Errorf("Expected a wrong code verifier to be rejected")
+	}
+}
+
+// TestOIDCLoginCreatesUserAndSession runs the whole redirect flow through the router
+func TestOIDCLoginCreatesUserAndSession(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+
+	router := newTestRouter(&handler.RequestHandler{
+		DB:              db,
+		OIDC:            map[string]*oidc.Provider{"mock": idp.provider()},
+		OIDCFrontendURL: "http://frontend.test/login/callback",
+	})
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	fragment := func(rec *httptest.ResponseRecorder) url.Values {
+		t.Helper()
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Expected a redirect, got %d", rec.Code)
+		}
+		location := rec.Header().Get("Location")
+		if !strings.HasPrefix(location, "http://frontend.test/login/callback#") {
+			t.Fatalf("Unexpected redirect %s", location)
+		}
+		values, _ := url.ParseQuery(location[strings.Index(location, "#")+1:])
+		return values
+	}
+
+	if rec := get("/api/auth/oidc/unknown/start"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown provider, got %d", rec.Code)
+	}
+
+	start := get("/api/auth/oidc/mock/start")
+	if start.Code != http.StatusFound {
+		t.Fatalf("Expected start to redirect, got %d", start.Code)
+	}
+	cookies := start.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Expected an HttpOnly, Secure, SameSite=Lax state cookie, got %v", cookies)
+	}
+	code, state := idp.authorize(t, start.Header().Get("Location"))
+
+	// the callback only completes in the browser that started the login
+	callback := "/api/auth/oidc/mock/callback?code=" + url.QueryEscape(code) + "&state=" + url.QueryEscape(state)
+	other := get("/api/auth/oidc/mock/start").Result().Cookies()
+	for _, jar := range [][]*http.Cookie{nil, other} {
+		if result := fragment(get(callback, jar...)); result.Get("error") != "invalid_state" {
+			t.Errorf("Expected a callback without the browser's state cookie to be rejected, got %v", result)
+		}
+	}
+	result := fragment(get(callback, cookies...))
+	if result.Get("error") != "" {
+		t.Fatalf("Expected login to succeed, got %s", result.Get("error"))
+	}
+	*userCreated = true
+	if result.Get("username") != "testUser" || result.Get("token") == "" || result.Get("refresh_token") == "" {
+		t.Errorf("Expected session tokens for testUser, got %v", result)
+	}
+
+	// the state is single use
+	if replay := fragment(get(callback, cookies...)); replay.Get("error") != "invalid_state" {
+		t.Errorf("Expected a replayed state to be rejected, got %v", replay)
+	}
+
+	// logging in again lands on the same account
+	start = get("/api/auth/oidc/mock/start")
+	code, state = idp.authorize(t, start.Header().Get("Location"))
+	again := fragment(get("/api/auth/oidc/mock/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(state), start.Result().Cookies()...))
+	if again.Get("user_id") != result.Get("user_id") {
+		t.Errorf("Expected the same user on second login, got %s and %s", result.Get("user_id"), again.Get("user_id"))
+	}
+}
@@ -0,0 +1,204 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureSender keeps sent mail in memory so tests can read reset tokens. Reset mail is sent
+// in the background, so read it with wait.
+type captureSender struct {
+	mu   sync.Mutex
+	to   []string
+	body []string
+}
+
+func (c *captureSender) Send(to, subject, body string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.to = append(c.to, to)
+	c.body = append(c.body, body)
+	return nil
+}
+
+// wait returns the recipients and bodies sent so far once there are n, or after a second
+func (c *captureSender) wait(n int) ([]string, []string) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		to, body := append([]string(nil), c.to...), append([]string(nil), c.body...)
+		c.mu.Unlock()
+		if len(to) >= n || time.Now().After(deadline) {
+			return to, body
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// clearResetCounter forgets the reset requests counted against the test address
+func clearResetCounter(db *database.DBInterface, t *testing.T) {
+	t.Helper()
+	if err := db.ClearLoginFailures("reset:ip:" + testLoginIP); err != nil {
+		t.Logf("Warning: Failed to clear reset requests: %v", err)
+	}
+}
+
+var resetTokenPattern = regexp.MustCompile(`password: (\S+)`)
+
+// TestChangePasswordEndpoint verifies the current password is required to set a new one
+func TestChangePasswordEndpoint(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	handlerInstance := handler.RequestHandler{DB: db}
+
+	// wrong current password
+	req := httptest.NewRequest("POST", "/api/account/password",
+		strings.NewReader(`{"current_password":"wrong","new_password":"newpassword"}`))
+	req = authenticate(req, userID)
+	rec := httptest.NewRecorder()
+	handlerInstance.HandleChangePassword(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for wrong current password, got %d", rec.Code)
+	}
+
+	// correct current password
+	req = httptest.NewRequest("POST", "/api/account/password",
+		strings.NewReader(`{"current_password":"password","new_password":"newpassword"}`))
+	req = authenticate(req, userID)
+	rec = httptest.NewRecorder()
+	handlerInstance.HandleChangePassword(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 changing password, got %d", rec.Code)
+	}
+
+	if _, err := db.Authenticate("testUser", "password"); err == nil {
+		t.Errorf("Old password should no longer work")
+	}
+	if _, err := db.Authenticate("testUser", "newpassword"); err != nil {
+		t.Errorf("New password should work: %v", err)
+	}
+}
+
+// TestPasswordResetFlow verifies a mailed reset token works exactly once
+func TestPasswordResetFlow(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.RegisterWithEmail("testUser", "password", "testuser@example.com"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	clearResetCounter(db, t)
+	defer clearResetCounter(db, t)
+
+	sender := &captureSender{}
+	handlerInstance := handler.RequestHandler{DB: db, Mail: sender}
+
+	req := httptest.NewRequest("POST", "/api/password-reset/request", strings.NewReader(`{"username":"testUser"}`))
+	rec := httptest.NewRecorder()
+	handlerInstance.HandleRequestPasswordReset(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 requesting reset, got %d", rec.Code)
+	}
+
+	to, bodies := sender.wait(1)
+	if len(bodies) != 1 || to[0] != "testuser@example.com" {
+		t.Fatalf("Expected one reset mail to testuser@example.com, got %v", to)
+	}
+	match := resetTokenPattern.FindStringSubmatch(bodies[0])
+	if match == nil {
+		t.Fatalf("Reset mail has no token: %q", bodies[0])
+	}
+
+	confirm := func(token string) int {
+		body, _ := json.Marshal(map[string]string{"token": token, "new_password": "resetpassword"})
+		req := httptest.NewRequest("POST", "/api/password-reset/confirm", strings.NewReader(string(body)))
+		rec := httptest.NewRecorder()
+		handlerInstance.HandleConfirmPasswordReset(rec, req)
+		return rec.Code
+	}
+
+	if code := confirm("not-a-real-token"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown token, got %d", code)
+	}
+	if code := confirm(match[1]); code != http.StatusOK {
+		t.Fatalf("Expected 200 confirming reset, got %d", code)
+	}
+	if code := confirm(match[1]); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 reusing a reset token, got %d", code)
+	}
+
+	if _, err := db.Authenticate("testUser", "resetpassword"); err != nil {
+		t.Errorf("Reset password should work: %v", err)
+	}
+}
+
+// TestPasswordResetUnknownUser verifies the response doesn't reveal whether a user exists
+func TestPasswordResetUnknownUser(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+	clearResetCounter(db, t)
+	defer clearResetCounter(db, t)
+
+	sender := &captureSender{}
+	handlerInstance := handler.RequestHandler{DB: db, Mail: sender}
+
+	req := httptest.NewRequest("POST", "/api/password-reset/request", strings.NewReader(`{"username":"noSuchUser"}`))
+	rec := httptest.NewRecorder()
+	handlerInstance.HandleRequestPasswordReset(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for unknown user, got %d", rec.Code)
+	}
+	if to, _ := sender.wait(1); len(to) != 0 {
+		t.Errorf("Expected no mail for unknown user, got %v", to)
+	}
+}
+
+// TestPasswordResetThrottled verifies one address can only ask for a few reset mails in a row
+func TestPasswordResetThrottled(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+	clearResetCounter(db, t)
+	defer clearResetCounter(db, t)
+
+	handlerInstance := handler.RequestHandler{DB: db, Mail: &captureSender{}}
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/password-reset/request", strings.NewReader(`{"username":"noSuchUser"}`))
+		rec := httptest.NewRecorder()
+		handlerInstance.HandleRequestPasswordReset(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 5; i++ {
+		if rec := request(); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, rec.Code)
+		}
+	}
+	rec := request()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After after five requests, got %d", rec.Code)
+	}
+}
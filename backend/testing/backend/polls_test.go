@@ -0,0 +1,171 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPolls checks votes are counted once per user, can be changed, respect the poll's choice
+// mode and closing time, and that results come back with the post
+func TestPolls(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	send := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = bearer(t, req, userID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	closes := time.Now().Add(time.Hour).Format(time.RFC3339)
+	rec := send("POST", "/api/posts", authorID, fmt.Sprintf(`{"content":"Lunch?","poll":{"options":["Pizza","Tacos","Sushi"],"closes_at":%q}}`, closes))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		PostID int           `json:"post_id"`
+		Poll   database.Poll `json:"poll"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if len(created.Poll.Options) != 3 || created.Poll.Options[1].Text != "Tacos" || created.Poll.MultipleChoice || created.Poll.ClosesAt == nil {
+		t.Fatalf("Unexpected poll %+v", created.Poll)
+	}
+	pizza, tacos, sushi := created.Poll.Options[0].ID, created.Poll.Options[1].ID, created.Poll.Options[2].ID
+	votePath := fmt.Sprintf("/api/posts/%d/poll/vote", created.PostID)
+	vote := func(method string, userID int, options ...int) *httptest.ResponseRecorder {
+		ids, _ := json.Marshal(options)
+		return send(method, votePath, userID, fmt.Sprintf(`{"option_ids":%s}`, ids))
+	}
+
+	if rec := vote("PUT", otherID, pizza); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 changing a vote that doesn't exist, got %d", rec.Code)
+	}
+	if rec := vote("POST", otherID, pizza, tacos); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for two options in a single choice poll, got %d", rec.Code)
+	}
+	if rec := vote("POST", otherID, pizza+1000); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown option, got %d", rec.Code)
+	}
+	if rec := vote("POST", otherID, pizza); rec.Code != http.StatusOK {
+		t.Fatalf("Expected vote 200, got %d", rec.Code)
+	}
+	if rec := vote("POST", otherID, tacos); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 voting twice, got %d", rec.Code)
+	}
+	if rec := vote("POST", authorID, sushi); rec.Code != http.StatusOK {
+		t.Fatalf("Expected vote 200, got %d", rec.Code)
+	}
+
+	// concurrent changes must leave exactly one vote with the counts to match
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			option := []int{pizza, tacos, sushi}[i%3]
+			if rec := vote("PUT", otherID, option); rec.Code != http.StatusOK {
+				t.Errorf("Expected change 200, got %d", rec.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+	rec = vote("PUT", otherID, tacos)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected change 200, got %d", rec.Code)
+	}
+	var results database.Poll
+	json.NewDecoder(rec.Body).Decode(&results)
+	counts := map[int]int{}
+	for _, o := range results.Options {
+		counts[o.ID] = o.VoteCount
+	}
+	if results.VoterCount != 2 || counts[pizza] != 0 || counts[tacos] != 1 || counts[sushi] != 1 {
+		t.Errorf("Unexpected results after changing votes %+v", results)
+	}
+	if len(results.Voted) != 1 || results.Voted[0] != tacos {
+		t.Errorf("Expected the voter's own choice in the results, got %v", results.Voted)
+	}
+
+	post, err := db.GetPostById(created.PostID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if p, ok := post["poll"].(*database.Poll); !ok || p.VoterCount != 2 || len(p.Voted) != 0 {
+		t.Errorf("Expected anonymous poll results with the post, got %+v", post["poll"])
+	}
+	feed, err := db.GetPosts(0, 0, -1, 100, 0, "new", "all")
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	for _, p := range feed {
+		if extractPostID(t, p["post_id"]) == created.PostID && p["poll"] == nil {
+			t.Errorf("Expected the poll in the feed")
+		}
+	}
+
+	// multiple choice, and a poll that has already closed
+	past := time.Now().Add(-time.Minute)
+	multiID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "Which days?",
+		Poll: &database.NewPoll{Options: []string{"Sat", "Sun"}, MultipleChoice: true}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	closedID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "Too late",
+		Poll: &database.NewPoll{Options: []string{"Yes", "No"}, ClosesAt: &past}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	multi, _ := db.GetPostById(multiID)
+	options := multi["poll"].(*database.Poll).Options
+	rec = send("POST", fmt.Sprintf("/api/posts/%d/poll/vote", multiID), otherID,
+		fmt.Sprintf(`{"option_ids":[%d,%d]}`, options[0].ID, options[1].ID))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a multiple choice vote 200, got %d", rec.Code)
+	}
+	json.NewDecoder(rec.Body).Decode(&results)
+	if results.VoterCount != 1 || results.Options[0].VoteCount != 1 || results.Options[1].VoteCount != 1 {
+		t.Errorf("Unexpected multiple choice results %+v", results)
+	}
+	closed, _ := db.GetPostById(closedID)
+	closedPoll := closed["poll"].(*database.Poll)
+	if !closedPoll.Closed {
+		t.Errorf("Expected the poll to be closed")
+	}
+	rec = send("POST", fmt.Sprintf("/api/posts/%d/poll/vote", closedID), otherID,
+		fmt.Sprintf(`{"option_ids":[%d]}`, closedPoll.Options[0].ID))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 voting in a closed poll, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/poll/vote", closedID+1000000), otherID, `{"option_ids":[1]}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing post, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,138 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSnapLocation checks points land on a cell centre close to them, that nearby points share
+// a cell and that cells stay valid at the poles and the antimeridian
+func TestSnapLocation(t *testing.T) {
+	lat, lon := database.SnapLocation(29.6516, -82.3248, database.PrecisionExact)
+	if lat != 29.6516 || lon != -82.3248 {
+		t.Errorf("Expected exact to keep the point, got %v, %v", lat, lon)
+	}
+
+	for precision, within := range map[string]float64{
+		database.Precision100m:         0.001,
+		database.PrecisionNeighborhood: 0.01,
+		database.PrecisionCity:         0.1,
+	} {
+		for _, p := range [][2]float64{{29.6516, -82.3248}, {-33.8688, 151.2093}, {89.99, 10}, {-90, -180}, {0, 179.9999}, {71.2, -179.95}} {
+			lat, lon := database.SnapLocation(p[0], p[1], precision)
+			if math.Abs(lat-p[0]) > within || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+				t.Errorf("%s: %v snapped out of its cell to %v, %v", precision, p, lat, lon)
+			}
+			if p[0] < 80 && math.Abs(lon-p[1]) > within/math.Cos(lat*math.Pi/180) {
+				t.Errorf("%s: %v snapped too far east or west to %v", precision, p, lon)
+			}
+			if again, againLon := database.SnapLocation(lat, lon, precision); again != lat || againLon != lon {
+				t.Errorf("%s: snapping a cell centre moved it from %v, %v to %v, %v", precision, lat, lon, again, againLon)
+			}
+		}
+	}
+
+	a, aLon := database.SnapLocation(29.65161, -82.32481, database.PrecisionCity)
+	b, bLon := database.SnapLocation(29.65162, -82.32482, database.PrecisionCity)
+	if a != b || aLon != bLon {
+		t.Errorf("Expected points a metre apart to share a city cell")
+	}
+}
+
+// TestLocationPrecision checks others get snapped coordinates while the author and the radius
+// filter use the true ones
+func TestLocationPrecision(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	get := func(path string, userID int) map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if userID != 0 {
+			req = bearer(t, req, userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+		var post map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&post)
+		return post
+	}
+
+	req := httptest.NewRequest("POST", "/api/posts", strings.NewReader(
+		`{"content":"precisioncheck","latitude":29.6516,"longitude":-82.3248,"location_precision":"city"}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, bearer(t, req, authorID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&created)
+	postID := extractPostID(t, created["post_id"])
+	if created["latitude"] != 29.6516 || created["location_precision"] != "city" {
+		t.Errorf("Expected the author to get the exact location back, got %v", created)
+	}
+
+	wantLat, wantLon := database.SnapLocation(29.6516, -82.3248, database.PrecisionCity)
+	postPath := fmt.Sprintf("/api/posts/%d", postID)
+	for _, viewer := range []int{0, otherID} {
+		post := get(postPath, viewer)
+		if post["latitude"] != wantLat || post["longitude"] != wantLon {
+			t.Errorf("Viewer %d: expected %v, %v, got %v, %v", viewer, wantLat, wantLon, post["latitude"], post["longitude"])
+		}
+	}
+	if post := get(postPath, authorID); post["latitude"] != 29.6516 || post["longitude"] != -82.3248 {
+		t.Errorf("Expected the author to see the exact location, got %v, %v", post["latitude"], post["longitude"])
+	}
+
+	// 50 m from the true point but kilometres from the cell centre
+	feed, err := db.GetPosts(29.6520, -82.3248, 100, 100, 0, "new", "all")
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	found := false
+	for _, p := range feed {
+		if extractPostID(t, p["post_id"]) == postID {
+			found = true
+			if p["latitude"] != wantLat {
+				t.Errorf("Expected the feed to snap the location, got %v", p["latitude"])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the radius filter to use the true location")
+	}
+
+	posts, err := db.SearchPosts("precisioncheck", 10)
+	if err != nil || len(posts) != 1 || posts[0]["latitude"] != wantLat {
+		t.Errorf("Expected search to snap the location, got %v, %v", posts, err)
+	}
+}
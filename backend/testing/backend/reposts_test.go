@@ -0,0 +1,134 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestReposts checks reposts and quotes embed their original, keep its counts in step through
+// every way they can be deleted, and turn into tombstones when the original goes
+func TestReposts(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	create := func(body string) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/posts", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, bearer(t, req, otherID))
+		var post map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&post)
+		return rec.Code, post
+	}
+	counts := func(postID int) (int, int) {
+		t.Helper()
+		post, err := db.GetPostById(postID)
+		if err != nil {
+			t.Fatalf("Failed to get post: %v", err)
+		}
+		return post["repost_count"].(int), post["quote_count"].(int)
+	}
+
+	originalID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "Sunset from the rooftop", Latitude: 29.65, Longitude: -82.32}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	privateID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "Just me", Visibility: database.VisibilityPrivate}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	code, repost := create(fmt.Sprintf(`{"content":"","latitude":40.7,"longitude":-74,"repost_of":%d,"repost_kind":"repost"}`, originalID))
+	if code != http.StatusCreated {
+		t.Fatalf("Expected repost 201, got %d: %v", code, repost)
+	}
+	repostID := extractPostID(t, repost["post_id"])
+	original, _ := repost["original"].(map[string]interface{})
+	if repost["latitude"] != 40.7 || original == nil || extractPostID(t, original["post_id"]) != originalID || original["content"] != "Sunset from the rooftop" {
+		t.Errorf("Expected the repost at its own location with the original embedded, got %v", repost)
+	}
+
+	// reposting a repost reposts the original
+	code, again := create(fmt.Sprintf(`{"content":"","repost_of":%d,"repost_kind":"repost"}`, repostID))
+	if code != http.StatusCreated || extractPostID(t, again["repost_of_id"]) != originalID {
+		t.Fatalf("Expected a repost of the original, got %d: %v", code, again)
+	}
+	code, quote := create(fmt.Sprintf(`{"content":"Wish I was there","repost_of":%d,"repost_kind":"quote"}`, originalID))
+	if code != http.StatusCreated {
+		t.Fatalf("Expected quote 201, got %d: %v", code, quote)
+	}
+	quoteID := extractPostID(t, quote["post_id"])
+	if code, _ := create(fmt.Sprintf(`{"content":"","repost_of":%d,"repost_kind":"repost"}`, privateID)); code != http.StatusNotFound {
+		t.Errorf("Expected 404 reposting a private post, got %d", code)
+	}
+	if reposts, quotes := counts(originalID); reposts != 2 || quotes != 1 {
+		t.Errorf("Expected 2 reposts and 1 quote, got %d and %d", reposts, quotes)
+	}
+
+	feed, err := db.GetPosts(40.7, -74, 1000, 100, 0, "new", "all")
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	found := false
+	for _, p := range feed {
+		if extractPostID(t, p["post_id"]) == repostID {
+			found = true
+			if o, ok := p["original"].(map[string]interface{}); !ok || extractPostID(t, o["post_id"]) != originalID {
+				t.Errorf("Expected the feed to embed the original, got %v", p["original"])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the repost in the feed around its own location")
+	}
+
+	if err := db.DeletePost(extractPostID(t, again["post_id"])); err != nil {
+		t.Fatalf("Failed to delete repost: %v", err)
+	}
+	if reposts, quotes := counts(originalID); reposts != 1 || quotes != 1 {
+		t.Errorf("Expected 1 repost and 1 quote after deleting a repost, got %d and %d", reposts, quotes)
+	}
+
+	// deleting the original leaves tombstones behind
+	if err := db.DeletePost(originalID); err != nil {
+		t.Fatalf("Failed to delete original: %v", err)
+	}
+	for _, id := range []int{repostID, quoteID} {
+		post, err := db.GetPostById(id)
+		if err != nil {
+			t.Fatalf("Failed to get post: %v", err)
+		}
+		tombstone, _ := post["original"].(map[string]interface{})
+		if tombstone["deleted"] != true || post["repost_of_id"] != nil || post["repost_kind"] == nil {
+			t.Errorf("Expected a tombstone for post %d, got %v", id, post["original"])
+		}
+	}
+	if code, _ := create(fmt.Sprintf(`{"content":"","repost_of":%d,"repost_kind":"repost"}`, repostID)); code != http.StatusNotFound {
+		t.Errorf("Expected 404 reposting a repost of a deleted post, got %d", code)
+	}
+}
@@ -0,0 +1,118 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestEditPostKeepsRevisions edits a post twice and checks the history, the edited marker and the files
+func TestEditPostKeepsRevisions(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	ownerID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	if err := db.CreatePostFile(ownerID, "First version", 0, 0, "one.txt"); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	postID, err := db.GetLastPostByUser(ownerID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if err := fm.CreatePostFile(ownerID, postID, "one.txt", []byte("one")); err != nil {
+		t.Fatalf("Failed to store file: %v", err)
+	}
+
+	post, err := db.GetPostById(postID)
+	if err != nil || post["edited_at"] != nil {
+		t.Fatalf("Expected an unedited post, got %v, %v", post, err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	postPath := "/api/posts/" + strconv.Itoa(postID)
+	edit := func(userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", postPath, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, bearer(t, req, userID))
+		return rec
+	}
+
+	if rec := edit(otherID, `{"content":"Hijacked"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 editing someone else's post, got %d", rec.Code)
+	}
+	if rec := edit(ownerID, `{"content":""}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for empty content, got %d", rec.Code)
+	}
+
+	rec := edit(ownerID, `{"content":"Second version"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected edit 200, got %d", rec.Code)
+	}
+	var edited map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&edited)
+	if edited["content"] != "Second version" || edited["edited_at"] == nil || edited["file_name"] != "one.txt" {
+		t.Errorf("Unexpected edited post %v", edited)
+	}
+
+	if rec := edit(ownerID, `{"content":"Third version","file_name":"two.txt","media":"two"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected edit with new file 200, got %d", rec.Code)
+	}
+	if _, err := fm.GetPostFile(ownerID, postID, "one.txt"); err == nil {
+		t.Errorf("Expected the replaced file to be removed")
+	}
+	if data, err := fm.GetPostFile(ownerID, postID, "two.txt"); err != nil || string(data) != "two" {
+		t.Errorf("Expected the new file, got %q, %v", data, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", postPath+"/revisions", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected history 200, got %d", rec.Code)
+	}
+	var history struct {
+		Revisions []database.PostRevision `json:"revisions"`
+	}
+	json.NewDecoder(rec.Body).Decode(&history)
+	if len(history.Revisions) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(history.Revisions))
+	}
+	if history.Revisions[0].Content != "Second version" || history.Revisions[1].Content != "First version" {
+		t.Errorf("Unexpected revision order %+v", history.Revisions)
+	}
+	if history.Revisions[1].FileName != "one.txt" {
+		t.Errorf("Expected the first revision to remember its file, got %q", history.Revisions[1].FileName)
+	}
+
+	posts, err := db.GetPosts(0, 0, -1, 50, 0, "new", "all")
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	for _, p := range posts {
+		if extractPostID(t, p["post_id"]) == postID && p["edited_at"] == nil {
+			t.Errorf("Expected GetPosts to report edited_at")
+		}
+	}
+}
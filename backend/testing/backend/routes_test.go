@@ -0,0 +1,323 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/auth"
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"SpotLight/backend/src/routes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// routeCase describes the access rules of a single registered route
+type routeCase struct {
+	method       string
+	path         string
+	requiresAuth bool
+}
+
+// routeCases must list every route in routes.RegisterRoutes
+var routeCases = []routeCase{
+	{"POST", "/api/register", false},
+	{"POST", "/api/login", false},
+	{"DELETE", "/api/delete-user", true},
+	{"GET", "/api/profile/{id}", false},
+	{"POST", "/api/users/{id}/follow", true},
+	{"DELETE", "/api/users/{id}/follow", true},
+	{"POST", "/api/token/refresh", false},
+	{"POST", "/api/logout", true},
+	{"GET", "/api/sessions", true},
+	{"DELETE", "/api/sessions", true},
+	{"DELETE", "/api/sessions/{id}", true},
+	{"GET", "/api/auth/providers", false},
+	{"GET", "/api/auth/oidc/{provider}/start", false},
+	{"GET", "/api/auth/oidc/{provider}/callback", false},
+	{"GET", "/api/account/identities", true},
+	{"POST", "/api/account/identities/{provider}", true},
+	{"POST", "/api/account/password", true},
+	{"PUT", "/api/account/username", true},
+	{"POST", "/api/password-reset/request", false},
+	{"POST", "/api/password-reset/confirm", false},
+	{"POST", "/api/account/exports", true},
+	{"GET", "/api/account/exports", true},
+	{"GET", "/api/account/exports/{id}", true},
+	{"GET", "/api/account/exports/{id}/download", true},
+	{"GET", "/api/posts", false},
+	{"POST", "/api/posts", true},
+	{"GET", "/api/posts/clusters", false},
+	{"GET", "/api/posts/{id}", false},
+	{"PUT", "/api/posts/{id}", true},
+	{"DELETE", "/api/posts/{id}", true},
+	{"GET", "/api/posts/{id}/revisions", false},
+	{"GET", "/api/account/scheduled-posts", true},
+	{"PUT", "/api/account/scheduled-posts/{id}", true},
+	{"DELETE", "/api/account/scheduled-posts/{id}", true},
+	{"POST", "/api/posts/{id}/like", true},
+	{"POST", "/api/posts/{id}/unlike", true},
+	{"GET", "/api/posts/{id}/likes", false},
+	{"GET", "/api/posts/{id}/liked", false},
+	{"POST", "/api/posts/{id}/bookmark", true},
+	{"POST", "/api/posts/{id}/unbookmark", true},
+	{"GET", "/api/bookmarks", true},
+	{"GET", "/api/bookmarks/collections", true},
+	{"POST", "/api/bookmarks/collections", true},
+	{"PUT", "/api/bookmarks/collections/{id}", true},
+	{"DELETE", "/api/bookmarks/collections/{id}", true},
+	{"POST", "/api/posts/{id}/poll/vote", true},
+	{"PUT", "/api/posts/{id}/poll/vote", true},
+	{"POST", "/api/posts/{id}/comments", true},
+	{"GET", "/api/posts/{id}/comments", false},
+	{"DELETE", "/api/comments/{id}", true},
+	{"GET", "/api/file", false},
+	{"POST", "/api/dm/send", true},
+	{"GET", "/api/dm/history", true},
+	{"ANY", "/ws", true},
+	{"GET", "/api/search", false},
+	{"GET", "/api/tags/{tag}", false},
+	{"GET", "/api/admin/users", true},
+	{"POST", "/api/admin/users/{id}/suspend", true},
+	{"POST", "/api/admin/users/{id}/unsuspend", true},
+	{"PUT", "/api/admin/users/{id}/role", true},
+	{"DELETE", "/api/admin/users/{id}", true},
+	{"DELETE", "/api/admin/posts/{id}", true},
+	{"DELETE", "/api/admin/comments/{id}", true},
+	{"DELETE", "/api/admin/lockouts", true},
+}
+
+// newTestRouter builds the real router around a handler
+func newTestRouter(h *handler.RequestHandler) *mux.Router {
+	router := mux.NewRouter()
+	routes.RegisterRoutes(router, h)
+	return router
+}
+
+// bearer adds a freshly issued session token for the user to the request
+func bearer(t *testing.T, req *http.Request, userID int) *http.Request {
+	t.Helper()
+	token, _, err := auth.IssueToken(userID, 0)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// TestRouteTableCoversRouter makes sure no route is added without an access rule in routeCases
+func TestRouteTableCoversRouter(t *testing.T) {
+	router := newTestRouter(&handler.RequestHandler{})
+
+	known := map[string]bool{}
+	for _, rc := range routeCases {
+		known[rc.method+" "+rc.path] = false
+	}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		// subrouter prefixes have no handler of their own
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"ANY"}
+		}
+		for _, m := range methods {
+			key := m + " " + path
+			if _, ok := known[key]; !ok {
+				t.Errorf("Route %s is not covered by routeCases", key)
+			}
+			known[key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk router: %v", err)
+	}
+
+	for key, seen := range known {
+		if !seen {
+			t.Errorf("routeCases lists %s but it is not registered", key)
+		}
+	}
+}
+
+// TestProtectedRoutesRejectAnonymous verifies every protected route answers 401 without a session
+func TestProtectedRoutesRejectAnonymous(t *testing.T) {
+	router := newTestRouter(&handler.RequestHandler{})
+
+	for _, rc := range routeCases {
+		if !rc.requiresAuth {
+			continue
+		}
+		method := rc.method
+		if method == "ANY" {
+			method = "GET"
+		}
+		path := strings.ReplaceAll(rc.path, "{id}", "1")
+
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"username":"testUser"}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected 401 without a session, got %d", rc.method, rc.path, rec.Code)
+		}
+	}
+}
+
+// TestRoutesRejectBadToken verifies a forged token is refused before reaching any handler
+func TestRoutesRejectBadToken(t *testing.T) {
+	router := newTestRouter(&handler.RequestHandler{})
+
+	for _, rc := range routeCases {
+		method := rc.method
+		if method == "ANY" {
+			method = "GET"
+		}
+		path := strings.ReplaceAll(rc.path, "{id}", "1")
+
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer forged.token.value")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected 401 for a forged token, got %d", rc.method, rc.path, rec.Code)
+		}
+	}
+}
+
+// TestDestructiveRoutesForbidOtherUsers verifies only owners can delete their posts, comments and accounts
+func TestDestructiveRoutesForbidOtherUsers(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	ownerID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	if err := db.CreatePost(ownerID, "Owned post", 0, 0); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	_, posts, err := db.GetUserPosts(ownerID)
+	if err != nil || len(posts) == 0 {
+		t.Fatalf("Failed to retrieve posts: %v", err)
+	}
+	postID := extractPostID(t, posts[0]["post_id"])
+
+	if err := db.CreateNestedComment(postID, ownerID, nil, "Owned comment"); err != nil {
+		t.Fatalf("Failed to create comment: %v", err)
+	}
+	comments, err := db.GetNestedComments(postID)
+	if err != nil || len(comments) == 0 {
+		t.Fatalf("Failed to retrieve comments: %v", err)
+	}
+	commentID := comments[0].ID
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	send := func(method, path, body string, userID int) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = bearer(t, req, userID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	postPath := "/api/posts/" + strconv.Itoa(postID)
+	commentPath := "/api/comments/" + strconv.Itoa(commentID)
+	ownerIDStr := strconv.Itoa(ownerID)
+
+	forbidden := []struct{ method, path, body string }{
+		{"DELETE", commentPath, ""},
+		{"DELETE", postPath, ""},
+		{"DELETE", "/api/delete-user", `{"username":"testUser"}`},
+		{"POST", "/api/posts", `{"user_id":` + ownerIDStr + `,"content":"impersonated"}`},
+		{"POST", postPath + "/like", `{"user_id":` + ownerIDStr + `,"post_id":` + strconv.Itoa(postID) + `}`},
+		{"POST", postPath + "/unlike", `{"user_id":` + ownerIDStr + `,"post_id":` + strconv.Itoa(postID) + `}`},
+		{"POST", postPath + "/comments", `{"user_id":` + ownerIDStr + `,"content":"impersonated"}`},
+		{"POST", "/api/dm/send", `{"sender_id":` + ownerIDStr + `,"receiver_id":` + ownerIDStr + `,"content":"hi"}`},
+		{"GET", "/api/dm/history?sender_id=" + ownerIDStr + "&receiver_id=" + ownerIDStr, ""},
+	}
+	for _, c := range forbidden {
+		if code := send(c.method, c.path, c.body, otherID); code != http.StatusForbidden {
+			t.Errorf("%s %s as another user: expected 403, got %d", c.method, c.path, code)
+		}
+	}
+
+	if code := send("DELETE", "/api/posts/0", "", otherID); code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting a missing post, got %d", code)
+	}
+
+	if code := send("DELETE", commentPath, "", ownerID); code != http.StatusOK {
+		t.Errorf("Expected owner to delete their comment, got %d", code)
+	}
+	if code := send("DELETE", postPath, "", ownerID); code != http.StatusOK {
+		t.Errorf("Expected owner to delete their post, got %d", code)
+	}
+}
+
+// TestPublicRoutesStayOpen verifies read-only routes still work without a session
+func TestPublicRoutesStayOpen(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if err := db.CreatePost(userID, "Public post", 0, 0); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	_, posts, err := db.GetUserPosts(userID)
+	if err != nil || len(posts) == 0 {
+		t.Fatalf("Failed to retrieve posts: %v", err)
+	}
+	postPath := "/api/posts/" + strconv.Itoa(extractPostID(t, posts[0]["post_id"]))
+
+	router := newTestRouter(&handler.RequestHandler{DB: db})
+	for _, path := range []string{
+		"/api/posts",
+		postPath,
+		postPath + "/likes",
+		postPath + "/liked",
+		postPath + "/comments",
+		"/api/profile/" + strconv.Itoa(userID),
+		"/api/search?query=Public",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200 without a session, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/events"
+	"SpotLight/backend/src/handler"
+	"SpotLight/backend/src/scheduler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestScheduledPosts checks a scheduled post stays with its author until it goes out, can be
+// rescheduled and cancelled, and raises the same event as a normal post when published
+func TestScheduledPosts(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	var mu sync.Mutex
+	announced := map[int]bool{}
+	bus := events.NewBus()
+	bus.OnPostPublished(func(e events.PostPublished) {
+		mu.Lock()
+		defer mu.Unlock()
+		announced[e.PostID] = true
+	})
+	wasAnnounced := func(postID int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return announced[postID]
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm, Events: bus})
+	send := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if userID != 0 {
+			req = bearer(t, req, userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	createPost := func(body string) int {
+		t.Helper()
+		rec := send("POST", "/api/posts", authorID, body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var post map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&post)
+		return extractPostID(t, post["post_id"])
+	}
+
+	nowID := createPost(`{"content":"schedulecheck now"}`)
+	if !wasAnnounced(nowID) {
+		t.Errorf("Expected a normal post to be announced right away")
+	}
+
+	inAnHour := time.Now().Add(time.Hour).Format(time.RFC3339)
+	laterID := createPost(fmt.Sprintf(`{"content":"schedulecheck later","publish_at":%q,"expires_in":3600}`, inAnHour))
+	if wasAnnounced(laterID) {
+		t.Errorf("Expected a scheduled post not to be announced yet")
+	}
+	postPath := "/api/posts/" + strconv.Itoa(laterID)
+
+	if rec := send("GET", postPath, authorID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the author to see their scheduled post, got %d", rec.Code)
+	}
+	for _, viewer := range []int{0, otherID} {
+		if rec := send("GET", postPath, viewer, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Viewer %d: expected 404 for a scheduled post, got %d", viewer, rec.Code)
+		}
+	}
+	found, err := db.SearchPosts("schedulecheck", 50)
+	if err != nil || len(found) != 1 || extractPostID(t, found[0]["post_id"]) != nowID {
+		t.Errorf("Expected search to find only the published post, got %v, %v", found, err)
+	}
+	for _, p := range postsOf(t, db, authorID) {
+		if extractPostID(t, p["post_id"]) == laterID {
+			t.Errorf("Expected the profile to hide the scheduled post")
+		}
+	}
+	feed, err := db.GetPosts(0, 0, -1, 100, 0, "new", "all")
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	for _, p := range feed {
+		if extractPostID(t, p["post_id"]) == laterID {
+			t.Errorf("Expected the feed to hide the scheduled post")
+		}
+	}
+
+	var scheduled []map[string]interface{}
+	rec := send("GET", "/api/account/scheduled-posts", authorID, "")
+	json.NewDecoder(rec.Body).Decode(&scheduled)
+	if len(scheduled) != 1 || extractPostID(t, scheduled[0]["post_id"]) != laterID {
+		t.Fatalf("Expected the scheduled post in the list, got %v", scheduled)
+	}
+
+	schedulePath := "/api/account/scheduled-posts/" + strconv.Itoa(laterID)
+	inTwoHours := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	if rec := send("PUT", schedulePath, otherID, fmt.Sprintf(`{"publish_at":%q}`, inTwoHours.Format(time.RFC3339))); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 rescheduling someone else's post, got %d", rec.Code)
+	}
+	if rec := send("PUT", schedulePath, authorID, `{"publish_at":"2000-01-01T00:00:00Z"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 rescheduling into the past, got %d", rec.Code)
+	}
+	rec = send("PUT", schedulePath, authorID, fmt.Sprintf(`{"publish_at":%q}`, inTwoHours.Format(time.RFC3339)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected reschedule 200, got %d", rec.Code)
+	}
+	var moved map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&moved)
+	publishAt, _ := time.Parse(time.RFC3339, fmt.Sprint(moved["publish_at"]))
+	expiresAt, _ := time.Parse(time.RFC3339, fmt.Sprint(moved["expires_at"]))
+	if !publishAt.Equal(inTwoHours) || expiresAt.Sub(publishAt) != time.Hour {
+		t.Errorf("Expected the post and its expiry to move, got publish_at %v expires_at %v", moved["publish_at"], moved["expires_at"])
+	}
+
+	// a poll has to close after the post goes out, wherever it's moved to
+	pollID := createPost(fmt.Sprintf(`{"content":"schedulecheck poll","publish_at":%q,"poll":{"options":["a","b"],"closes_at":%q}}`,
+		inAnHour, time.Now().Add(90*time.Minute).Format(time.RFC3339)))
+	pollPath := "/api/account/scheduled-posts/" + strconv.Itoa(pollID)
+	if rec := send("PUT", pollPath, authorID, fmt.Sprintf(`{"publish_at":%q}`, inTwoHours.Format(time.RFC3339))); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 rescheduling past the poll's close, got %d", rec.Code)
+	}
+	if rec := send("PUT", pollPath, authorID, fmt.Sprintf(`{"publish_at":%q}`, time.Now().Add(80*time.Minute).Format(time.RFC3339))); rec.Code != http.StatusOK {
+		t.Errorf("Expected reschedule before the poll's close 200, got %d", rec.Code)
+	}
+
+	if rec := send("DELETE", schedulePath, authorID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected cancel 200, got %d", rec.Code)
+	}
+	if _, err := db.GetPostOwner(laterID); err == nil {
+		t.Errorf("Expected the cancelled post to be deleted")
+	}
+	if rec := send("DELETE", "/api/account/scheduled-posts/"+strconv.Itoa(nowID), authorID, ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 cancelling a published post, got %d", rec.Code)
+	}
+
+	// a post due in a moment goes out on the next publisher run
+	soon := time.Now().Add(time.Second)
+	soonID, err := db.SavePost(database.NewPost{UserID: authorID, Content: "schedulecheck soon", PublishAt: &soon}, nil)
+	if err != nil {
+		t.Fatalf("Failed to schedule post: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := scheduler.NewPublisher(db, bus).RunOnce(); err != nil {
+		t.Fatalf("Publisher failed: %v", err)
+	}
+	if !wasAnnounced(soonID) {
+		t.Errorf("Expected the publisher to announce the post")
+	}
+	if post, err := db.GetPostById(soonID); err != nil || post["publish_at"] != nil {
+		t.Errorf("Expected the post to be published, got %v, %v", post, err)
+	}
+}
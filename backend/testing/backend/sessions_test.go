@@ -0,0 +1,148 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// loginForTokens logs in through the router and returns the decoded token payload
+func loginForTokens(t *testing.T, h http.Handler, userAgent string) map[string]interface{} {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"testUser","password":"password"}`))
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected login 200, got %d", rec.Code)
+	}
+
+	var tokens map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+		t.Fatalf("Failed to decode login response: %v", err)
+	}
+	return tokens
+}
+
+// refresh exchanges a refresh token through the router
+func refresh(h http.Handler, refreshToken string) (int, map[string]interface{}) {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	req := httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var tokens map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&tokens)
+	return rec.Code, tokens
+}
+
+// TestRefreshTokenRotation verifies refresh tokens rotate and a replayed token revokes the session
+func TestRefreshTokenRotation(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	router := newTestRouter(&handler.RequestHandler{DB: db})
+	tokens := loginForTokens(t, router, "test-agent")
+	first := tokens["refresh_token"].(string)
+
+	code, rotated := refresh(router, first)
+	if code != http.StatusOK {
+		t.Fatalf("Expected refresh 200, got %d", code)
+	}
+	second := rotated["refresh_token"].(string)
+	if second == first {
+		t.Fatalf("Refresh token was not rotated")
+	}
+
+	// replaying the first token revokes the whole family
+	if code, _ := refresh(router, first); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 replaying a rotated token, got %d", code)
+	}
+	if code, _ := refresh(router, second); code != http.StatusUnauthorized {
+		t.Errorf("Expected the latest token to die with its session, got %d", code)
+	}
+
+	// and so does the access token issued with it
+	req := httptest.NewRequest("GET", "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+rotated["token"].(string))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the access token of a revoked session to be refused, got %d", rec.Code)
+	}
+}
+
+// TestListAndRevokeSessions verifies sessions can be listed, revoked one by one and all at once
+func TestListAndRevokeSessions(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	router := newTestRouter(&handler.RequestHandler{DB: db})
+	phone := loginForTokens(t, router, "phone")
+	laptop := loginForTokens(t, router, "laptop")
+	tablet := loginForTokens(t, router, "tablet")
+
+	send := func(method, path string, tokens map[string]interface{}) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens["token"].(string))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("GET", "/api/sessions", laptop)
+	var sessions []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatalf("Failed to decode sessions: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", len(sessions))
+	}
+	for _, s := range sessions {
+		isLaptop := s["user_agent"] == "laptop"
+		if s["current"] != isLaptop {
+			t.Errorf("Session %v has wrong current flag", s)
+		}
+	}
+
+	// revoke the phone from the laptop
+	phoneSession := strconv.Itoa(int(phone["session_id"].(float64)))
+	if rec := send("DELETE", "/api/sessions/"+phoneSession, laptop); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 revoking a session, got %d", rec.Code)
+	}
+	if code, _ := refresh(router, phone["refresh_token"].(string)); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked session to stop refreshing, got %d", code)
+	}
+	if rec := send("GET", "/api/sessions", phone); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked session's access token to be refused, got %d", rec.Code)
+	}
+
+	// log out everywhere
+	if rec := send("DELETE", "/api/sessions", laptop); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 revoking all sessions, got %d", rec.Code)
+	}
+	for _, tokens := range []map[string]interface{}{laptop, tablet} {
+		if code, _ := refresh(router, tokens["refresh_token"].(string)); code != http.StatusUnauthorized {
+			t.Errorf("Expected every session to be revoked, got %d", code)
+		}
+		if rec := send("GET", "/api/sessions", tokens); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected every access token to be refused, got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// fullScanSQL is the radius query GetPosts ran before the spatial index: the distance of every
+// row, restricted to one user's seeded posts
+const fullScanSQL = `
+	SELECT p.id FROM posts p
+	WHERE p.user_id = $1 AND ( 6371000 * acos(LEAST(1.0, GREATEST(-1.0,
+		cos(radians($2)) * cos(radians(p.latitude)) *
+		cos(radians(p.longitude) - radians($3)) +
+		sin(radians($2)) * sin(radians(p.latitude))
+	))) ) < $4`
+
+// radiusCentres are query points that stress the boxes: the poles, both sides of the
+// antimeridian and an ordinary city
+var radiusCentres = []struct {
+	name     string
+	lat, lon float64
+}{
+	{"gainesville", 29.6516, -82.3248},
+	{"north-pole", 89.95, 10},
+	{"south-pole", -90, 0},
+	{"antimeridian-east", 0.5, 179.98},
+	{"antimeridian-west", -65, -180},
+}
+
+// destination returns the point distance meters from (lat, lon) along bearing, in radians
+func destination(lat, lon, distance, bearing float64) (float64, float64) {
+	rad := math.Pi / 180
+	d := distance / database.EarthRadius
+	phi := math.Asin(math.Sin(lat*rad)*math.Cos(d) + math.Cos(lat*rad)*math.Sin(d)*math.Cos(bearing))
+	lambda := lon*rad + math.Atan2(math.Sin(bearing)*math.Sin(d)*math.Cos(lat*rad), math.Cos(d)-math.Sin(lat*rad)*math.Sin(phi))
+	return phi / rad, math.Remainder(lambda/rad, 360)
+}
+
+// TestRadiusBoxes checks every point within a radius lies in one of its boxes, around the poles
+// and across the antimeridian too, and that boxes stay within the coordinate ranges
+func TestRadiusBoxes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	centres := [][2]float64{{0, 0}, {90, 0}, {-89.9999, 45}, {0, 180}, {0, -180}, {71.2, -179.95}, {-33.87, 151.21}}
+	for _, c := range radiusCentres {
+		centres = append(centres, [2]float64{c.lat, c.lon})
+	}
+	for i := 0; i < 50; i++ {
+		centres = append(centres, [2]float64{math.Asin(2*rng.Float64()-1) * 180 / math.Pi, rng.Float64()*360 - 180})
+	}
+
+	for _, c := range centres {
+		for _, distance := range []float64{0, 5, 1000, 25000, 700000, 9000000} {
+			boxes := database.RadiusBoxes(c[0], c[1], distance)
+			if len(boxes) == 0 || len(boxes) > 2 {
+				t.Fatalf("%v %.0f m: expected one or two boxes, got %v", c, distance, boxes)
+			}
+			for _, b := range boxes {
+				if b.MinLat < -90 || b.MaxLat > 90 || b.MinLon < -180 || b.MaxLon > 180 || b.MinLon > b.MaxLon || b.MinLat > b.MaxLat {
+					t.Errorf("%v %.0f m: invalid box %+v", c, distance, b)
+				}
+			}
+			for i := 0; i < 500; i++ {
+				// half the points sit right on the edge of the circle
+				d := distance * rng.Float64()
+				if i%2 == 0 {
+					d = distance * (1 - 1e-12)
+				}
+				lat, lon := destination(c[0], c[1], d, rng.Float64()*2*math.Pi)
+				if database.GreatCircleDistance(c[0], c[1], lat, lon) >= distance {
+					continue
+				}
+				inside := false
+				for _, b := range boxes {
+					inside = inside || b.Contains(lat, lon)
+				}
+				if !inside {
+					t.Errorf("%v %.0f m: %v, %v is in the radius but not in %v", c, distance, lat, lon, boxes)
+				}
+			}
+		}
+	}
+
+	if boxes := database.RadiusBoxes(0, 179.99, 25000); len(boxes) != 2 {
+		t.Errorf("Expected a circle across the antimeridian to be split, got %v", boxes)
+	}
+	if boxes := database.RadiusBoxes(89.99, 0, 25000); len(boxes) != 1 || boxes[0].MinLon != -180 || boxes[0].MaxLon != 180 {
+		t.Errorf("Expected a circle over the pole to span every longitude, got %v", boxes)
+	}
+	if boxes := database.RadiusBoxes(0, 0, 3e7); boxes != nil {
+		t.Errorf("Expected no boxes for a radius covering the sphere, got %v", boxes)
+	}
+	if boxes := database.RadiusBoxes(math.NaN(), 0, 1000); boxes != nil {
+		t.Errorf("Expected no boxes for an invalid centre, got %v", boxes)
+	}
+}
+
+// connectPool opens a pool of its own on the test database, for seeding and the reference
+// queries
+func connectPool(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+	pool, err := pgxpool.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		tb.Fatalf("Failed to connect to database: %v", err)
+	}
+	return pool
+}
+
+// seedPosts inserts n public posts for a user, a quarter spread evenly over the globe and the
+// rest crowded around the poles and the antimeridian
+func seedPosts(tb testing.TB, pool *pgxpool.Pool, userID, n int) {
+	tb.Helper()
+	ctx := context.Background()
+	_, err := pool.Exec(ctx, `
+		INSERT INTO posts (user_id, content, latitude, longitude, created_at)
+		SELECT $1, 'spatialcheck', lat, lon, NOW() - g * INTERVAL '1 second'
+		FROM (
+			SELECT g,
+				CASE g % 4
+					WHEN 1 THEN 89 + random()
+					WHEN 2 THEN -89 - random()
+					ELSE degrees(asin(2 * random() - 1))
+				END AS lat,
+				CASE
+					WHEN g % 4 = 3 AND g % 8 = 3 THEN 180 - 2 * random()
+					WHEN g % 4 = 3 THEN -180 + 2 * random()
+					ELSE 360 * random() - 180
+				END AS lon
+			FROM generate_series(1, $2) g
+		) seeded`, userID, n)
+	if err != nil {
+		tb.Fatalf("Failed to seed posts: %v", err)
+	}
+	if _, err := pool.Exec(ctx, "ANALYZE posts"); err != nil {
+		tb.Fatalf("Failed to analyze posts: %v", err)
+	}
+}
+
+// TestGetPostsMatchesFullScan checks the index prefilter finds exactly the posts the old full
+// scan did
+func TestGetPostsMatchesFullScan(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+	pool := connectPool(t)
+	defer pool.Close()
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	seedPosts(t, pool, userID, 20000)
+
+	for _, c := range radiusCentres {
+		for _, distance := range []int{1000, 25000, 300000, 3000000} {
+			want := map[int]bool{}
+			rows, err := pool.Query(context.Background(), fullScanSQL, userID, c.lat, c.lon, distance)
+			if err != nil {
+				t.Fatalf("Failed to run full scan: %v", err)
+			}
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					t.Fatalf("Failed to scan: %v", err)
+				}
+				want[id] = true
+			}
+			rows.Close()
+
+			posts, err := db.GetPosts(c.lat, c.lon, distance, 1000000, 0, "new", "all")
+			if err != nil {
+				t.Fatalf("Failed to get posts: %v", err)
+			}
+			got := 0
+			for _, p := range posts {
+				if p["user_id"] != userID {
+					continue
+				}
+				got++
+				if id := extractPostID(t, p["post_id"]); !want[id] {
+					t.Errorf("%s %d m: post %d is outside the radius", c.name, distance, id)
+				}
+			}
+			if got != len(want) {
+				t.Errorf("%s %d m: expected %d posts like the full scan, got %d", c.name, distance, len(want), got)
+			}
+		}
+	}
+}
+
+// BenchmarkGetPostsRadius times a 25 km feed query against a million seeded posts through
+// GetPosts and through the full scan it replaced. The indexed side also loads attachments,
+// entities and the rest of each page, so the comparison flatters the full scan.
+func BenchmarkGetPostsRadius(b *testing.B) {
+	db, err := database.NewDBInterface()
+	if err != nil {
+		b.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	pool := connectPool(b)
+	defer pool.Close()
+
+	var indexed bool
+	err = pool.QueryRow(context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'posts_location_idx')").Scan(&indexed)
+	if err != nil || !indexed {
+		b.Fatalf("posts_location_idx is missing, create it as described in the README: %v", err)
+	}
+
+	// a run that died halfway may have left the user behind
+	db.DeleteUser("benchUser")
+	if err := db.Register("benchUser", "password"); err != nil {
+		b.Fatalf("Failed to register user: %v", err)
+	}
+	defer db.DeleteUser("benchUser")
+	userID, err := db.Authenticate("benchUser", "password")
+	if err != nil {
+		b.Fatalf("Failed to log in: %v", err)
+	}
+	seedPosts(b, pool, userID, 1000000)
+
+	for _, c := range radiusCentres {
+		b.Run(c.name+"/indexed", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.GetPosts(c.lat, c.lon, 25000, 20, 0, "new", "all"); err != nil {
+					b.Fatalf("Failed to get posts: %v", err)
+				}
+			}
+		})
+		b.Run(c.name+"/fullscan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rows, err := pool.Query(context.Background(), fullScanSQL+" ORDER BY p.created_at DESC LIMIT 20", userID, c.lat, c.lon, 25000)
+				if err != nil {
+					b.Fatalf("Failed to run full scan: %v", err)
+				}
+				for rows.Next() {
+				}
+				rows.Close()
+			}
+		})
+	}
+}
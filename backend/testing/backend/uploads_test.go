@@ -0,0 +1,158 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// multipartPost builds a multipart post request with the given fields and files
+func multipartPost(t *testing.T, fields map[string]string, files map[string][]byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	for name, data := range files {
+		fw, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatalf("Failed to add file: %v", err)
+		}
+		fw.Write(data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/posts", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// stagedFiles lists what's left in the upload staging folder
+func stagedFiles(t *testing.T, root string) []os.DirEntry {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(root, database.UploadStagingDir))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read staging folder: %v", err)
+	}
+	return entries
+}
+
+// TestStageUpload streams files into staging, enforces the limit and moves them into a post folder
+func TestStageUpload(t *testing.T) {
+	root := t.TempDir()
+	fm := database.NewFileManagerPath(root)
+
+	if _, _, err := fm.StageUpload(strings.NewReader("0123456789!"), 10); !errors.Is(err, database.ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge, got %v", err)
+	}
+	if left := stagedFiles(t, root); len(left) != 0 {
+		t.Errorf("Expected an oversized upload to be removed, found %d files", len(left))
+	}
+
+	staged, size, err := fm.StageUpload(strings.NewReader("0123456789"), 10)
+	if err != nil || size != 10 {
+		t.Fatalf("Expected a 10 byte upload to stage, got %d, %v", size, err)
+	}
+	if err := fm.CommitUpload(staged, 3, 9, "digits.txt"); err != nil {
+		t.Fatalf("Failed to commit upload: %v", err)
+	}
+	if data, err := fm.GetPostFile(3, 9, "digits.txt"); err != nil || string(data) != "0123456789" {
+		t.Errorf("Expected the committed file, got %q, %v", data, err)
+	}
+	if err := fm.DiscardUpload(staged); err != nil {
+		t.Errorf("Expected discarding a committed upload to be a no-op, got %v", err)
+	}
+
+	outside := filepath.Join(root, "elsewhere.txt")
+	os.WriteFile(outside, []byte("x"), 0644)
+	if err := fm.CommitUpload(outside, 3, 9, "moved.txt"); err == nil {
+		t.Errorf("Expected files outside staging to be refused")
+	}
+}
+
+// TestMultipartRejectsOversizedUploads checks the multipart size limits before anything touches the
+// database, and that rejected uploads leave nothing staged
+func TestMultipartRejectsOversizedUploads(t *testing.T) {
+	root := t.TempDir()
+	router := newTestRouter(&handler.RequestHandler{
+		FM:      database.NewFileManagerPath(root),
+		Uploads: handler.UploadLimits{MaxFileBytes: 16, MaxRequestBytes: 1024},
+	})
+	fields := map[string]string{"content": "hi", "latitude": "1", "longitude": "2"}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, multipartPost(t, fields, map[string][]byte{"a.txt": []byte("small")}))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an anonymous upload, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, bearer(t, multipartPost(t, fields, map[string][]byte{"big.txt": bytes.Repeat([]byte("x"), 17)}), 1))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized file, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, bearer(t, multipartPost(t, fields, map[string][]byte{"huge.txt": bytes.Repeat([]byte("x"), 2048)}), 1))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized request, got %d", rec.Code)
+	}
+
+	if left := stagedFiles(t, root); len(left) != 0 {
+		t.Errorf("Expected rejected uploads to be cleaned up, found %d files", len(left))
+	}
+}
+
+// TestCreatePostMultipart creates a post from a multipart upload
+func TestCreatePostMultipart(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	image, _ := base64.StdEncoding.DecodeString(pngMedia(t, 5, 7))
+	fields := map[string]string{"user_id": strconv.Itoa(userID), "content": "Streamed", "latitude": "29.6", "longitude": "-82.3"}
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, bearer(t, multipartPost(t, fields, map[string][]byte{"photo.png": image}), userID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	postID, err := db.GetLastPostByUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	attachments, err := db.GetAttachments(postID)
+	if err != nil || len(attachments) != 1 {
+		t.Fatalf("Expected one attachment, got %+v, %v", attachments, err)
+	}
+	a := attachments[0]
+	if a.FileName != "photo.png" || a.MimeType != "image/png" || a.SizeBytes != int64(len(image)) || a.Width == nil || *a.Width != 5 || *a.Height != 7 {
+		t.Errorf("Unexpected attachment %+v", a)
+	}
+	if data, err := fm.GetPostFile(userID, postID, "photo.png"); err != nil || !bytes.Equal(data, image) {
+		t.Errorf("Expected the uploaded file on disk, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestChangeUsername renames an account, checks media still resolves and the old name is reserved
+func TestChangeUsername(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+	defer db.DeleteUser("testUserRenamed")
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	userID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	if err := db.CreatePostFile(userID, "Before rename", 0, 0, "hello.txt"); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	postID, err := db.GetLastPostByUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if err := fm.CreatePostFile(userID, postID, "hello.txt", []byte("hello")); err != nil {
+		t.Fatalf("Failed to store file: %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	rename := func(userID int, username string) int {
+		req := httptest.NewRequest("PUT", "/api/account/username", strings.NewReader(`{"username":"`+username+`"}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, bearer(t, req, userID))
+		return rec.Code
+	}
+
+	if code := rename(userID, "bad name"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid name, got %d", code)
+	}
+	if code := rename(userID, "testUser2"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a taken name, got %d", code)
+	}
+	if code := rename(userID, "testUserRenamed"); code != http.StatusOK {
+		t.Fatalf("Expected rename 200, got %d", code)
+	}
+
+	if name, err := db.GetUserNameId(userID); err != nil || name != "testUserRenamed" {
+		t.Errorf("Expected new username, got %q, %v", name, err)
+	}
+	if _, err := db.Authenticate("testUserRenamed", "password"); err != nil {
+		t.Errorf("Expected to log in with the new name: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET",
+		"/api/file?userId="+strconv.Itoa(userID)+"&postId="+strconv.Itoa(postID)+"&fileName=hello.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("Expected media to survive the rename, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// the old name is held for its owner
+	if code := rename(otherID, "testUser"); code != http.StatusConflict {
+		t.Errorf("Expected 409 taking a reserved name, got %d", code)
+	}
+	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"username":"testUser","password":"password"}`))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 registering a reserved name, got %d", rec.Code)
+	}
+
+	// but the owner can take it back
+	if code := rename(userID, "testUser"); code != http.StatusOK {
+		t.Errorf("Expected owner to reclaim their old name, got %d", code)
+	}
+}
+
+// TestConcurrentRenames checks two users renaming to the same name at once end up with one
+// rename and one ErrUsernameTaken, never a raw database error
+func TestConcurrentRenames(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+	defer db.DeleteUser("testUserRenamed")
+
+	var ids []int
+	for _, name := range []string{"testUser", "testUser2"} {
+		if err := db.Register(name, "password"); err != nil {
+			t.Fatalf("Failed to register user: %v", err)
+		}
+		*userCreated = true
+		id, err := db.Authenticate(name, "password")
+		if err != nil {
+			t.Fatalf("Failed to log in: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i, id int) {
+			defer wg.Done()
+			_, errs[i] = db.RenameUser(id, "testUserRenamed", database.UsernameCooldown)
+		}(i, id)
+	}
+	wg.Wait()
+
+	renamed, taken := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			renamed++
+		case errors.Is(err, database.ErrUsernameTaken):
+			taken++
+		default:
+			t.Errorf("Unexpected rename error: %v", err)
+		}
+	}
+	if renamed != 1 || taken != 1 {
+		t.Errorf("Expected one rename and one ErrUsernameTaken, got %v", errs)
+	}
+}
+
+// TestRegisterTakenUsername checks registering a name that's already in use is a 409, the
+// same as a reserved one, rather than a failed insert
+func TestRegisterTakenUsername(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestData(db, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+
+	if err := db.Register("testUser", "password2"); !errors.Is(err, database.ErrUsernameTaken) {
+		t.Errorf("Expected ErrUsernameTaken registering a taken name, got %v", err)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db})
+	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"username":"testUser","password":"password2"}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 registering a taken name, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package backend_test
+
+import (
+	"SpotLight/backend/src/database"
+	"SpotLight/backend/src/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPostVisibility checks each visibility level on every read path: followers-only posts need a
+// follow, private ones are the author's alone and local ones need a viewer within the radius
+func TestPostVisibility(t *testing.T) {
+	db, userCreated := setupTestDB(t)
+	fm := database.NewFileManagerPath("../../../data")
+	defer db.Close()
+	defer cleanupTestDataAll(db, fm, userCreated, t)
+
+	if err := db.Register("testUser", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := db.Register("testUser2", "password"); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	*userCreated = true
+	authorID, err := db.Authenticate("testUser", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	otherID, err := db.Authenticate("testUser2", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	create := func(visibility string) int {
+		t.Helper()
+		files := []database.Attachment{{FileName: "note.txt", MimeType: "text/plain", SizeBytes: 4}}
+		postID, err := db.SavePost(database.NewPost{
+			UserID: authorID, Content: "visibilitycheck " + visibility, Latitude: 29.65, Longitude: -82.32,
+			Visibility: visibility, LocalRadius: 1000, Attachments: files,
+		}, func(postID int) error {
+			return fm.CreatePostFile(authorID, postID, "note.txt", []byte("note"))
+		})
+		if err != nil {
+			t.Fatalf("Failed to create %s post: %v", visibility, err)
+		}
+		return postID
+	}
+	ids := map[string]int{}
+	for _, v := range []string{database.VisibilityPublic, database.VisibilityFollowers, database.VisibilityPrivate, database.VisibilityLocal} {
+		ids[v] = create(v)
+	}
+
+	router := newTestRouter(&handler.RequestHandler{DB: db, FM: fm})
+	send := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if userID != 0 {
+			req = bearer(t, req, userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	// visibleTo lists which of the test posts a feed request returns
+	visibleTo := func(userID int, query string) map[string]bool {
+		t.Helper()
+		rec := send("GET", "/api/posts?limit=100&"+query, userID, "")
+		var posts []map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&posts); err != nil {
+			t.Fatalf("Failed to decode feed: %v", err)
+		}
+		seen := map[string]bool{}
+		for _, p := range posts {
+			for v, id := range ids {
+				if extractPostID(t, p["post_id"]) == id {
+					seen[v] = true
+				}
+			}
+		}
+		return seen
+	}
+	expect := func(who string, seen map[string]bool, want ...string) {
+		t.Helper()
+		if len(seen) != len(want) {
+			t.Errorf("%s: expected %v, saw %v", who, want, seen)
+			return
+		}
+		for _, v := range want {
+			if !seen[v] {
+				t.Errorf("%s: expected to see the %s post, saw %v", who, v, seen)
+			}
+		}
+	}
+
+	near := "latitude=29.651&longitude=-82.32"
+	far := "latitude=29.7&longitude=-82.32"
+	expect("anonymous", visibleTo(0, ""), "public")
+	expect("anonymous nearby", visibleTo(0, near), "public", "local")
+	expect("other user far away", visibleTo(otherID, far+"&distance=20000"), "public")
+	expect("author", visibleTo(authorID, ""), "public", "followers", "private", "local")
+
+	followersPath := fmt.Sprintf("/api/posts/%d", ids["followers"])
+	if rec := send("GET", followersPath, otherID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a followers post before following, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/users/%d/follow", otherID), otherID, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 following yourself, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/users/%d/follow", authorID), otherID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected follow 200, got %d", rec.Code)
+	}
+	if rec := send("GET", followersPath, otherID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected a follower to see the followers post, got %d", rec.Code)
+	}
+	expect("follower nearby", visibleTo(otherID, near), "public", "followers", "local")
+
+	localPath := fmt.Sprintf("/api/posts/%d", ids["local"])
+	if rec := send("GET", localPath+"?"+near, otherID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected a nearby viewer to see the local post, got %d", rec.Code)
+	}
+	for _, query := range []string{"", "?" + far} {
+		if rec := send("GET", localPath+query, otherID, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for the local post at %q, got %d", query, rec.Code)
+		}
+	}
+
+	// everything hanging off a private post is as hidden as the post itself
+	privateID := ids["private"]
+	for _, path := range []string{
+		fmt.Sprintf("/api/posts/%d", privateID),
+		fmt.Sprintf("/api/posts/%d/comments", privateID),
+		fmt.Sprintf("/api/posts/%d/likes", privateID),
+		fmt.Sprintf("/api/posts/%d/revisions", privateID),
+		fmt.Sprintf("/api/file?userId=%d&postId=%d&fileName=note.txt", authorID, privateID),
+	} {
+		if rec := send("GET", path, otherID, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404 for another user, got %d", path, rec.Code)
+		}
+		if rec := send("GET", path, authorID, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected the author to get 200, got %d", path, rec.Code)
+		}
+	}
+	like := fmt.Sprintf(`{"user_id":%d,"post_id":%d}`, otherID, privateID)
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/like", privateID), otherID, like); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 liking a private post, got %d", rec.Code)
+	}
+	if rec := send("POST", fmt.Sprintf("/api/posts/%d/comments", privateID), otherID, `{"content":"hi"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 commenting on a private post, got %d", rec.Code)
+	}
+
+	found, err := db.SearchPosts("visibilitycheck", 50)
+	if err != nil || len(found) != 1 || extractPostID(t, found[0]["post_id"]) != ids["public"] {
+		t.Errorf("Expected anonymous search to find only the public post, got %v, %v", found, err)
+	}
+	if _, posts, err := db.GetUserPostsAs(authorID, database.Viewer{UserID: otherID}); err != nil || len(posts) != 2 {
+		t.Errorf("Expected a follower without a location to see 2 profile posts, got %d, %v", len(posts), err)
+	}
+
+	if rec := send("DELETE", fmt.Sprintf("/api/users/%d/follow", authorID), otherID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected unfollow 200, got %d", rec.Code)
+	}
+	if rec := send("GET", followersPath, otherID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the followers post after unfollowing, got %d", rec.Code)
+	}
+}
@@ -11,7 +11,8 @@ jest.mock('next/navigation', () => ({
 }));
 
 jest.mock('@/services/api', () => ({
-  createPost: jest.fn().mockResolvedValue({ data: { message: 'Success' } })
+  createPost: jest.fn().mockResolvedValue({ data: { message: 'Success' } }),
+  createPostWithFiles: jest.fn().mockResolvedValue({ data: { message: 'Success' } })
 }));
 
 jest.mock('@/hooks/useAuth', () => ({
@@ -0,0 +1,56 @@
+'use client';
+
+import { useEffect, useState } from 'react';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/hooks/useAuth';
+
+// Messages for the error codes the backend puts in the fragment
+const errorMessages: Record<string, string> = {
+  access_denied: 'Sign in was cancelled.',
+  invalid_state: 'This sign in link has expired, please try again.',
+  identity_linked: 'That account is already linked to another SpotLight user.',
+  suspended: 'This account has been suspended.',
+};
+
+export default function LoginCallbackPage() {
+  const [error, setError] = useState('');
+  const router = useRouter();
+  const { login: setAuth } = useAuth();
+
+  useEffect(() => {
+    // tokens come back in the fragment so they never reach a server
+    const result = new URLSearchParams(window.location.hash.slice(1));
+    window.history.replaceState(null, '', window.location.pathname);
+
+    const code = result.get('error');
+    if (code) {
+      setError(errorMessages[code] ?? 'Sign in failed, please try again.');
+      return;
+    }
+    if (result.get('linked')) {
+      router.push('/');
+      return;
+    }
+
+    const userId = Number(result.get('user_id'));
+    localStorage.setItem('authToken', result.get('token') ?? '');
+    localStorage.setItem('refreshToken', result.get('refresh_token') ?? '');
+    setAuth(result.get('username') ?? '', userId);
+    router.push('/');
+    router.refresh();
+  }, [router, setAuth]);
+
+  return (
+      <div className="min-h-[calc(100vh-6rem)] flex items-center justify-center px-4">
+        <div className="text-sm text-[#d7dadc]">
+          {error ? (
+              <div className="bg-red-500/10 border border-red-500/50 rounded px-4 py-3 text-xs text-red-400 text-center">
+                {error}
+              </div>
+          ) : (
+              'Signing you in...'
+          )}
+        </div>
+      </div>
+  );
+}
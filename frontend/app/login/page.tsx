@@ -1,8 +1,8 @@
 'use client';
 
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { useRouter } from 'next/navigation';
-import { login, register } from '@/services/api';
+import { getAuthProviders, login, oidcStartUrl, register } from '@/services/api';
 import { useAuth } from '@/hooks/useAuth';
 
 type AuthMode = 'login' | 'register';
@@ -12,29 +12,44 @@ export default function LoginPage() {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
   const [error, setError] = useState('');
+  const [providers, setProviders] = useState<string[]>([]);
   const router = useRouter();
   const { login: setAuth } = useAuth();
 
+  useEffect(() => {
+    getAuthProviders()
+      .then((response) => setProviders(response.data.providers))
+      .catch(() => setProviders([]));
+  }, []);
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError('');
 
     try {
       let userId;
+      let token;
+      let refreshToken;
 
       if (mode === 'register') {
         await register(username, password);
         // After registration, log in immediately
         const response = await login(username, password);
         userId = response.data.user_id;
+        token = response.data.token;
+        refreshToken = response.data.refresh_token;
       } else {
         const response = await login(username, password);
         userId = response.data.user_id;
+        token = response.data.token;
+        refreshToken = response.data.refresh_token;
       }
 
-      // Store userId and update auth state
+      // Store userId and session token, then update auth state
       if (typeof window !== 'undefined') {
         localStorage.setItem('userId', userId.toString());
+        localStorage.setItem('authToken', token);
+        localStorage.setItem('refreshToken', refreshToken);
       }
 
       setAuth(username, userId);
@@ -96,6 +111,20 @@ export default function LoginPage() {
               </button>
             </form>
 
+            {providers.length > 0 && (
+                <div className="mt-4 space-y-2">
+                  {providers.map((provider) => (
+                      <a
+                          key={provider}
+                          href={oidcStartUrl(provider)}
+                          className="block w-full py-2 px-4 border border-[#343536] hover:border-[#4e4f50] text-white text-sm text-center rounded-md transition-colors"
+                      >
+                        Sign in with {provider}
+                      </a>
+                  ))}
+                </div>
+            )}
+
             <div className="mt-6 text-center text-sm text-[#818384]">
               {mode === 'login' ? (
                   <>
@@ -3,7 +3,7 @@
 import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import { useAuth } from '@/hooks/useAuth';
-import { createPost } from '@/services/api';
+import { createPost, createPostWithFiles } from '@/services/api';
 import { MapPin, Image, X, ChartNoAxesColumnDecreasing } from 'lucide-react';
 
 interface Location {
@@ -45,6 +45,15 @@ export default function SubmitPage() {
   const [mediaFile, setMediaFile] = useState<File | null>(null);
   const [mediaPreview, setMediaPreview] = useState<string>('');
 
+  // Seconds until the post disappears, 0 keeps it
+  const [expiresIn, setExpiresIn] = useState(0);
+  // Local date and time to publish at, empty posts right away
+  const [publishAt, setPublishAt] = useState('');
+  // Who can see the post
+  const [visibility, setVisibility] = useState<'public' | 'followers' | 'private' | 'local'>('public');
+  // How precisely others see where the post was made
+  const [locationPrecision, setLocationPrecision] = useState<'exact' | '100m' | 'neighborhood' | 'city'>('exact');
+
   useEffect(() => {
     // Only proceed with auth check after useAuth has finished loading
     if (!isAuthLoading) {
@@ -152,38 +161,22 @@ export default function SubmitPage() {
     setError('');
 
     try {
-      let mediaData = '';
-      let fileName = '';
-
-      if (mediaFile) {
-        // Read file as base64
-        const reader = new FileReader();
-        const base64Promise = new Promise<string>((resolve, reject) => {
-          reader.onload = () => {
-            // Extract only the base64 data part after the comma
-            // e.g., from "data:image/jpeg;base64,/9j/4AAQ..." we only want "/9j/4AAQ..."
-            const result = reader.result as string;
-            const base64Data = result.split(',')[1];
-            resolve(base64Data);
-          };
-          reader.onerror = reject;
-        });
-
-        reader.readAsDataURL(mediaFile);
-        mediaData = await base64Promise;
-        fileName = mediaFile.name;
-      }
-
       const postData = {
         user_id: userId,
         content: content.trim(),
-        file_name: fileName,
-        media: mediaData,
         latitude: location.lat,
         longitude: location.lon,
+        ...(expiresIn > 0 && { expires_in: expiresIn }),
+        ...(publishAt && { publish_at: new Date(publishAt).toISOString() }),
+        visibility,
+        location_precision: locationPrecision,
       };
 
-      await createPost(postData);
+      if (mediaFile) {
+        await createPostWithFiles(postData, [mediaFile]);
+      } else {
+        await createPost(postData);
+      }
       router.push('/');
     } catch (err) {
       console.error('Post creation failed:', err);
@@ -279,6 +272,67 @@ export default function SubmitPage() {
               )}
             </div>
 
+            {/* Ephemeral posts */}
+            <div className="flex items-center space-x-2 text-sm text-[#818384]">
+              <label htmlFor="expires-in">Disappears</label>
+              <select
+                id="expires-in"
+                value={expiresIn}
+                onChange={(e) => setExpiresIn(Number(e.target.value))}
+                className="px-2 py-1 bg-black/40 border border-[#343536] rounded-md text-white text-sm focus:outline-none focus:border-[#4e4f50]"
+              >
+                <option value={0}>Never</option>
+                <option value={3600}>After 1 hour</option>
+                <option value={6 * 3600}>After 6 hours</option>
+                <option value={24 * 3600}>After 1 day</option>
+                <option value={7 * 24 * 3600}>After 1 week</option>
+              </select>
+            </div>
+
+            {/* Scheduled posts */}
+            <div className="flex items-center space-x-2 text-sm text-[#818384]">
+              <label htmlFor="publish-at">Publish at</label>
+              <input
+                id="publish-at"
+                type="datetime-local"
+                value={publishAt}
+                onChange={(e) => setPublishAt(e.target.value)}
+                className="px-2 py-1 bg-black/40 border border-[#343536] rounded-md text-white text-sm focus:outline-none focus:border-[#4e4f50]"
+              />
+            </div>
+
+            {/* Post visibility */}
+            <div className="flex items-center space-x-2 text-sm text-[#818384]">
+              <label htmlFor="visibility">Visible to</label>
+              <select
+                id="visibility"
+                value={visibility}
+                onChange={(e) => setVisibility(e.target.value as typeof visibility)}
+                className="px-2 py-1 bg-black/40 border border-[#343536] rounded-md text-white text-sm focus:outline-none focus:border-[#4e4f50]"
+              >
+                <option value="public">Everyone</option>
+                <option value="followers">Followers</option>
+                <option value="local">People nearby</option>
+                <option value="private">Only me</option>
+              </select>
+            </div>
+
+            {/* Location precision */}
+            <div className="flex items-center space-x-2 text-sm text-[#818384]">
+              <label htmlFor="location-precision">Show location</label>
+              <select
+                id="location-precision"
+                value={locationPrecision}
+                onChange={(e) => setLocationPrecision(e.target.value as typeof locationPrecision)}
+                className="px-2 py-1 bg-black/40 border border-[#343536] rounded-md text-white text-sm focus:outline-none focus:border-[#4e4f50]"
+              >
+                <option value="exact">Exactly</option>
+                <option value="100m">Within 100 m</option>
+                <option value="neighborhood">Neighborhood</option>
+                <option value="city">City</option>
+              </select>
+            </div>
+
             {/* Existing Location Display */}
             {location && (
               <div className="flex flex-col space-y-1">
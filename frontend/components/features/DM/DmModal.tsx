@@ -77,18 +77,12 @@ export function DmModal({ recipientUserId, recipientUsername, children }: DmModa
     const connectWebSocket = useCallback(() => {
         if (!senderId || !isOpen) return;
 
-        const wsUrlWithUser = `${WS_URL}?user_id=${senderId}`;
-        console.log(`Connecting to WebSocket: ${wsUrlWithUser}`);
+        const wsUrlWithUser = `${WS_URL}?token=${encodeURIComponent(localStorage.getItem('authToken') ?? '')}`;
         ws.current = new WebSocket(wsUrlWithUser);
 
-        ws.current.onopen = () => {
-            console.log('WebSocket connected');
-        };
-
         ws.current.onmessage = (event) => {
             try {
                 const receivedMessage: WebSocketReceiveMessage = JSON.parse(event.data);
-                console.log('WebSocket message received:', receivedMessage);
 
                 // Check if the received message pertains to the currently open chat
                 if ((receivedMessage.from === senderId && receivedMessage.to === recipientUserId) ||
@@ -165,7 +159,6 @@ export function DmModal({ recipientUserId, recipientUsername, children }: DmModa
 
         try {
             ws.current.send(JSON.stringify(messageToSend));
-            console.log('Message sent via WebSocket:', messageToSend);
             // setMessages((prev) => [...prev, { ...message, sender_id: senderId, receiver_id: recipientUserId, created_at: new Date().toISOString() }]);
             setNewMessage('');
             setTimeout(scrollToBottom, 0); // Scroll after sending
@@ -9,7 +9,7 @@ import { Input } from "@/components/shadcn/ui/input";
 import { Popover, PopoverContent, PopoverTrigger } from "@/components/shadcn/ui/popover";
 import { useDebounce } from 'use-debounce';
 import useSWR from 'swr';
-import { searchContent } from '@/services/api';
+import { searchContent, logout as apiLogout } from '@/services/api';
 import { Post } from '@/types/post';
 import { UserProfile } from '@/types/user';
 
@@ -69,8 +69,11 @@ export function Header() {
     } 
   }, [debouncedQuery]);
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    // revoke the session server side before dropping the tokens
+    await apiLogout().catch(() => {});
     localStorage.removeItem('authToken');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('username');
     logout();
     setIsMenuOpen(false);
@@ -37,6 +37,8 @@ export const useAuth = create<AuthState>()(
 
                 if (typeof window !== 'undefined') {
                     localStorage.removeItem('userId');
+                    localStorage.removeItem('authToken');
+                    localStorage.removeItem('refreshToken');
                 }
 
                 set({ isAuthenticated: false, username: null, userId: null, isLoading: false });
@@ -17,6 +17,31 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Access tokens are short-lived, so on a 401 swap the refresh token for a new pair and retry once
+api.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config;
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (error.response?.status !== 401 || !refreshToken || original._retried || original.url === '/api/token/refresh') {
+      return Promise.reject(error);
+    }
+    original._retried = true;
+
+    try {
+      const { data } = await api.post('/api/token/refresh', { refresh_token: refreshToken });
+      localStorage.setItem('authToken', data.token);
+      localStorage.setItem('refreshToken', data.refresh_token);
+      original.headers.Authorization = `Bearer ${data.token}`;
+      return api(original);
+    } catch (refreshError) {
+      localStorage.removeItem('authToken');
+      localStorage.removeItem('refreshToken');
+      return Promise.reject(refreshError);
+    }
+  }
+);
+
 // async helper function to get location
 function getCurrentLocation(): Promise<{ latitude: number; longitude: number }> {
   return new Promise((resolve, reject) => {
@@ -43,6 +68,16 @@ export const login = (username: string, password: string) =>
 export const register = (username: string, password: string) => 
   api.post('/api/register', { username, password });
 
+export const logout = () =>
+  api.post('/api/logout');
+
+// External login providers, the browser is sent to the start URL and comes back on /login/callback
+export const getAuthProviders = () =>
+  api.get('/api/auth/providers');
+
+export const oidcStartUrl = (provider: string) =>
+  `${API_URL}/api/auth/oidc/${encodeURIComponent(provider)}/start`;
+
 export const deleteUser = (username: string) =>
   api.delete('/api/delete-user', { data: { username } });
 
@@ -54,6 +89,7 @@ export const getPosts = async (params?: {
   offset?: number;
   sort?: string; 
   time?: string; 
+  bbox?: [number, number, number, number]; // [minLon, minLat, maxLon, maxLat], minLon > maxLon crosses the antimeridian
 }) => {
   // Use provided params or set defaults
   const distance = Math.round(params?.radius ?? 25000); 
@@ -86,6 +122,11 @@ export const getPosts = async (params?: {
 
   // Construct the base URL
   let url = `/api/posts?limit=${limit}&offset=${offset}&sort=${sort}&time=${time}`;
+
+  // A viewport replaces the radius, the location then only identifies the viewer
+  if (params?.bbox) {
+    url += `&bbox=${params.bbox.join(',')}`;
+  }
   
   // Append location parameters ONLY IF they are valid numbers (not undefined or Infinity)
   if (typeof reqLatitude === 'number' && typeof reqLongitude === 'number' && isFinite(reqLatitude) && isFinite(reqLongitude)) {
@@ -100,21 +141,149 @@ export const getPosts = async (params?: {
   return api.get(url);
 };
 
+// Posts in a viewport grouped into clusters for the map, one entry per tile. Fetch one tile per
+// call with its own bbox to cache tiles separately.
+export const getPostClusters = (bbox: [number, number, number, number], zoom: number, params?: {
+  latitude?: number;
+  longitude?: number;
+  sort?: string;
+  time?: string;
+}) => {
+  const query = new URLSearchParams({
+    bbox: bbox.join(','),
+    zoom: String(zoom),
+    sort: params?.sort ?? 'new',
+    time: params?.time ?? 'all',
+  });
+  if (params?.latitude !== undefined && params?.longitude !== undefined) {
+    query.set('latitude', String(params.latitude));
+    query.set('longitude', String(params.longitude));
+  }
+  return api.get(`/api/posts/clusters?${query}`);
+};
+
 export const getPostById = (postId: number) =>
   api.get(`/api/posts/${postId}`);
 
+// Posts with a hashtag, takes the same filters as getPosts but only uses a location when given one
+export const getTagPosts = (tag: string, params?: {
+  latitude?: number;
+  longitude?: number;
+  radius?: number;
+  limit?: number;
+  offset?: number;
+  sort?: string;
+  time?: string;
+}) => {
+  const query = new URLSearchParams({
+    limit: String(params?.limit ?? 20),
+    offset: String(params?.offset ?? 0),
+    sort: params?.sort ?? 'new',
+    time: params?.time ?? 'all',
+  });
+  if (params?.latitude !== undefined && params?.longitude !== undefined) {
+    query.set('latitude', String(params.latitude));
+    query.set('longitude', String(params.longitude));
+    query.set('distance', String(Math.round(params.radius ?? 25000)));
+  }
+  return api.get(`/api/tags/${encodeURIComponent(tag)}?${query}`);
+};
+
 export const createPost = (data: {
   user_id: number,
   content: string,
   file_name?: string, // media file name
   media?: string, // actual media data
   latitude: number, 
-  longitude: number 
+  longitude: number,
+  expires_in?: number, // seconds until the post disappears
+  publish_at?: string, // RFC 3339, posts right away when left out
+  visibility?: 'public' | 'followers' | 'private' | 'local', // public when left out
+  local_radius?: number, // meters, for local posts
+  location_precision?: 'exact' | '100m' | 'neighborhood' | 'city', // how precisely others see the location
+  poll?: { options: string[], multiple_choice?: boolean, closes_at?: string }, // 2 to 6 options
+  repost_of?: number, // post ID to repost or quote
+  repost_kind?: 'repost' | 'quote' // a quote needs content, a repost doesn't
 }) => api.post('/api/posts', data);
 
+// Uploads files as multipart/form-data so they stream to disk instead of going through base64
+export const createPostWithFiles = (data: {
+  user_id: number,
+  content: string,
+  latitude: number,
+  longitude: number,
+  expires_in?: number,
+  publish_at?: string,
+  visibility?: 'public' | 'followers' | 'private' | 'local',
+  local_radius?: number,
+  location_precision?: 'exact' | '100m' | 'neighborhood' | 'city'
+}, files: File[]) => {
+  const form = new FormData();
+  form.append('user_id', String(data.user_id));
+  form.append('content', data.content);
+  form.append('latitude', String(data.latitude));
+  form.append('longitude', String(data.longitude));
+  if (data.expires_in) form.append('expires_in', String(data.expires_in));
+  if (data.publish_at) form.append('publish_at', data.publish_at);
+  if (data.visibility) form.append('visibility', data.visibility);
+  if (data.local_radius) form.append('local_radius', String(data.local_radius));
+  if (data.location_precision) form.append('location_precision', data.location_precision);
+  files.forEach((file) => form.append('files', file, file.name));
+  // override the JSON default, axios fills in the multipart boundary
+  return api.post('/api/posts', form, { headers: { 'Content-Type': 'multipart/form-data' } });
+};
+
 export const deletePost = (postId: number) => 
   api.delete(`/api/posts/${postId}`);
 
+// Follow endpoints
+export const followUser = (userId: number) =>
+  api.post(`/api/users/${userId}/follow`);
+
+export const unfollowUser = (userId: number) =>
+  api.delete(`/api/users/${userId}/follow`);
+
+// Scheduled posts endpoints
+export const getScheduledPosts = () =>
+  api.get('/api/account/scheduled-posts');
+
+export const reschedulePost = (postId: number, publishAt: string) =>
+  api.put(`/api/account/scheduled-posts/${postId}`, { publish_at: publishAt });
+
+export const cancelScheduledPost = (postId: number) =>
+  api.delete(`/api/account/scheduled-posts/${postId}`);
+
+
+// Poll endpoints
+export const votePoll = (postId: number, optionIds: number[]) =>
+  api.post(`/api/posts/${postId}/poll/vote`, { option_ids: optionIds });
+
+export const changePollVote = (postId: number, optionIds: number[]) =>
+  api.put(`/api/posts/${postId}/poll/vote`, { option_ids: optionIds });
+
+
+// Bookmark endpoints
+export const bookmarkPost = (postId: number, collectionId?: number) =>
+  api.post(`/api/posts/${postId}/bookmark`, { collection_id: collectionId });
+
+export const unbookmarkPost = (postId: number) =>
+  api.post(`/api/posts/${postId}/unbookmark`);
+
+export const getBookmarks = (params?: { collection_id?: number, limit?: number, offset?: number }) =>
+  api.get('/api/bookmarks', { params });
+
+export const getBookmarkCollections = () =>
+  api.get('/api/bookmarks/collections');
+
+export const createBookmarkCollection = (name: string) =>
+  api.post('/api/bookmarks/collections', { name });
+
+export const renameBookmarkCollection = (collectionId: number, name: string) =>
+  api.put(`/api/bookmarks/collections/${collectionId}`, { name });
+
+export const deleteBookmarkCollection = (collectionId: number) =>
+  api.delete(`/api/bookmarks/collections/${collectionId}`);
+
 
 // Likes endpoints
 export const likePost = (userId: number, postId: number) => 
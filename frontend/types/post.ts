@@ -1,8 +1,34 @@
+// A hashtag or @mention, start and end are UTF-16 offsets into content, so content.slice(start, end) is the entity
+export type Entity = {
+  type: 'hashtag' | 'mention';
+  start: number;
+  end: number;
+  tag?: string;
+  user_id?: number;
+  username?: string;
+};
+
+export type PollOption = {
+  option_id: number;
+  text: string;
+  vote_count: number;
+};
+
+export type Poll = {
+  multiple_choice: boolean;
+  closes_at: string | null;
+  closed: boolean;
+  voter_count: number;
+  options: PollOption[];
+  voted: number[]; // option IDs the current user picked
+};
+
 export type Comment = {
   comment_id: number;
   user_id: number;
   username: string;
   content: string;
+  entities?: Entity[];
   created_at: string;
   replies?: Comment[];
   parent_id?: number;
@@ -18,5 +44,35 @@ export type Post = {
   longitude: number;
   created_at: string;
   like_count: number;
+  entities?: Entity[];
+  poll?: Poll | null;
+  repost_of_id?: number | null;
+  repost_kind?: 'repost' | 'quote' | null;
+  repost_count?: number;
+  quote_count?: number;
+  // the reposted or quoted post, or a tombstone once it's gone
+  original?: Post | { deleted: true } | null;
+  bookmarked?: boolean;
   comments?: Comment[];
 };
+
+export type BookmarkCollection = {
+  collection_id: number;
+  name: string;
+  created_at: string;
+  bookmark_count: number;
+};
+
+export type PostCluster = {
+  latitude: number;
+  longitude: number;
+  count: number;
+  top_post_id: number;
+  newest_at: string;
+};
+
+export type TileClusters = {
+  tile: string; // zoom/x/y
+  bbox: [number, number, number, number];
+  clusters: PostCluster[];
+};